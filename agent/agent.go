@@ -1,22 +1,106 @@
 package agent
 
 import (
+	"context"
 	"github.com/sajuno/goon/language/lsp"
+	"github.com/sajuno/goon/openai/runstream"
+	"github.com/sajuno/goon/openai/tools/functions"
 	"github.com/sajuno/goon/rag"
+	"github.com/sajuno/goon/workspace"
 	"github.com/sashabaranov/go-openai"
+	"time"
 )
 
+// Backend is the OpenAI API used to answer prompts
+type Backend string
+
+const (
+	// BackendAssistants uses a pre-configured assistant, threads and runs
+	BackendAssistants Backend = "assistants"
+
+	// BackendChat uses chat completions with in-process tool calling, it doesn't need an assistant
+	// and works with OpenAI compatible providers
+	BackendChat Backend = "chat"
+)
+
+type Config struct {
+	// Workspace confines the paths tools can access, results are reported relative to its root
+	Workspace *workspace.Workspace
+
+	Backend Backend
+
+	// Timeout bounds answering a single prompt including its tool calls, 0 means no timeout
+	Timeout time.Duration
+
+	Assistant AssistantConfig
+	Chat      ChatConfig
+	Embedding EmbeddingConfig
+	GoTools   GoToolsConfig
+}
+
 type AssistantConfig struct {
 	ID string
 }
+
+type ChatConfig struct {
+	Model string
+
+	// MaxToolRounds bounds tool calling round trips per prompt
+	MaxToolRounds int
+
+	// HistoryTokens bounds the earlier conversation sent along with a prompt, older turns are trimmed beyond it
+	HistoryTokens int
+}
+
+// EmbeddingConfig determines how code chunks and queries are embedded.
+// Indexing and querying must use the same model and dimensions, which is why they are recorded per snapshot.
+type EmbeddingConfig struct {
+	Model openai.EmbeddingModel
+
+	// Dimensions shortens the resulting embeddings when > 0
+	Dimensions int
+
+	// Encoding is the tiktoken encoding name, derived from Model if empty
+	Encoding string
+}
+
+// GoToolsConfig controls the tools running go build, vet, test and doc in the workspace.
+// Tests execute arbitrary code, so they're off unless enabled.
+type GoToolsConfig struct {
+	Enabled bool
+
+	// Timeout bounds a single go command
+	Timeout time.Duration
+}
+
+// ConfirmFunc asks the user to confirm an action the model wants to take
+type ConfirmFunc func(ctx context.Context, prompt string) (bool, error)
+
 type Agent struct {
-	cfg AssistantConfig
+	cfg Config
 
 	openai   *openai.Client
+	runs     *runstream.Client
 	ragStore rag.Store
 	lsp      *lsp.Client
+	tools    *functions.Registry
+
+	// confirm is nil when there's no one to ask, e.g. outside of the repl
+	confirm ConfirmFunc
+}
+
+func New(openai *openai.Client, runs *runstream.Client, ragStore rag.Store, cfg Config, lsp *lsp.Client) *Agent {
+	a := &Agent{cfg: cfg, openai: openai, runs: runs, ragStore: ragStore, lsp: lsp}
+	a.tools = a.newToolRegistry()
+	return a
+}
+
+// SetConfirm makes the agent ask before running commands, it must be called before the agent is used
+func (a *Agent) SetConfirm(confirm ConfirmFunc) {
+	a.confirm = confirm
 }
 
-func New(openai *openai.Client, ragStore rag.Store, cfg AssistantConfig, lsp *lsp.Client) *Agent {
-	return &Agent{cfg: cfg, openai: openai, ragStore: ragStore, lsp: lsp}
+// Workspace returns the workspace the agent works in
+func (a *Agent) Workspace() *workspace.Workspace {
+	return a.cfg.Workspace
 }
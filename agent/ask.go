@@ -0,0 +1,292 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"github.com/sajuno/goon/language/golang"
+	"github.com/sajuno/goon/language/lsp"
+	"github.com/sajuno/goon/session"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// askSurroundingLines is the amount of lines shown around a location outside of any declaration
+	askSurroundingLines = 15
+
+	// maxAskReferences caps the references listed for the code at a location
+	maxAskReferences = 12
+
+	// maxAskNeighbourhood caps the size of the definition and referencing declarations shown with the code
+	maxAskNeighbourhood = 24 * 1024
+)
+
+// DefaultAskQuestion is asked about a location when no question is given
+const DefaultAskQuestion = "Explain this code."
+
+// Location is a position in a file of the workspace, Line and Col are 1-based with Col in bytes.
+// Col is 0 if the location is a whole line.
+type Location struct {
+	Path string
+	Line int
+	Col  int
+}
+
+func (l Location) String() string {
+	if l.Col == 0 {
+		return fmt.Sprintf("%s:%d", l.Path, l.Line)
+	}
+	return fmt.Sprintf("%s:%d:%d", l.Path, l.Line, l.Col)
+}
+
+// Ask answers a question about the code at a location. The declaration enclosing it is taken from the index or
+// parsed from the file, and shown along with the definition of the identifier at the location and the code referencing
+// it. Like Explain the answer is streamed to out and questions in the same session are follow-ups.
+func (a *Agent) Ask(ctx context.Context, sess *session.Session, loc Location, question string, out Stream) (string, error) {
+	if out == nil {
+		out = discardStream{}
+	}
+	if question == "" {
+		question = DefaultAskQuestion
+	}
+
+	abs, err := a.cfg.Workspace.Abs(loc.Path)
+	if err != nil {
+		return "", err
+	}
+	loc.Path = a.cfg.Workspace.Display(abs)
+
+	out.Status("looking up " + loc.String())
+	code, chunk, err := a.codeAt(ctx, abs, loc)
+	if err != nil {
+		return "", err
+	}
+
+	var neighbourhood string
+	if filepath.Ext(abs) == ".go" {
+		out.Status("collecting definitions and references")
+		neighbourhood = a.askNeighbourhood(ctx, abs, loc, chunk, out)
+	}
+
+	var prompt string
+	if len(sess.Turns) == 0 {
+		prompt = fmt.Sprintf(`
+%s
+%s
+The user is looking at %s and asks: "%s"
+
+Answer the question about the code at that location, shown first above. The definitions and references after it are
+context, refer to them where they explain what the code does or how it's used, don't explain them on their own.
+Be concise, accurate, and if you can an asshole about it, please do so.
+`, code, neighbourhood, loc, question)
+	} else {
+		prompt = fmt.Sprintf(`
+%s
+%s
+The user is now looking at %s and asks a follow-up question: "%s"
+
+Answer it in light of the earlier questions and your earlier answers in this conversation, about the code at that
+location shown first above.
+Be concise, accurate, and if you can an asshole about it, please do so.
+`, code, neighbourhood, loc, question)
+	}
+
+	response, err := a.promptAI(ctx, sess, prompt, out)
+	if err != nil {
+		return "", fmt.Errorf("LLM prompt failed: %w", err)
+	}
+
+	sess.AddTurn(fmt.Sprintf("%s (at %s)", question, loc), response)
+
+	return response, nil
+}
+
+// codeAt formats the declaration enclosing a location followed by the location's line.
+// Outside of declarations and in other files than Go the surrounding lines are shown instead.
+func (a *Agent) codeAt(ctx context.Context, abs string, loc Location) (string, *golang.Chunk, error) {
+	b, err := os.ReadFile(abs)
+	if err != nil {
+		return "", nil, err
+	}
+	lines := strings.Split(string(b), "\n")
+	if loc.Line < 1 || loc.Line > len(lines) {
+		return "", nil, fmt.Errorf("line %d is outside of %s's %d lines", loc.Line, loc.Path, len(lines))
+	}
+	line := lines[loc.Line-1]
+
+	var chunk *golang.Chunk
+	if filepath.Ext(abs) == ".go" {
+		chunks, err := a.fileChunks(ctx, abs)
+		if err != nil {
+			return "", nil, err
+		}
+		chunk = enclosingChunk(chunks, loc.Line)
+	}
+
+	var sb strings.Builder
+	start, end := max(loc.Line-askSurroundingLines, 1), min(loc.Line+askSurroundingLines, len(lines))
+	if chunk != nil {
+		start, end = chunk.StartLine, chunk.EndLine
+		sb.WriteString(fmt.Sprintf("# %s (%s, %s:%d-%d)\n\n", chunk.Name, chunk.Kind, loc.Path, start, end))
+	} else {
+		sb.WriteString(fmt.Sprintf("# %s:%d-%d\n\n", loc.Path, start, end))
+	}
+
+	lang := strings.TrimPrefix(filepath.Ext(abs), ".")
+	sb.WriteString("```" + lang + "\n")
+	for i := start; i <= end && i <= len(lines); i++ {
+		sb.WriteString(lines[i-1] + "\n")
+	}
+	sb.WriteString("```\n\n")
+
+	sb.WriteString(fmt.Sprintf("The location is line %d: `%s`", loc.Line, strings.TrimSpace(line)))
+	if ident := identifierAt(line, loc.Col); ident != "" {
+		sb.WriteString(fmt.Sprintf(", at the identifier `%s`", ident))
+	}
+	sb.WriteString("\n\n")
+
+	return sb.String(), chunk, nil
+}
+
+// askNeighbourhood formats the definition of the identifier at a location and the declarations referencing it.
+// Without a column, or without an identifier at it, the references are those of the enclosing declaration.
+// Language server failures only leave parts out.
+func (a *Agent) askNeighbourhood(ctx context.Context, abs string, loc Location, chunk *golang.Chunk, out Stream) string {
+	var (
+		sb   strings.Builder
+		size int
+	)
+
+	line, col := loc.Line, loc.Col
+	if line > 0 && col > 0 {
+		b, err := os.ReadFile(abs)
+		if err == nil {
+			lines := strings.Split(string(b), "\n")
+			if identifierAt(lines[loc.Line-1], col) == "" {
+				col = 0
+			}
+		}
+	}
+	if col == 0 && chunk != nil {
+		firstLine, _, _ := strings.Cut(chunk.Content, "\n")
+		if c := declNameColumn(firstLine, chunk.Name); c >= 0 {
+			line, col = chunk.StartLine, c+1
+		}
+	}
+	if col == 0 {
+		return ""
+	}
+
+	uri, pos, err := a.lspPosition(abs, line, col)
+	if err != nil {
+		out.Status(fmt.Sprintf("no language server context: %v", err))
+		return ""
+	}
+
+	// the definition is only worth showing when it's not the code at the location itself
+	if def, err := a.lsp.GoToDefinition(uri, pos.Line, pos.Character); err != nil {
+		out.Status(fmt.Sprintf("no definition: %v", err))
+	} else if def != nil {
+		defLine := def.Range.Start.Line + 1
+		inChunk := chunk != nil && def.URI == lsp.FileURI(abs) && chunk.StartLine <= defLine && defLine <= chunk.EndLine
+
+		path, err := a.cfg.Workspace.Rel(def.URI)
+		if !inChunk && err == nil {
+			if decl, ok := a.chunkAt(ctx, callNeighbour{Path: path, Line: defLine}); ok {
+				size += len(decl.Content)
+				sb.WriteString(fmt.Sprintf("# Definition: %s (%s:%d-%d)\n\n```go\n%s\n```\n\n", decl.Name, path, decl.StartLine, decl.EndLine, decl.Content))
+			}
+		} else if !inChunk {
+			// outside of the workspace, e.g. the standard library, the documentation says more than the source
+			if hover, err := a.lsp.Hover(uri, pos.Line, pos.Character); err == nil && hover != nil {
+				sb.WriteString(fmt.Sprintf("# Definition (%s:%d)\n\n%s\n\n", a.cfg.Workspace.Display(def.URI), defLine, hover.Contents.Value))
+			}
+		}
+	}
+
+	refs, err := a.lsp.FindReferences(uri, pos.Line, pos.Character)
+	if err != nil {
+		out.Status(fmt.Sprintf("no references: %v", err))
+		return sb.String()
+	}
+
+	var (
+		listed     []string
+		referenced bool
+		seen       = make(map[string]bool)
+	)
+	for _, ref := range refs {
+		path, err := a.cfg.Workspace.Rel(ref.URI)
+		if err != nil {
+			continue
+		}
+		refLine := ref.Range.Start.Line + 1
+		if chunk != nil && ref.URI == lsp.FileURI(abs) && chunk.StartLine <= refLine && refLine <= chunk.EndLine {
+			continue
+		}
+
+		decl, ok := a.chunkAt(ctx, callNeighbour{Path: path, Line: refLine})
+		if !ok {
+			listed = append(listed, fmt.Sprintf("%s:%d", path, refLine))
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", path, decl.StartLine)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if len(seen) > maxAskReferences || size+len(decl.Content) > maxAskNeighbourhood {
+			listed = append(listed, fmt.Sprintf("%s (%s:%d)", decl.Name, path, refLine))
+			continue
+		}
+		if !referenced {
+			sb.WriteString("# Referenced by\n\n")
+			referenced = true
+		}
+		size += len(decl.Content)
+		sb.WriteString(fmt.Sprintf("## %s (%s:%d-%d)\n\n```go\n%s\n```\n\n", decl.Name, path, decl.StartLine, decl.EndLine, decl.Content))
+	}
+	if len(listed) > 0 {
+		sb.WriteString("Also referenced at: " + strings.Join(listed, ", ") + "\n\n")
+	}
+
+	return sb.String()
+}
+
+// enclosingChunk returns the innermost chunk containing a line, nil if the line is outside of all of them
+func enclosingChunk(chunks []golang.Chunk, line int) *golang.Chunk {
+	var enclosing *golang.Chunk
+	for i, c := range chunks {
+		if c.StartLine > line || line > c.EndLine {
+			continue
+		}
+		if enclosing == nil || c.EndLine-c.StartLine < enclosing.EndLine-enclosing.StartLine {
+			enclosing = &chunks[i]
+		}
+	}
+	return enclosing
+}
+
+// identifierAt returns the identifier at a 1-based byte column of a line, empty if there's none
+func identifierAt(line string, col int) string {
+	if col < 1 || col > len(line) {
+		return ""
+	}
+
+	// bytes of multi-byte runes are taken to be letters, Go identifiers can't contain other non-ASCII runes
+	isIdent := func(b byte) bool {
+		return b == '_' || b >= utf8.RuneSelf || unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b))
+	}
+	start, end := col-1, col-1
+	for start > 0 && isIdent(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isIdent(line[end]) {
+		end++
+	}
+	return line[start:end]
+}
@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/session"
+	"github.com/sashabaranov/go-openai"
+	"io"
+	"strings"
+)
+
+// defaultMaxToolRounds bounds the amount of tool calling round trips of a single chat prompt
+const defaultMaxToolRounds = 20
+
+// promptChat answers with the Chat Completions API, tools are called in-process.
+// The conversation is kept in the session rather than on OpenAI's side.
+func (a *Agent) promptChat(ctx context.Context, sess *session.Session, prompt string, out Stream) (string, error) {
+	if len(sess.Messages) == 0 {
+		sess.Messages = append(sess.Messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: codeAnalysisInstructions,
+		})
+	}
+
+	// work on a copy so a failed prompt doesn't leave half a conversation in the session.
+	// Sessions are kept trimmed, every prompt sends the whole history along
+	history := a.trimHistory(sess.Messages)
+	messages := append(history[:len(history):len(history)], openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: prompt,
+	})
+
+	maxRounds := a.cfg.Chat.MaxToolRounds
+	if maxRounds <= 0 {
+		maxRounds = defaultMaxToolRounds
+	}
+
+	for range maxRounds {
+		msg, err := a.streamChatCompletion(ctx, messages, out)
+		if err != nil {
+			return "", err
+		}
+		messages = append(messages, msg)
+
+		if len(msg.ToolCalls) == 0 {
+			sess.Messages = messages
+			return msg.Content, nil
+		}
+
+		for _, output := range a.callTools(ctx, msg.ToolCalls, out) {
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				ToolCallID: output.CallID,
+				Content:    output.Output,
+			})
+		}
+	}
+
+	return "", fmt.Errorf("no answer after %d rounds of tool calls", maxRounds)
+}
+
+// streamChatCompletion streams a single completion, content is written to out while tool calls are accumulated
+func (a *Agent) streamChatCompletion(ctx context.Context, messages []openai.ChatCompletionMessage, out Stream) (openai.ChatCompletionMessage, error) {
+	stream, err := a.openai.CreateChatCompletionStream(ctx, openai.ChatCompletionRequest{
+		Model:    a.cfg.Chat.Model,
+		Messages: messages,
+		Tools:    a.chatTools(),
+	})
+	if err != nil {
+		return openai.ChatCompletionMessage{}, fmt.Errorf("failed to create chat completion: %w", err)
+	}
+	defer stream.Close()
+
+	var (
+		content   strings.Builder
+		toolCalls []openai.ToolCall
+		finish    openai.FinishReason
+	)
+
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return openai.ChatCompletionMessage{}, ctx.Err()
+			}
+			return openai.ChatCompletionMessage{}, fmt.Errorf("failed to read chat completion stream: %w", err)
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+
+		choice := resp.Choices[0]
+		if choice.FinishReason != "" {
+			finish = choice.FinishReason
+		}
+
+		content.WriteString(choice.Delta.Content)
+		out.Delta(choice.Delta.Content)
+
+		// tool calls arrive in pieces, identified by their index
+		for _, tc := range choice.Delta.ToolCalls {
+			idx := len(toolCalls)
+			if tc.Index != nil {
+				idx = *tc.Index
+			}
+			for len(toolCalls) <= idx {
+				toolCalls = append(toolCalls, openai.ToolCall{Type: openai.ToolTypeFunction})
+			}
+
+			call := &toolCalls[idx]
+			if tc.ID != "" {
+				call.ID = tc.ID
+			}
+			call.Function.Name += tc.Function.Name
+			call.Function.Arguments += tc.Function.Arguments
+		}
+	}
+
+	switch finish {
+	case openai.FinishReasonLength:
+		return openai.ChatCompletionMessage{}, errors.New("answer was cut off at the model's token limit")
+	case openai.FinishReasonContentFilter:
+		return openai.ChatCompletionMessage{}, errors.New("answer was blocked by the content filter")
+	}
+
+	return openai.ChatCompletionMessage{
+		Role:      openai.ChatMessageRoleAssistant,
+		Content:   content.String(),
+		ToolCalls: toolCalls,
+	}, nil
+}
+
+func (a *Agent) chatTools() []openai.Tool {
+	defs := a.tools.Definitions()
+	tools := make([]openai.Tool, 0, len(defs))
+	for _, def := range defs {
+		tools = append(tools, openai.Tool{
+			Type:     openai.ToolTypeFunction,
+			Function: &def,
+		})
+	}
+	return tools
+}
@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/language/golang"
+	"github.com/sajuno/goon/language/lsp"
+	"github.com/sajuno/goon/rag"
+	"os"
+	"strings"
+)
+
+// fileChunks returns the chunks of a Go file. Indexed chunks are used unless the file changed since it was indexed,
+// the file is parsed in that case so line numbers match the current source.
+func (a *Agent) fileChunks(ctx context.Context, path string) ([]golang.Chunk, error) {
+	var pkgPath string
+
+	snapshot, err := a.Snapshot(ctx)
+	if err != nil && !errors.Is(err, rag.ErrNoSnapshot) {
+		return nil, err
+	}
+	if err == nil {
+		indexed, err := a.ragStore.FindChunks(ctx, snapshot.ID, rag.ChunkQuery{FilePath: path})
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up chunks of %s: %w", a.cfg.Workspace.Display(path), err)
+		}
+
+		info, statErr := os.Stat(path)
+		if len(indexed) > 0 && statErr == nil && !info.ModTime().After(snapshot.CreatedAt) {
+			chunks := make([]golang.Chunk, 0, len(indexed))
+			for _, c := range indexed {
+				chunks = append(chunks, c.Chunk)
+			}
+			return chunks, nil
+		}
+		if len(indexed) > 0 {
+			pkgPath = indexed[0].Package
+		}
+	}
+
+	return golang.ChunkFile(path, pkgPath)
+}
+
+// callNeighbour is a caller or callee of a chunk
+type callNeighbour struct {
+	Name string
+	Path string
+
+	// Line is 1-based
+	Line int
+}
+
+func (n callNeighbour) String() string {
+	return fmt.Sprintf("%s (%s:%d)", n.Name, n.Path, n.Line)
+}
+
+// callNeighbours returns the callers and callees of a function or method chunk within the workspace, using gopls
+func (a *Agent) callNeighbours(chunk golang.Chunk, limit int) (callers, callees []callNeighbour, err error) {
+	if !chunk.IsInvokable() {
+		return nil, nil, nil
+	}
+
+	uri, err := a.openFile(chunk.FilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	firstLine, _, _ := strings.Cut(chunk.Content, "\n")
+	character := declNameColumn(firstLine, chunk.Name)
+	if character < 0 {
+		return nil, nil, fmt.Errorf("failed to locate %s in its declaration", chunk.Name)
+	}
+
+	items, err := a.lsp.PrepareCallHierarchy(uri, chunk.StartLine-1, character)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	neighbour := func(item lsp.CallHierarchyItem) (callNeighbour, bool) {
+		path, err := a.cfg.Workspace.Rel(item.URI)
+		if err != nil {
+			return callNeighbour{}, false
+		}
+		return callNeighbour{Name: item.Name, Path: path, Line: item.SelectionRange.Start.Line + 1}, true
+	}
+
+	for _, item := range items {
+		incoming, err := a.lsp.IncomingCalls(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, call := range incoming {
+			if n, ok := neighbour(call.From); ok && len(callers) < limit {
+				callers = append(callers, n)
+			}
+		}
+
+		outgoing, err := a.lsp.OutgoingCalls(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, call := range outgoing {
+			if n, ok := neighbour(call.To); ok && len(callees) < limit {
+				callees = append(callees, n)
+			}
+		}
+	}
+
+	return callers, callees, nil
+}
+
+// openFile opens a file in the language server, which is required before querying it
+func (a *Agent) openFile(path string) (string, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	uri := lsp.FileURI(path)
+	if err := a.lsp.DidOpen(uri, "go", string(text), 1); err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", a.cfg.Workspace.Display(path), err)
+	}
+	return uri, nil
+}
+
+// declNameColumn returns the 0-based column of a function's name in its declaration line, skipping the receiver
+func declNameColumn(line, name string) int {
+	offset := 0
+	if strings.HasPrefix(line, "func (") {
+		offset = strings.Index(line, ")") + 1
+	}
+
+	i := strings.Index(line[offset:], name)
+	if i < 0 {
+		return -1
+	}
+	return offset + i
+}
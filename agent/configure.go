@@ -3,7 +3,6 @@ package agent
 import (
 	"context"
 	"fmt"
-	"github.com/sajuno/goon/openai/tools/functions"
 	"github.com/sashabaranov/go-openai"
 )
 
@@ -11,15 +10,36 @@ const (
 	codeAnalysisInstructions = `
 You are a code analysis assistant with access to Language Server Protocol (LSP) tools. You can inspect a Go codebase by issuing structured tool calls like:
 
-- did_open_file(uri, lang_id, text, version)
+- search_code(query, package, kinds, limit): semantic search over the indexed code, use it as often as you need
+- read_file(path, start_line, end_line): read source text, Go files are opened in the language server automatically
+- list_directory(path) / grep(pattern, path): find your way around the repository
+- did_open(uri, text, lang_id, version)
 - go_to_definition(uri, line, character)
 - find_references(uri, line, character)
+- hover(uri, line, character): a symbol's type, signature and documentation
+- signature_help(uri, line, character): the signature of the function called at a position
+- workspace_symbol(query): find where a symbol is declared by name
+- document_symbols(uri): list the symbols declared in a file
+- find_implementations(uri, line, character): jump from an interface (method) to its implementations
+- go_to_type_definition(uri, line, character): the declaration of a symbol's type
+- incoming_calls(uri, line, character) / outgoing_calls(uri, line, character): callers and callees of a function
+- diagnostics(uri): compiler errors, vet findings and lints of a file, or of all files when uri is empty
+- go_build(package) / go_vet(package) / go_test(package, run) / go_doc(symbol): only when enabled, the user may decline to run them
+- rename_symbol(uri, line, character, new_name) / code_actions(uri, start_line, end_line) / apply_code_action(uri, start_line, end_line, title):
+  refactor with gopls, only when the user asks for a change. The user reviews the patch and may decline it
 
-You are not given some context up front, but you must explore the code by reading files and issuing tool requests. Assume the user’s question refers to real symbols in the codebase. Ask for files to be opened or symbols to be resolved before answering.
+Paths and uris are relative to the repository root (e.g. "pkg/file.go"), results use the same notation.
+Files outside of the repository or ignored by it can't be accessed. Lines and characters of LSP tools are 0-based, read_file's lines are 1-based.
+
+Go code is interface heavy, go_to_definition on a method call often lands on an interface declaration.
+Use find_implementations from there to follow the request path into the concrete type.
+
+You are given some context up front, but you must explore the code by reading files and issuing tool requests.
+Read a file before using position based tools on it, positions you guess are wrong. Assume the user’s question refers to real symbols in the codebase. Ask for files to be opened or symbols to be resolved before answering.
 
 Always reason step-by-step:
 1. Figure out what symbol or concept the user is asking about.
-2. Determine what file or location you want to inspect.
+2. Determine what file or location you want to inspect, use workspace_symbol to turn a name into a path and position.
 3. Use tools to look up definitions, references, types, or related code.
 4. Accumulate what you’ve learned before giving an answer.
 
@@ -33,14 +53,14 @@ You are not a search engine. You are a senior dev with tools — use them to fig
 
 func (a *Agent) Configure(ctx context.Context) error {
 	var tools []openai.AssistantTool
-	for _, def := range functions.Definitions() {
+	for _, def := range a.tools.Definitions() {
 		tools = append(tools, openai.AssistantTool{
 			Type:     openai.AssistantToolTypeFunction,
 			Function: &def,
 		})
 	}
 
-	_, err := a.openai.ModifyAssistant(ctx, a.cfg.ID, openai.AssistantRequest{
+	_, err := a.openai.ModifyAssistant(ctx, a.cfg.Assistant.ID, openai.AssistantRequest{
 		Name:         ptr("Goon"),
 		Description:  ptr("Goon's code analysis assistent"),
 		Instructions: ptr(codeAnalysisInstructions),
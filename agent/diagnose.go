@@ -0,0 +1,192 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/language/lsp"
+	"github.com/sajuno/goon/session"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// diagnosticsQuietPeriod is how long gopls has to stay silent before diagnostics are considered complete
+	diagnosticsQuietPeriod = 3 * time.Second
+
+	// diagnosticsTimeout bounds waiting for gopls, loading a large workspace takes a while
+	diagnosticsTimeout = 2 * time.Minute
+
+	// maxDiagnostics caps the amount of diagnostics sent to the model
+	maxDiagnostics = 200
+)
+
+// Diagnose opens the Go files under path in the language server, collects the diagnostics it publishes
+// and has the model explain and prioritise them. An empty answer means gopls settled without reporting anything,
+// an error is returned when it didn't settle in time.
+func (a *Agent) Diagnose(ctx context.Context, path string, out Stream) (string, error) {
+	if out == nil {
+		out = discardStream{}
+	}
+
+	// paths on the command line are relative to the working directory, not the workspace root
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if root, err = a.cfg.Workspace.Abs(root); err != nil {
+		return "", err
+	}
+
+	files, err := a.goFiles(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to collect go files: %w", err)
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no go files found in %s", a.cfg.Workspace.Display(root))
+	}
+
+	out.Status(fmt.Sprintf("opening %d files in gopls", len(files)))
+	for _, file := range files {
+		text, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		if err := a.lsp.DidOpen(lsp.FileURI(file), "go", string(text), 1); err != nil {
+			return "", fmt.Errorf("failed to open %s: %w", file, err)
+		}
+	}
+
+	out.Status("waiting for diagnostics")
+	waitCtx, cancel := context.WithTimeout(ctx, diagnosticsTimeout)
+	defer cancel()
+	// without a quiet period gopls may still be loading or analysing, finding nothing then isn't a clean result
+	err = a.lsp.WaitForDiagnostics(waitCtx, diagnosticsQuietPeriod)
+	incomplete := errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil
+	if err != nil && !incomplete {
+		return "", err
+	}
+
+	report, count := a.diagnosticsReport(root, a.lsp.AllDiagnostics())
+	if incomplete {
+		if count == 0 {
+			return "", fmt.Errorf("gopls didn't report in %s, results may be incomplete", diagnosticsTimeout)
+		}
+		out.Status(fmt.Sprintf("gopls didn't finish reporting in %s, results may be incomplete", diagnosticsTimeout))
+	}
+	if count == 0 {
+		return "", nil
+	}
+	out.Status(fmt.Sprintf("found %d diagnostics", count))
+
+	prompt := fmt.Sprintf(`
+# Diagnostics
+
+%s
+
+The language server (gopls, including vet and staticcheck analyzers) reported the diagnostics above for a Go codebase.
+Each diagnostic is shown as file:line:column, severity, source and message, followed by the offending line.
+
+Explain what each (group of) diagnostic means and prioritise them: compile errors first,
+then likely bugs, then style and simplifications. Suggest a concrete fix for each, as code where it helps.
+Group diagnostics that share a root cause. You can use your tools to look at the surrounding code.
+Be concise, accurate, and if you can an asshole about it, please do so.
+`, report)
+
+	return a.promptAI(ctx, session.New(), prompt, out)
+}
+
+// diagnosticsReport formats the diagnostics of files under root, most severe first
+func (a *Agent) diagnosticsReport(root string, diagnostics map[string][]lsp.Diagnostic) (string, int) {
+	type entry struct {
+		path string
+		diag lsp.Diagnostic
+	}
+
+	rootURI := lsp.FileURI(root)
+	var entries []entry
+	for uri, diags := range diagnostics {
+		if uri != rootURI && !strings.HasPrefix(uri, rootURI+"/") {
+			continue
+		}
+		path, err := a.cfg.Workspace.Rel(uri)
+		if err != nil {
+			continue
+		}
+		for _, d := range diags {
+			entries = append(entries, entry{path: path, diag: d})
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b entry) int {
+		if a.diag.Severity != b.diag.Severity {
+			return int(a.diag.Severity) - int(b.diag.Severity)
+		}
+		if a.path != b.path {
+			return strings.Compare(a.path, b.path)
+		}
+		return a.diag.Range.Start.Line - b.diag.Range.Start.Line
+	})
+
+	count := len(entries)
+	if len(entries) > maxDiagnostics {
+		entries = entries[:maxDiagnostics]
+	}
+
+	lines := make(map[string][]string)
+	var sb strings.Builder
+	for _, e := range entries {
+		d := e.diag
+		source := d.Source
+		if len(d.Code) > 0 {
+			source += " " + strings.Trim(string(d.Code), `"`)
+		}
+		sb.WriteString(fmt.Sprintf("- %s:%d:%d %s [%s] %s\n",
+			e.path, d.Range.Start.Line+1, d.Range.Start.Character+1, d.Severity, strings.TrimSpace(source), d.Message))
+
+		if _, ok := lines[e.path]; !ok {
+			b, _ := os.ReadFile(filepath.Join(a.cfg.Workspace.Root(), filepath.FromSlash(e.path)))
+			lines[e.path] = strings.Split(string(b), "\n")
+		}
+		if l := d.Range.Start.Line; l < len(lines[e.path]) {
+			sb.WriteString(fmt.Sprintf("  `%s`\n", strings.TrimSpace(lines[e.path][l])))
+		}
+	}
+
+	if count > len(entries) {
+		sb.WriteString(fmt.Sprintf("\n(%d more diagnostics omitted)\n", count-len(entries)))
+	}
+
+	return sb.String(), count
+}
+
+// goFiles returns the Go files under root, skipping ignored, vendored, testdata and hidden directories
+func (a *Agent) goFiles(root string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			name := d.Name()
+			if path != root && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			if a.cfg.Workspace.Ignored(a.cfg.Workspace.Display(path), true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if strings.HasSuffix(path, ".go") && !a.cfg.Workspace.Ignored(a.cfg.Workspace.Display(path), false) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,474 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"github.com/sajuno/goon/gitdiff"
+	"github.com/sajuno/goon/language/golang"
+	"github.com/sajuno/goon/session"
+	"go/format"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxDocBatch caps the code sent to the model in a single doc request
+	maxDocBatch = 24 * 1024
+
+	// maxDocDecl caps the code of a single declaration, long function bodies are cut off
+	maxDocDecl = 3 * 1024
+)
+
+type DocProblem string
+
+const (
+	DocMissing    DocProblem = "missing"
+	DocMismatched DocProblem = "mismatched"
+	DocStale      DocProblem = "stale"
+)
+
+// DocFinding is an exported symbol, or a package, whose doc comment needs work
+type DocFinding struct {
+	// Path is relative to the repository root
+	Path string `json:"path"`
+	Line int    `json:"line"`
+
+	// Symbol is the declared name, Type.Method for methods or "package name" for package comments
+	Symbol  string     `json:"symbol"`
+	Problem DocProblem `json:"problem"`
+	Reason  string     `json:"reason"`
+
+	file *golang.FileDocs
+
+	// decl is nil for package comments
+	decl *golang.DocDecl
+}
+
+// DocOptions scopes the doc audit
+type DocOptions struct {
+	// Package is a directory relative to the repository root, with a /... suffix to include its subdirectories.
+	// The whole repository is audited if it's empty.
+	Package string
+
+	// Static skips asking the model which doc comments are stale
+	Static bool
+}
+
+// AuditDocs lists exported symbols with missing doc comments, comments that don't follow the Go doc conventions
+// and, unless opts.Static is set, comments the model finds out of date with the code they document
+func (a *Agent) AuditDocs(ctx context.Context, opts DocOptions, out Stream) ([]DocFinding, error) {
+	if out == nil {
+		out = discardStream{}
+	}
+
+	packages, err := a.docPackages(opts.Package)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		findings   []DocFinding
+		documented []DocFinding
+	)
+	for _, files := range packages {
+		pkgFindings, pkgDocumented := a.auditPackage(files)
+		findings = append(findings, pkgFindings...)
+		documented = append(documented, pkgDocumented...)
+	}
+
+	if !opts.Static && len(documented) > 0 {
+		stale, err := a.staleDocs(ctx, documented, out)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, stale...)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Path != findings[j].Path {
+			return findings[i].Path < findings[j].Path
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, nil
+}
+
+// docPackages parses the non-test, non-generated files in scope, grouped by directory
+func (a *Agent) docPackages(pkg string) (map[string][]*golang.FileDocs, error) {
+	dir, recursive := strings.CutSuffix(pkg, "/...")
+	if pkg == "" || pkg == "..." {
+		dir, recursive = ".", true
+	}
+
+	root, err := a.cfg.Workspace.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("package %q must be a directory relative to the repository root, like ./rag or ./...", pkg)
+	}
+
+	paths, err := a.goFiles(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list go files: %w", err)
+	}
+
+	packages := make(map[string][]*golang.FileDocs)
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") || (!recursive && filepath.Dir(path) != root) {
+			continue
+		}
+		docs, err := golang.ParseDocs(path)
+		if err != nil {
+			return nil, err
+		}
+		if docs.Generated {
+			continue
+		}
+		packages[filepath.Dir(path)] = append(packages[filepath.Dir(path)], &docs)
+	}
+	return packages, nil
+}
+
+// auditPackage checks the package comment and the doc comments of exported declarations against the Go doc
+// conventions. Declarations that pass are returned as well, to be checked for stale docs.
+func (a *Agent) auditPackage(files []*golang.FileDocs) (findings, documented []DocFinding) {
+	var pkgDoc *golang.FileDocs
+	for _, f := range files {
+		if f.PackageDoc != "" && (pkgDoc == nil || filepath.Base(f.Path) == "doc.go") {
+			pkgDoc = f
+		}
+	}
+
+	name := files[0].Package
+	switch {
+	case name == "main":
+		// commands are documented by their usage
+	case pkgDoc == nil:
+		findings = append(findings, DocFinding{
+			Path:    a.cfg.Workspace.Display(filepath.Join(filepath.Dir(files[0].Path), "doc.go")),
+			Line:    1,
+			Symbol:  "package " + name,
+			Problem: DocMissing,
+			Reason:  "the package has no package comment",
+			file:    files[0],
+		})
+	case !startsWithName(pkgDoc.PackageDoc, "Package "+name):
+		findings = append(findings, DocFinding{
+			Path:    a.cfg.Workspace.Display(pkgDoc.Path),
+			Line:    pkgDoc.PackageDocStart,
+			Symbol:  "package " + name,
+			Problem: DocMismatched,
+			Reason:  fmt.Sprintf("the package comment should start with %q", "Package "+name),
+			file:    pkgDoc,
+		})
+	}
+
+	for _, f := range files {
+		for i := range f.Decls {
+			decl := &f.Decls[i]
+			finding := DocFinding{
+				Path:   a.cfg.Workspace.Display(f.Path),
+				Line:   decl.Line,
+				Symbol: decl.QualifiedName(),
+				file:   f,
+				decl:   decl,
+			}
+
+			switch {
+			case !decl.Documented():
+				finding.Problem, finding.Reason = DocMissing, fmt.Sprintf("exported %s has no doc comment", decl.Kind)
+			case decl.Doc != "" && decl.GroupDoc == "" && decl.Indent == "" && !startsWithName(decl.Doc, decl.Name):
+				// specs of a group may be documented in any form, the group comment introduces them
+				finding.Problem, finding.Reason = DocMismatched, fmt.Sprintf("the doc comment should start with %q", decl.Name)
+				finding.Line = decl.DocStart
+			default:
+				if decl.Doc != "" {
+					documented = append(documented, finding)
+				}
+				continue
+			}
+			findings = append(findings, finding)
+		}
+	}
+
+	return findings, documented
+}
+
+// startsWithName reports whether a doc comment starts with name, optionally preceded by an article
+func startsWithName(doc, name string) bool {
+	doc = strings.TrimSpace(doc)
+	for _, article := range []string{"", "A ", "An ", "The "} {
+		rest, ok := strings.CutPrefix(doc, article+name)
+		if ok && (rest == "" || strings.IndexAny(rest[:1], " \n\t.,:;'") == 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// staleDocs asks the model which of the documented declarations have comments that no longer match their code
+func (a *Agent) staleDocs(ctx context.Context, documented []DocFinding, out Stream) ([]DocFinding, error) {
+	var stale []DocFinding
+	for _, batch := range docBatches(documented) {
+		out.Status(fmt.Sprintf("checking %d doc comments", len(batch)))
+
+		var sb strings.Builder
+		for i, f := range batch {
+			sb.WriteString(fmt.Sprintf("## %d: %s (%s:%d)\n\n```go\n%s%s\n```\n\n", i, f.Symbol, f.Path, f.Line, comment(f.decl.Doc, ""), declCode(f.decl)))
+		}
+
+		prompt := fmt.Sprintf(`
+# Declarations
+
+%s
+
+Check whether the doc comments above still describe the declarations below them. A comment is stale when it
+describes parameters, results, behaviour or errors the code no longer has, or misses ones that matter to callers.
+Don't flag comments for being short, for style or for leaving out implementation details.
+
+Respond with JSON only, without code fences or prose around it, in exactly this format:
+{"stale": [{"id": 0, "reason": "what the comment gets wrong"}]}
+`, sb.String())
+
+		answer, err := a.promptAI(ctx, session.New(), prompt, statusStream{out})
+		if err != nil {
+			return nil, err
+		}
+
+		var decoded struct {
+			Stale []struct {
+				ID     int    `json:"id"`
+				Reason string `json:"reason"`
+			} `json:"stale"`
+		}
+		if err := decodeJSONAnswer(answer, &decoded); err != nil {
+			return nil, err
+		}
+		for _, s := range decoded.Stale {
+			if s.ID < 0 || s.ID >= len(batch) {
+				continue
+			}
+			f := batch[s.ID]
+			f.Problem, f.Reason, f.Line = DocStale, strings.TrimSpace(s.Reason), f.decl.DocStart
+			stale = append(stale, f)
+		}
+	}
+	return stale, nil
+}
+
+// WriteDocs writes doc comments for the findings of an audit and returns them as a patch, leaving the files
+// untouched. Package comments that are missing go into a new doc.go.
+func (a *Agent) WriteDocs(ctx context.Context, opts DocOptions, out Stream) (string, error) {
+	if out == nil {
+		out = discardStream{}
+	}
+
+	findings, err := a.AuditDocs(ctx, opts, out)
+	if err != nil {
+		return "", err
+	}
+	if len(findings) == 0 {
+		return "", nil
+	}
+
+	edits := make(map[string][]lineEdit)
+	for _, batch := range docBatches(findings) {
+		out.Status(fmt.Sprintf("writing %d doc comments", len(batch)))
+		docs, err := a.writeDocBatch(ctx, batch, out)
+		if err != nil {
+			return "", err
+		}
+
+		for i, f := range batch {
+			doc, ok := docs[i]
+			if !ok {
+				continue
+			}
+
+			want := "Package " + f.file.Package
+			if f.decl != nil {
+				want = f.decl.Name
+			}
+			if !startsWithName(doc, want) {
+				out.Status(fmt.Sprintf("skipping the comment for %s, it doesn't start with %s", f.Symbol, want))
+				continue
+			}
+
+			path, edit := docEdit(f, doc)
+			edits[path] = append(edits[path], edit)
+		}
+	}
+
+	var patch strings.Builder
+	paths := make([]string, 0, len(edits))
+	for path := range edits {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		old, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read %s: %w", a.cfg.Workspace.Display(path), err)
+		}
+
+		rel, err := a.cfg.Workspace.Rel(path)
+		if err != nil {
+			return "", err
+		}
+		oldPath := rel
+		if old == nil {
+			oldPath = ""
+		}
+		updated := applyLineEdits(old, edits[path])
+		if formatted, err := format.Source(updated); err == nil {
+			updated = formatted
+		}
+		patch.WriteString(gitdiff.Compare(oldPath, rel, old, updated).String())
+	}
+
+	return patch.String(), nil
+}
+
+// writeDocBatch asks the model for the doc comments of a batch of findings, by their index in the batch
+func (a *Agent) writeDocBatch(ctx context.Context, batch []DocFinding, out Stream) (map[int]string, error) {
+	var sb strings.Builder
+	for i, f := range batch {
+		sb.WriteString(fmt.Sprintf("## %d: %s (%s:%d), %s: %s\n\n", i, f.Symbol, f.Path, f.Line, f.Problem, f.Reason))
+		if f.decl == nil {
+			sb.WriteString("Exported declarations of the package:\n\n```go\n" + packageSummary(f.file) + "```\n\n")
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("```go\n%s%s\n```\n\n", comment(f.decl.Doc, ""), declCode(f.decl)))
+	}
+
+	prompt := fmt.Sprintf(`
+# Declarations
+
+%s
+
+Write doc comments for the declarations above, following the Go doc conventions:
+- A comment is complete sentences and starts with the declared name, like "Open opens ..." or "Reader is ...".
+  Methods start with the method name only.
+- A package comment starts with "Package <name>" and says what the package provides.
+- Say what callers need to know: what it does, what it returns, when it fails. Skip implementation details.
+- Keep it short, most comments are one or two sentences. Keep what's still accurate from existing comments.
+- Use [Name] to link to other declarations, don't use markdown.
+
+Respond with JSON only, without code fences or prose around it, in exactly this format:
+{"docs": [{"id": 0, "doc": "the comment text without // markers, lines separated by \n"}]}
+`, sb.String())
+
+	answer, err := a.promptAI(ctx, session.New(), prompt, statusStream{out})
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded struct {
+		Docs []struct {
+			ID  int    `json:"id"`
+			Doc string `json:"doc"`
+		} `json:"docs"`
+	}
+	if err := decodeJSONAnswer(answer, &decoded); err != nil {
+		return nil, err
+	}
+
+	docs := make(map[int]string, len(decoded.Docs))
+	for _, d := range decoded.Docs {
+		if d.ID >= 0 && d.ID < len(batch) && strings.TrimSpace(d.Doc) != "" {
+			docs[d.ID] = strings.TrimSpace(d.Doc)
+		}
+	}
+	return docs, nil
+}
+
+// docEdit returns the file and the edit that puts doc above a finding's declaration
+func docEdit(f DocFinding, doc string) (string, lineEdit) {
+	if f.decl != nil {
+		edit := lineEdit{start: f.decl.Line, end: f.decl.Line - 1, lines: commentLines(doc, f.decl.Indent)}
+		if f.decl.DocStart > 0 {
+			edit.start, edit.end = f.decl.DocStart, f.decl.DocEnd
+		}
+		return f.file.Path, edit
+	}
+
+	if f.Problem == DocMismatched || f.Problem == DocStale {
+		return f.file.Path, lineEdit{start: f.file.PackageDocStart, end: f.file.PackageDocEnd, lines: commentLines(doc, "")}
+	}
+
+	// missing package comments get a doc.go, or go above the package clause of an existing one
+	path := filepath.Join(filepath.Dir(f.file.Path), "doc.go")
+	if docs, err := golang.ParseDocs(path); err == nil {
+		return path, lineEdit{start: docs.PackageLine, end: docs.PackageLine - 1, lines: commentLines(doc, "")}
+	}
+	return path, lineEdit{start: 1, end: 0, lines: append(commentLines(doc, ""), "package "+f.file.Package)}
+}
+
+// commentLines formats text as // comment lines
+func commentLines(text, indent string) []string {
+	var lines []string
+	for _, l := range strings.Split(strings.TrimSpace(text), "\n") {
+		l = strings.TrimRight(strings.TrimPrefix(strings.TrimSpace(l), "//"), " \t")
+		if l == "" {
+			lines = append(lines, indent+"//")
+			continue
+		}
+		lines = append(lines, indent+"// "+strings.TrimPrefix(l, " "))
+	}
+	return lines
+}
+
+// comment formats an existing doc comment to be shown with its declaration
+func comment(doc, indent string) string {
+	if doc == "" {
+		return ""
+	}
+	return strings.Join(commentLines(doc, indent), "\n") + "\n"
+}
+
+// declCode is the code of a declaration, long bodies are cut off
+func declCode(decl *golang.DocDecl) string {
+	if len(decl.Content) <= maxDocDecl {
+		return decl.Content
+	}
+	return decl.Content[:maxDocDecl] + "\n\t// ..."
+}
+
+// packageSummary lists the signatures of a package's exported declarations in a file, for package comments
+func packageSummary(f *golang.FileDocs) string {
+	var sb strings.Builder
+	for _, decl := range f.Decls {
+		if sb.Len()+len(decl.Signature) > maxDocDecl {
+			break
+		}
+		sb.WriteString(decl.Signature + "\n")
+	}
+	return sb.String()
+}
+
+// docBatches splits findings into batches of at most maxDocBatch bytes of code
+func docBatches(findings []DocFinding) [][]DocFinding {
+	var (
+		batches [][]DocFinding
+		batch   []DocFinding
+		size    int
+	)
+	for _, f := range findings {
+		n := maxDocDecl
+		if f.decl != nil {
+			n = len(declCode(f.decl)) + len(f.decl.Doc)
+		}
+		if len(batch) > 0 && size+n > maxDocBatch {
+			batches, batch, size = append(batches, batch), nil, 0
+		}
+		batch, size = append(batch, f), size+n
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
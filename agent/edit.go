@@ -0,0 +1,418 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/gitdiff"
+	"github.com/sajuno/goon/language/lsp"
+	"github.com/sajuno/goon/openai/tools/functions"
+	"github.com/sajuno/goon/session"
+	"go/format"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultEditAttempts is how often edits that don't apply or build are handed back to the model
+const DefaultEditAttempts = 3
+
+// Edit replaces a range of lines of a file
+type Edit struct {
+	// Path is relative to the repository root
+	Path string `json:"path"`
+
+	// StartLine and EndLine are 1-based and inclusive, EndLine is StartLine-1 to insert before StartLine.
+	// New files are created with StartLine 1 and EndLine 0.
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	NewText   string `json:"new_text"`
+}
+
+// ChangeSet is a set of edits that applies cleanly, is gofmt'ed and builds
+type ChangeSet struct {
+	Summary string
+	Edits   []Edit
+
+	// Patch is the unified diff of the changes
+	Patch string
+
+	files []fileChange
+}
+
+type fileChange struct {
+	path     string
+	old, new []byte
+	created  bool
+}
+
+// Paths returns the changed files relative to the repository root
+func (c *ChangeSet) Paths() []string {
+	paths := make([]string, 0, len(c.files))
+	for _, f := range c.files {
+		paths = append(paths, f.path)
+	}
+	return paths
+}
+
+// editError is a problem with proposed edits the model can fix
+type editError struct {
+	msg string
+}
+
+func (e *editError) Error() string {
+	return e.msg
+}
+
+func editErrorf(format string, args ...any) error {
+	return &editError{msg: fmt.Sprintf(format, args...)}
+}
+
+// ProposeEdit asks the model for edits that carry out an instruction. The edits are validated to apply cleanly,
+// gofmt'ed and built without touching the workspace, problems are handed back to the model up to attempts times.
+// The result is applied with ApplyChanges.
+func (a *Agent) ProposeEdit(ctx context.Context, sess *session.Session, instruction string, attempts int, out Stream) (*ChangeSet, error) {
+	if out == nil {
+		out = discardStream{}
+	}
+	if attempts <= 0 {
+		attempts = DefaultEditAttempts
+	}
+
+	prompt := fmt.Sprintf(`
+The user wants you to change the code base: "%s"
+
+Use your tools to find and read the code involved before changing it, read_file shows the current line numbers.
+Change only what the instruction needs, keep the style of the surrounding code and keep every file compiling.
+
+Respond with JSON only, without code fences or prose around it, in exactly this format:
+{"summary": "what the change does in a sentence or two", "edits": [{"path": "dir/file.go", "start_line": 10, "end_line": 12, "new_text": "replacement lines\n"}]}
+
+An edit replaces the lines start_line to end_line, both 1-based and inclusive, with new_text. Use end_line
+start_line-1 to insert before start_line and an empty new_text to delete lines. Line numbers refer to the files
+as they are now, not as they are after earlier edits. Edits of a file must not overlap.
+Create a file with start_line 1 and end_line 0.
+`, instruction)
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		out.Status(fmt.Sprintf("planning edits, attempt %d of %d", attempt, attempts))
+		answer, err := a.promptAI(ctx, sess, prompt, statusStream{out})
+		if err != nil {
+			return nil, err
+		}
+
+		changes, err := a.prepareChanges(ctx, answer, out)
+		var editErr *editError
+		if errors.As(err, &editErr) {
+			out.Status(editErr.Error())
+			prompt = fmt.Sprintf("The edits can't be applied: %s\n\nRead the files again if needed and respond with "+
+				"the complete set of corrected edits, as JSON in the same format.", editErr)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sess.AddTurn(instruction, changes.Summary)
+		return changes, nil
+	}
+
+	return nil, fmt.Errorf("no applicable edits after %d attempts", attempts)
+}
+
+// prepareChanges decodes, applies and builds the edits of an answer in memory
+func (a *Agent) prepareChanges(ctx context.Context, answer string, out Stream) (*ChangeSet, error) {
+	var decoded struct {
+		Summary string `json:"summary"`
+		Edits   []Edit `json:"edits"`
+	}
+	if err := decodeJSONAnswer(answer, &decoded); err != nil {
+		return nil, editErrorf("%v", err)
+	}
+	if len(decoded.Edits) == 0 {
+		return nil, editErrorf("there are no edits")
+	}
+
+	byPath := make(map[string][]Edit)
+	for _, e := range decoded.Edits {
+		path, err := a.cfg.Workspace.Abs(e.Path)
+		if err != nil {
+			return nil, editErrorf("%v", err)
+		}
+		byPath[path] = append(byPath[path], e)
+	}
+
+	var files []fileChange
+	for path, edits := range byPath {
+		change, err := a.applyEdits(path, edits)
+		if err != nil {
+			return nil, err
+		}
+		if change != nil {
+			files = append(files, *change)
+		}
+	}
+	if len(files) == 0 {
+		return nil, editErrorf("the edits don't change anything")
+	}
+
+	out.Status("building the changes")
+	if err := a.buildChanges(ctx, files); err != nil {
+		return nil, err
+	}
+
+	return newChangeSet(strings.TrimSpace(decoded.Summary), decoded.Edits, files), nil
+}
+
+// newChangeSet sorts the changed files and diffs them
+func newChangeSet(summary string, edits []Edit, files []fileChange) *ChangeSet {
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+
+	var patch strings.Builder
+	for _, f := range files {
+		oldPath := f.path
+		if f.created {
+			oldPath = ""
+		}
+		patch.WriteString(gitdiff.Compare(oldPath, f.path, f.old, f.new).String())
+	}
+
+	return &ChangeSet{Summary: summary, Edits: edits, Patch: patch.String(), files: files}
+}
+
+// applyEdits applies the edits of a single file in memory, nil is returned if the result doesn't differ
+func (a *Agent) applyEdits(path string, edits []Edit) (*fileChange, error) {
+	rel, err := a.cfg.Workspace.Rel(path)
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := os.ReadFile(path)
+	created := errors.Is(err, os.ErrNotExist)
+	if err != nil && !created {
+		return nil, fmt.Errorf("failed to read %s: %w", rel, err)
+	}
+	if created && (len(edits) != 1 || edits[0].StartLine != 1 || edits[0].EndLine != 0) {
+		return nil, editErrorf("%s doesn't exist, create it with a single edit from start_line 1 to end_line 0", rel)
+	}
+
+	var lines int
+	if len(old) > 0 {
+		lines = strings.Count(strings.TrimSuffix(string(old), "\n"), "\n") + 1
+	}
+
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].StartLine < edits[j].StartLine })
+
+	lineEdits := make([]lineEdit, 0, len(edits))
+	for i, e := range edits {
+		if e.StartLine < 1 || e.StartLine > lines+1 || e.EndLine < e.StartLine-1 || e.EndLine > lines {
+			return nil, editErrorf("%s:%d-%d is outside of the file's %d lines", rel, e.StartLine, e.EndLine, lines)
+		}
+		// two edits at the same line overlap as well, their order would be ambiguous
+		if prev := edits[max(i-1, 0)]; i > 0 && (prev.EndLine >= e.StartLine || prev.StartLine == e.StartLine) {
+			return nil, editErrorf("%s: the edits of lines %d-%d and %d-%d overlap", rel, prev.StartLine, prev.EndLine, e.StartLine, e.EndLine)
+		}
+
+		var newLines []string
+		if e.NewText != "" {
+			newLines = strings.Split(strings.TrimSuffix(e.NewText, "\n"), "\n")
+		}
+		lineEdits = append(lineEdits, lineEdit{start: e.StartLine, end: e.EndLine, lines: newLines})
+	}
+
+	updated := applyLineEdits(old, lineEdits)
+	if filepath.Ext(path) == ".go" {
+		formatted, err := format.Source(updated)
+		if err != nil {
+			return nil, editErrorf("%s doesn't parse after the edits: %v", rel, err)
+		}
+		updated = formatted
+	}
+
+	if string(updated) == string(old) {
+		return nil, nil
+	}
+	return &fileChange{path: rel, old: old, new: updated, created: created}, nil
+}
+
+// buildChanges builds the workspace with the changes overlaid on it, packages importing a changed package have to
+// build as well. Packages with changed tests are vetted too, go build skips test files.
+func (a *Agent) buildChanges(ctx context.Context, files []fileChange) error {
+	overlay, err := a.newGoOverlay(files)
+	if err != nil {
+		return err
+	}
+	defer overlay.close()
+	if len(overlay.replaced) == 0 {
+		return nil
+	}
+
+	var vetted []string
+	seen := make(map[string]bool)
+	for _, f := range files {
+		pkg := goPackageOf(f.path)
+		if strings.HasSuffix(f.path, "_test.go") && !seen[pkg] {
+			seen[pkg] = true
+			vetted = append(vetted, pkg)
+		}
+	}
+
+	commands := [][]string{{"build", "-overlay=" + overlay.path, "-o", os.DevNull, "./..."}}
+	if len(vetted) > 0 {
+		commands = append(commands, append([]string{"vet", "-overlay=" + overlay.path}, vetted...))
+	}
+	for _, args := range commands {
+		run, err := a.execGo(ctx, args...)
+		if err != nil {
+			return err
+		}
+		if run.exitCode == 0 {
+			continue
+		}
+
+		if run.timedOut {
+			return fmt.Errorf("go %s timed out", args[0])
+		}
+		result := a.goCommandOutput(run, run.stdout, run.stderr)
+		result.Command = "go " + args[0]
+		overlay.mapPaths(&result)
+		feedback, _ := json.Marshal(result)
+		return editErrorf("go %s fails after the edits: %s", args[0], feedback)
+	}
+	return nil
+}
+
+// goOverlay replaces and adds files of the workspace for go's -overlay flag, without touching the workspace itself
+type goOverlay struct {
+	dir string
+
+	// path is the overlay's JSON file
+	path string
+
+	// replaced maps the temporary files to the paths relative to the root they stand in for,
+	// go reports problems in the temporary files
+	replaced map[string]string
+}
+
+// newGoOverlay writes the new versions of the changed Go files to a temporary directory, close removes them
+func (a *Agent) newGoOverlay(files []fileChange) (*goOverlay, error) {
+	dir, err := os.MkdirTemp("", "goon-overlay-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create overlay directory: %w", err)
+	}
+	o := &goOverlay{dir: dir, path: filepath.Join(dir, "overlay.json"), replaced: make(map[string]string)}
+
+	overlay := struct {
+		Replace map[string]string
+	}{Replace: make(map[string]string)}
+	for i, f := range files {
+		if filepath.Ext(f.path) != ".go" {
+			continue
+		}
+
+		replacement := filepath.Join(dir, fmt.Sprintf("%d.go", i))
+		if err := os.WriteFile(replacement, f.new, 0o600); err != nil {
+			o.close()
+			return nil, fmt.Errorf("failed to write overlay: %w", err)
+		}
+		overlay.Replace[filepath.Join(a.cfg.Workspace.Root(), f.path)] = replacement
+		o.replaced[replacement] = f.path
+	}
+
+	b, err := json.Marshal(overlay)
+	if err == nil {
+		err = os.WriteFile(o.path, b, 0o600)
+	}
+	if err != nil {
+		o.close()
+		return nil, fmt.Errorf("failed to write overlay: %w", err)
+	}
+	return o, nil
+}
+
+// mapPaths rewrites the temporary files in the problems and output of a go command to the paths they stand in for
+func (o *goOverlay) mapPaths(result *functions.GoCommandOutput) {
+	for i, p := range result.Problems {
+		if path, ok := o.replaced[p.Path]; ok {
+			result.Problems[i].Path = path
+		}
+	}
+	for replacement, path := range o.replaced {
+		result.Output = strings.ReplaceAll(result.Output, replacement, path)
+	}
+}
+
+func (o *goOverlay) close() {
+	os.RemoveAll(o.dir)
+}
+
+// goPackageOf returns the package pattern of a file relative to the root, like ./rag
+func goPackageOf(path string) string {
+	if filepath.Dir(path) == "." {
+		return "."
+	}
+	return "./" + filepath.ToSlash(filepath.Dir(path))
+}
+
+// ApplyChanges writes a change set to the workspace and re-indexes the changed Go files. It fails without writing
+// anything if one of the files changed since the edits were proposed.
+func (a *Agent) ApplyChanges(ctx context.Context, changes *ChangeSet) error {
+	for _, f := range changes.files {
+		current, err := os.ReadFile(filepath.Join(a.cfg.Workspace.Root(), f.path))
+		if err != nil && !(f.created && errors.Is(err, os.ErrNotExist)) {
+			return fmt.Errorf("failed to read %s: %w", f.path, err)
+		}
+		if string(current) != string(f.old) || (f.created && err == nil) {
+			return fmt.Errorf("%s changed since the edits were proposed", f.path)
+		}
+	}
+
+	for _, f := range changes.files {
+		path := filepath.Join(a.cfg.Workspace.Root(), f.path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("failed to create directory of %s: %w", f.path, err)
+		}
+		if err := os.WriteFile(path, f.new, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.path, err)
+		}
+
+		// keep gopls in sync with files it has open, it picks up the others from disk
+		if filepath.Ext(path) == ".go" {
+			if err := a.lsp.DidOpen(lsp.FileURI(path), "go", string(f.new), 1); err != nil {
+				return fmt.Errorf("failed to update %s in gopls: %w", f.path, err)
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(changes.files))
+	for _, f := range changes.files {
+		paths = append(paths, filepath.Join(a.cfg.Workspace.Root(), f.path))
+	}
+	if err := a.reindexFiles(ctx, paths); err != nil {
+		return fmt.Errorf("the changes were applied, but re-indexing them failed: %w", err)
+	}
+	return nil
+}
+
+// lineEdit replaces the lines start to end of a file, both 1-based and inclusive. end is start-1 for insertions.
+type lineEdit struct {
+	start, end int
+	lines      []string
+}
+
+// applyLineEdits applies non-overlapping edits, bottom up so line numbers stay valid
+func applyLineEdits(src []byte, edits []lineEdit) []byte {
+	var lines []string
+	if len(src) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(src), "\n"), "\n")
+	}
+
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, e := range edits {
+		start, end := min(e.start-1, len(lines)), min(e.end, len(lines))
+		lines = append(lines[:start], append(append([]string(nil), e.lines...), lines[max(end, start):]...)...)
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/sajuno/goon/rag"
+	"github.com/sashabaranov/go-openai"
+)
+
+// fallbackEncoding is used for embedding models tiktoken doesn't know about
+const fallbackEncoding = "cl100k_base"
+
+func (a *Agent) tokenizer() (*tiktoken.Tiktoken, error) {
+	if a.cfg.Embedding.Encoding != "" {
+		return tiktoken.GetEncoding(a.cfg.Embedding.Encoding)
+	}
+
+	enc, err := tiktoken.EncodingForModel(string(a.cfg.Embedding.Model))
+	if err != nil {
+		return tiktoken.GetEncoding(fallbackEncoding)
+	}
+	return enc, nil
+}
+
+func (a *Agent) embed(ctx context.Context, inputs []string) ([]openai.Embedding, error) {
+	resp, err := a.openai.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input:      inputs,
+		Model:      a.cfg.Embedding.Model,
+		Dimensions: a.cfg.Embedding.Dimensions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Data, nil
+}
+
+// embedQuery embeds a single query and verifies it's comparable with the latest index snapshot
+func (a *Agent) embedQuery(ctx context.Context, query string) (rag.Snapshot, []float32, error) {
+	snapshot, err := a.Snapshot(ctx)
+	if err != nil {
+		return rag.Snapshot{}, nil, err
+	}
+
+	if err := snapshot.Compatible(string(a.cfg.Embedding.Model), a.cfg.Embedding.Dimensions); err != nil {
+		return rag.Snapshot{}, nil, err
+	}
+
+	data, err := a.embed(ctx, []string{query})
+	if err != nil {
+		return rag.Snapshot{}, nil, fmt.Errorf("failed to create embeddings for user query: %w", err)
+	}
+	vec := data[0].Embedding
+
+	if len(vec) != snapshot.Dimensions {
+		return rag.Snapshot{}, nil, &rag.EmbeddingMismatchError{
+			Snapshot:   snapshot,
+			Model:      string(a.cfg.Embedding.Model),
+			Dimensions: len(vec),
+		}
+	}
+
+	return snapshot, vec, nil
+}
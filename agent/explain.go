@@ -4,31 +4,67 @@ import (
 	"context"
 	"fmt"
 	"github.com/sajuno/goon/rag"
-	"github.com/sashabaranov/go-openai"
+	"github.com/sajuno/goon/session"
+	"strings"
 )
 
-func (a *Agent) Explain(ctx context.Context, query string) (string, error) {
-	resp, err := a.openai.CreateEmbeddings(ctx, openai.EmbeddingRequest{
-		Input: query,
-		Model: openai.SmallEmbedding3,
-	})
+// followUpQueries is the amount of earlier questions taken into account when retrieving context for a follow-up
+const followUpQueries = 3
+
+// ContextBudget is the amount of tokens of code Explain puts in front of the model, pinned code included
+const ContextBudget = 25000
+
+// Scope narrows down the code Explain retrieves and adds code it always includes
+type Scope struct {
+	// Package restricts retrieval to a package, matched like rag.SearchOptions.Package
+	Package string
+
+	// Pins come ahead of the retrieved code
+	Pins []Pin
+}
+
+// Explain answers a question about the indexed code base, the answer is streamed to out as it's generated.
+// Questions asked in the same session are follow-ups,
+// they share a thread with the earlier questions and their context retrieval takes those into account.
+func (a *Agent) Explain(ctx context.Context, sess *session.Session, query string, out Stream) (string, error) {
+	return a.ExplainScoped(ctx, sess, query, Scope{}, out)
+}
+
+// ExplainScoped answers like Explain, from the code of a scope
+func (a *Agent) ExplainScoped(ctx context.Context, sess *session.Session, query string, scope Scope, out Stream) (string, error) {
+	if out == nil {
+		out = discardStream{}
+	}
+
+	pins, err := a.PinnedChunks(ctx, scope.Pins)
+	if err != nil {
+		return "", err
+	}
+
+	out.Status("searching the index")
+	snapshot, vec, err := a.embedQuery(ctx, retrievalQuery(sess, query))
 	if err != nil {
-		return "", fmt.Errorf("failed to create embeddings for user query: %w", err)
+		return "", err
 	}
-	vec := resp.Data[0].Embedding
 
-	simChunks, err := a.ragStore.FindSimilarChunks(ctx, vec)
+	simChunks, err := a.ragStore.FindSimilarChunks(ctx, snapshot.ID, vec, rag.SearchOptions{Package: scope.Package})
 	if err != nil {
 		return "", fmt.Errorf("failed to find similar chunks: %w", err)
 	}
 
-	chunks := make([]rag.Chunk, 0, len(simChunks))
+	chunks := make([]rag.Chunk, 0, len(pins)+len(simChunks))
+	chunks = append(chunks, pins...)
 	for _, chunk := range simChunks {
-		chunks = append(chunks, chunk.Chunk)
+		if !pinned(chunk.Chunk.Chunk, pins) {
+			chunks = append(chunks, chunk.Chunk)
+		}
 	}
 
-	promptContext := buildPromptContext(chunks, 25000)
-	prompt := fmt.Sprintf(`
+	promptContext := buildPromptContext(a.cfg.Workspace, chunks, ContextBudget)
+
+	var prompt string
+	if len(sess.Turns) == 0 {
+		prompt = fmt.Sprintf(`
 %s
 
 The user asked for an explanation about a codebase using the following query: "%s"
@@ -39,11 +75,35 @@ Summarize the relevant behavior and responsibilities of the shown functions, typ
 Focus on functionality, structure, and intent, not low-level implementation details.
 Be concise, accurate, and if you can an asshole about it, please do so.
 `, promptContext, query)
+	} else {
+		prompt = fmt.Sprintf(`
+%s
+
+The user asked a follow-up question about the same codebase: "%s"
+
+Answer it in light of the earlier questions and your earlier answers in this conversation.
+The code context above was retrieved for this follow-up and may overlap with earlier context.
+Be concise, accurate, and if you can an asshole about it, please do so.
+`, promptContext, query)
+	}
 
-	response, err := a.promptAI(ctx, prompt)
+	response, err := a.promptAI(ctx, sess, prompt, out)
 	if err != nil {
 		return "", fmt.Errorf("LLM prompt failed: %w", err)
 	}
 
+	sess.AddTurn(query, response)
+
 	return response, nil
 }
+
+// retrievalQuery combines the question with earlier questions of the session.
+// Follow-ups like "and where is that called from?" are meaningless to embed on their own.
+func retrievalQuery(sess *session.Session, query string) string {
+	earlier := sess.RecentQueries(followUpQueries)
+	if len(earlier) == 0 {
+		return query
+	}
+
+	return fmt.Sprintf("%s\n%s", strings.Join(earlier, "\n"), query)
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"github.com/sajuno/goon/openai/tools/functions"
+	"github.com/sajuno/goon/session"
+)
+
+// ExternalTools declares the tools goon offers other agents, like MCP clients: the index, the language server and
+// explain. Apart from explain they answer without a model, so other agents can use the index in their own loop.
+func (a *Agent) ExternalTools() *functions.Registry {
+	return functions.MustNewRegistry(
+		functions.NewTool("search_code",
+			"Semantic search over goon's index of the Go code base, returns the best matching declarations with their paths and line ranges",
+			a.searchCode,
+			functions.SearchCodeInput{Query: "where requests are authenticated", Package: "pkg", Kinds: []string{"func", "method"}, Limit: 5},
+		),
+		functions.NewTool("lookup_symbol",
+			"Look up the declaration of a function, method or type by name in the index, returns its current source and documentation",
+			a.lookupSymbol,
+			functions.LookupSymbolInput{Symbol: "pkg.Type.Method"},
+		),
+		functions.NewTool("go_to_definition",
+			"Find the definition of a symbol at a given position with gopls (LSP's textDocument/definition)",
+			a.goToDefinition,
+			functions.GoToDefinitionInput{URI: "pkg/file.go", Line: 20, Character: 12},
+		),
+		functions.NewTool("find_references",
+			"Find all references to a symbol at a given position with gopls (LSP's textDocument/references)",
+			a.findReferences,
+			functions.FindReferencesInput{URI: "pkg/file.go", Line: 17, Character: 1},
+		),
+		functions.NewTool("explain",
+			"Have goon answer a question about the code base. It searches the index and uses the language server itself, which takes a while",
+			a.explainTool,
+			functions.ExplainInput{Query: "How are requests authenticated?"},
+		),
+	)
+}
+
+func (a *Agent) lookupSymbol(ctx context.Context, in functions.LookupSymbolInput) (functions.LookupSymbolOutput, error) {
+	sym, err := ParseSymbol(in.Symbol)
+	if err != nil {
+		return functions.LookupSymbolOutput{}, err
+	}
+
+	chunk, err := a.findSymbol(ctx, sym)
+	if err != nil {
+		return functions.LookupSymbolOutput{}, err
+	}
+
+	return functions.LookupSymbolOutput{
+		Name:      chunk.Name,
+		Kind:      chunk.Kind.String(),
+		Package:   chunk.Package,
+		Path:      a.cfg.Workspace.Display(chunk.FilePath),
+		StartLine: chunk.StartLine,
+		EndLine:   chunk.EndLine,
+		Doc:       chunk.Doc,
+		Content:   chunk.Content,
+	}, nil
+}
+
+// explainTool answers every question in a session of its own, callers keep their own conversation
+func (a *Agent) explainTool(ctx context.Context, in functions.ExplainInput) (functions.ExplainOutput, error) {
+	answer, err := a.Explain(ctx, session.New(), in.Query, nil)
+	return functions.ExplainOutput{Answer: answer}, err
+}
@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/language/lsp"
+	"github.com/sajuno/goon/openai/tools/functions"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// maxReadBytes caps the content returned by a single read_file call
+	maxReadBytes = 64 * 1024
+
+	// maxReadFileSize refuses files read_file would have to load in full that are too large to be source code
+	maxReadFileSize = 4 << 20
+
+	// maxDirEntries caps list_directory results
+	maxDirEntries = 500
+
+	// maxGrepMatches caps grep results
+	maxGrepMatches = 100
+
+	// maxGrepFileSize skips files that are too large to be source code
+	maxGrepFileSize = 1 << 20
+)
+
+// readFile reads (a line range of) a file. Go files are opened in the language server as well,
+// so LSP tools work on them right away.
+func (a *Agent) readFile(_ context.Context, in functions.ReadFileInput) (functions.ReadFileOutput, error) {
+	path, err := a.cfg.Workspace.Abs(in.Path)
+	if err != nil {
+		return functions.ReadFileOutput{}, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return functions.ReadFileOutput{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return functions.ReadFileOutput{}, fmt.Errorf("%s is not a regular file", in.Path)
+	}
+	if info.Size() > maxReadFileSize {
+		return functions.ReadFileOutput{}, fmt.Errorf("%s is %d bytes, files over %d bytes are too large to read, use grep instead",
+			in.Path, info.Size(), maxReadFileSize)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return functions.ReadFileOutput{}, err
+	}
+
+	if filepath.Ext(path) == ".go" {
+		if err := a.lsp.DidOpen(lsp.FileURI(path), "go", string(b), 1); err != nil {
+			return functions.ReadFileOutput{}, fmt.Errorf("failed to open file in gopls: %w", err)
+		}
+	}
+
+	lines := strings.Split(string(b), "\n")
+	start, end := max(in.StartLine, 1), in.EndLine
+	if end <= 0 || end > len(lines) {
+		end = len(lines)
+	}
+	if start > end {
+		return functions.ReadFileOutput{}, fmt.Errorf("line range %d-%d is outside of the file's %d lines", in.StartLine, in.EndLine, len(lines))
+	}
+
+	out := functions.ReadFileOutput{
+		Path:       a.cfg.Workspace.Display(path),
+		StartLine:  start,
+		TotalLines: len(lines),
+	}
+
+	var sb strings.Builder
+	for i := start; i <= end; i++ {
+		line := fmt.Sprintf("%5d\t%s\n", i, lines[i-1])
+		if sb.Len()+len(line) > maxReadBytes {
+			out.Truncated = true
+			break
+		}
+		sb.WriteString(line)
+		out.EndLine = i
+	}
+	out.Content = sb.String()
+
+	return out, nil
+}
+
+func (a *Agent) listDirectory(_ context.Context, in functions.ListDirectoryInput) (functions.ListDirectoryOutput, error) {
+	dir, err := a.cfg.Workspace.Abs(in.Path)
+	if err != nil {
+		return functions.ListDirectoryOutput{}, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return functions.ListDirectoryOutput{}, err
+	}
+
+	out := functions.ListDirectoryOutput{Path: a.cfg.Workspace.Display(dir)}
+	for _, e := range entries {
+		if a.cfg.Workspace.Ignored(path.Join(out.Path, e.Name()), e.IsDir()) {
+			continue
+		}
+		if len(out.Entries) == maxDirEntries {
+			out.Truncated = true
+			break
+		}
+
+		entry := functions.DirectoryEntry{Name: e.Name(), IsDir: e.IsDir()}
+		if info, err := e.Info(); err == nil && !e.IsDir() {
+			entry.Size = info.Size()
+		}
+		out.Entries = append(out.Entries, entry)
+	}
+
+	return out, nil
+}
+
+// grep searches text files in the workspace, skipping ignored, hidden and vendored paths
+func (a *Agent) grep(ctx context.Context, in functions.GrepInput) (functions.GrepOutput, error) {
+	re, err := regexp.Compile(in.Pattern)
+	if err != nil {
+		return functions.GrepOutput{}, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	dir, err := a.cfg.Workspace.Abs(in.Path)
+	if err != nil {
+		return functions.GrepOutput{}, err
+	}
+
+	out := functions.GrepOutput{}
+	errDone := errors.New("done")
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		rel := a.cfg.Workspace.Display(path)
+		if d.IsDir() {
+			if path != dir && (d.Name() == "vendor" || strings.HasPrefix(d.Name(), ".") || a.cfg.Workspace.Ignored(rel, true)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// symlinks could point outside of the workspace, read_file resolves them, grep skips them
+		if d.Type()&fs.ModeSymlink != 0 || a.cfg.Workspace.Ignored(rel, false) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || info.Size() > maxGrepFileSize {
+			return nil
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil || bytes.IndexByte(b, 0) >= 0 {
+			// unreadable or binary
+			return nil
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		scanner.Buffer(make([]byte, 0, 64*1024), maxGrepFileSize)
+		for line := 1; scanner.Scan(); line++ {
+			if !re.Match(scanner.Bytes()) {
+				continue
+			}
+			if len(out.Matches) == maxGrepMatches {
+				out.Truncated = true
+				return errDone
+			}
+			out.Matches = append(out.Matches, functions.GrepMatch{
+				Path: rel,
+				Line: line,
+				Text: strings.TrimSpace(scanner.Text()),
+			})
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDone) {
+		return functions.GrepOutput{}, err
+	}
+
+	return out, nil
+}
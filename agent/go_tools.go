@@ -0,0 +1,343 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/openai/tools/functions"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxGoOutput caps the unparsed output returned to the model
+	maxGoOutput = 16 * 1024
+
+	// maxTestOutput caps the output of a single failed test
+	maxTestOutput = 4 * 1024
+
+	maxGoProblems    = 100
+	maxFailedTests   = 20
+	defaultGoTimeout = 2 * time.Minute
+)
+
+// goProblem matches "path/file.go:12:5: message" lines of the compiler and vet, vet prefixes some with "vet: "
+var goProblem = regexp.MustCompile(`^(?:vet: )?(\S+\.go):(\d+)(?::(\d+))?: (.+)$`)
+
+// goSymbol is what go doc accepts, anything else could be a flag or worse
+var goSymbol = regexp.MustCompile(`^[\w./]+$`)
+
+func (a *Agent) goBuild(ctx context.Context, in functions.GoPackageInput) (functions.GoCommandOutput, error) {
+	pkg, err := a.goPackage(in.Package)
+	if err != nil {
+		return functions.GoCommandOutput{}, err
+	}
+
+	// -o discards binaries of main packages instead of littering the workspace
+	run, err := a.runGo(ctx, "build", "-o", os.DevNull, pkg)
+	if err != nil {
+		return functions.GoCommandOutput{}, err
+	}
+	return a.goCommandOutput(run, run.stdout, run.stderr), nil
+}
+
+func (a *Agent) goVet(ctx context.Context, in functions.GoPackageInput) (functions.GoCommandOutput, error) {
+	pkg, err := a.goPackage(in.Package)
+	if err != nil {
+		return functions.GoCommandOutput{}, err
+	}
+
+	run, err := a.runGo(ctx, "vet", pkg)
+	if err != nil {
+		return functions.GoCommandOutput{}, err
+	}
+	return a.goCommandOutput(run, run.stdout, run.stderr), nil
+}
+
+func (a *Agent) goTest(ctx context.Context, in functions.GoTestInput) (functions.GoCommandOutput, error) {
+	pkg, err := a.goPackage(in.Package)
+	if err != nil {
+		return functions.GoCommandOutput{}, err
+	}
+
+	args := []string{"test", "-json", "-count=1"}
+	if in.Run != "" {
+		if _, err := regexp.Compile(in.Run); err != nil {
+			return functions.GoCommandOutput{}, fmt.Errorf("invalid run pattern: %w", err)
+		}
+		args = append(args, "-run="+in.Run)
+	}
+
+	run, err := a.runGo(ctx, append(args, pkg)...)
+	if err != nil {
+		return functions.GoCommandOutput{}, err
+	}
+
+	tests, rest := parseTestEvents(run.stdout)
+	out := a.goCommandOutput(run, rest, run.stderr)
+	out.FailedTests, out.PassedTests = tests.failed, tests.passed
+	if len(out.FailedTests) > maxFailedTests {
+		out.FailedTests, out.Truncated = out.FailedTests[:maxFailedTests], true
+	}
+	return out, nil
+}
+
+func (a *Agent) goDoc(ctx context.Context, in functions.GoDocInput) (functions.GoCommandOutput, error) {
+	if !goSymbol.MatchString(in.Symbol) || strings.Contains(in.Symbol, "..") || strings.HasPrefix(in.Symbol, "/") {
+		return functions.GoCommandOutput{}, fmt.Errorf("invalid symbol %q, use a package or package.Symbol", in.Symbol)
+	}
+
+	run, err := a.runGo(ctx, "doc", in.Symbol)
+	if err != nil {
+		return functions.GoCommandOutput{}, err
+	}
+
+	out := functions.GoCommandOutput{
+		Command:  run.command,
+		Success:  run.exitCode == 0,
+		ExitCode: run.exitCode,
+		TimedOut: run.timedOut,
+	}
+	out.Output, out.Truncated = truncate(string(run.stdout)+string(run.stderr), maxGoOutput)
+	return out, nil
+}
+
+// goPackage turns a package argument into a pattern relative to the workspace root, e.g. ./rag or ./agent/...
+func (a *Agent) goPackage(pkg string) (string, error) {
+	dir, recursive := strings.CutSuffix(pkg, "/...")
+	if pkg == "..." {
+		dir, recursive = ".", true
+	}
+	if dir == "" {
+		dir = "."
+	}
+
+	abs, err := a.cfg.Workspace.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("package %q must be a directory relative to the repository root, like ./rag or ./...", pkg)
+	}
+
+	rel, err := a.cfg.Workspace.Rel(abs)
+	if err != nil {
+		return "", err
+	}
+
+	pattern := "./" + rel
+	if rel == "." {
+		pattern = "."
+	}
+	if recursive {
+		pattern += "/..."
+	}
+	return pattern, nil
+}
+
+type goRun struct {
+	command        string
+	stdout, stderr []byte
+	exitCode       int
+	timedOut       bool
+}
+
+// runGo runs the go command in the workspace root after the user confirmed it, if there's anyone to confirm
+func (a *Agent) runGo(ctx context.Context, args ...string) (goRun, error) {
+	if a.confirm != nil {
+		command := "go " + strings.Join(args, " ")
+		ok, err := a.confirm(ctx, fmt.Sprintf("Run %s?", command))
+		if err != nil {
+			return goRun{command: command}, err
+		}
+		if !ok {
+			return goRun{command: command}, fmt.Errorf("the user declined to run %s", command)
+		}
+	}
+
+	return a.execGo(ctx, args...)
+}
+
+// execGo runs the go command in the workspace root, for commands goon runs on its own behalf
+func (a *Agent) execGo(ctx context.Context, args ...string) (goRun, error) {
+	run := goRun{command: "go " + strings.Join(args, " ")}
+
+	timeout := a.cfg.GoTools.Timeout
+	if timeout <= 0 {
+		timeout = defaultGoTimeout
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(runCtx, "go", args...)
+	cmd.Dir = a.cfg.Workspace.Root()
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	// test binaries may outlive go itself, don't wait for them forever
+	cmd.WaitDelay = 5 * time.Second
+
+	err := cmd.Run()
+	run.stdout, run.stderr = stdout.Bytes(), stderr.Bytes()
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil:
+		run.timedOut, run.exitCode = true, -1
+	case ctx.Err() != nil:
+		return run, ctx.Err()
+	case errors.As(err, &exitErr):
+		run.exitCode = exitErr.ExitCode()
+	case err != nil:
+		return run, fmt.Errorf("failed to run %s: %w", run.command, err)
+	}
+
+	return run, nil
+}
+
+// goCommandOutput parses compiler and vet problems out of the output, the remaining output is returned as is
+func (a *Agent) goCommandOutput(run goRun, outputs ...[]byte) functions.GoCommandOutput {
+	out := functions.GoCommandOutput{
+		Command:  run.command,
+		Success:  run.exitCode == 0 && !run.timedOut,
+		ExitCode: run.exitCode,
+		TimedOut: run.timedOut,
+	}
+
+	var rest strings.Builder
+	for _, output := range outputs {
+		scanner := bufio.NewScanner(bytes.NewReader(output))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if problem, ok := a.parseGoProblem(line); ok {
+				if len(out.Problems) < maxGoProblems {
+					out.Problems = append(out.Problems, problem)
+				} else {
+					out.Truncated = true
+				}
+				continue
+			}
+			// package headers of build and vet output
+			if strings.HasPrefix(line, "# ") {
+				continue
+			}
+			rest.WriteString(line + "\n")
+		}
+	}
+
+	output, truncated := truncate(rest.String(), maxGoOutput)
+	out.Output, out.Truncated = output, out.Truncated || truncated
+	return out
+}
+
+func (a *Agent) parseGoProblem(line string) (functions.GoProblem, bool) {
+	m := goProblem.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return functions.GoProblem{}, false
+	}
+
+	path := m[1]
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(a.cfg.Workspace.Root(), path)
+	}
+	lineNo, _ := strconv.Atoi(m[2])
+	column, _ := strconv.Atoi(m[3])
+
+	return functions.GoProblem{
+		Path:    a.cfg.Workspace.Display(path),
+		Line:    lineNo,
+		Column:  column,
+		Message: m[4],
+	}, true
+}
+
+// testEvent is a line of go test -json, see go doc test2json
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+}
+
+type testResults struct {
+	failed []functions.FailedTest
+	passed int
+}
+
+// parseTestEvents collects failed tests with their output. Output that isn't part of a test, like build errors,
+// is returned for further parsing.
+func parseTestEvents(stdout []byte) (testResults, []byte) {
+	var (
+		results testResults
+		rest    bytes.Buffer
+		outputs = make(map[string]*strings.Builder)
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(stdout))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var e testEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			rest.Write(scanner.Bytes())
+			rest.WriteByte('\n')
+			continue
+		}
+
+		key := e.Package + " " + e.Test
+		switch e.Action {
+		case "output", "build-output":
+			if e.Test == "" {
+				// package summaries like "ok" and "FAIL" add nothing to the parsed results
+				if e.Action == "build-output" || !isTestSummary(e.Output) {
+					rest.WriteString(e.Output)
+				}
+				continue
+			}
+			if outputs[key] == nil {
+				outputs[key] = &strings.Builder{}
+			}
+			outputs[key].WriteString(e.Output)
+		case "pass":
+			if e.Test != "" {
+				results.passed++
+				delete(outputs, key)
+			}
+		case "fail":
+			if e.Test != "" {
+				var output string
+				if b := outputs[key]; b != nil {
+					output, _ = truncate(b.String(), maxTestOutput)
+				}
+				results.failed = append(results.failed, functions.FailedTest{Package: e.Package, Test: e.Test, Output: output})
+				delete(outputs, key)
+			}
+		}
+	}
+
+	return results, rest.Bytes()
+}
+
+func isTestSummary(output string) bool {
+	for _, prefix := range []string{"ok ", "ok\t", "FAIL", "PASS", "?", "=== RUN", "--- "} {
+		if strings.HasPrefix(output, prefix) {
+			return true
+		}
+	}
+	return strings.HasPrefix(output, "coverage:")
+}
+
+// truncate cuts s to at most n bytes, keeping the end which usually holds the interesting part of command output
+func truncate(s string, n int) (string, bool) {
+	if len(s) <= n {
+		return s, false
+	}
+	return "[...]\n" + s[len(s)-n:], true
+}
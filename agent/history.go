@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"github.com/sashabaranov/go-openai"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultHistoryTokens bounds the earlier conversation of chat sessions. Prompts carry up to ContextBudget tokens
+// of code themselves, what's left of the model's context window is needed for the tool calls of the current prompt.
+const DefaultHistoryTokens = 40_000
+
+// trimmedPromptChars is how much of the end of an earlier prompt is kept once its code context is trimmed,
+// questions follow the retrieved code in prompts
+const trimmedPromptChars = 2000
+
+// trimHistory fits the earlier conversation of a chat session into the history budget, the system message and
+// the latest turn are always kept. Tool calls and their outputs go first, then the code context of earlier prompts
+// and finally the oldest turns.
+func (a *Agent) trimHistory(messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	budget := a.cfg.Chat.HistoryTokens
+	if budget <= 0 {
+		budget = DefaultHistoryTokens
+	}
+
+	count := func(s string) int { return len(s) / 4 }
+	if enc, err := a.tokenizer(); err == nil {
+		count = func(s string) int { return len(enc.Encode(s, nil, nil)) }
+	}
+
+	return trimMessages(messages, budget, count)
+}
+
+func trimMessages(messages []openai.ChatCompletionMessage, budget int, count func(string) int) []openai.ChatCompletionMessage {
+	size := func(msgs []openai.ChatCompletionMessage) int {
+		tokens := 0
+		for _, m := range msgs {
+			tokens += count(m.Content)
+			for _, call := range m.ToolCalls {
+				tokens += count(call.Function.Arguments)
+			}
+		}
+		return tokens
+	}
+	if size(messages) <= budget {
+		return messages
+	}
+
+	var system []openai.ChatCompletionMessage
+	if len(messages) > 0 && messages[0].Role == openai.ChatMessageRoleSystem {
+		system, messages = messages[:1], messages[1:]
+	}
+
+	// a turn starts with a prompt of the user
+	var turns [][]openai.ChatCompletionMessage
+	for _, m := range messages {
+		if m.Role == openai.ChatMessageRoleUser || len(turns) == 0 {
+			turns = append(turns, nil)
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], m)
+	}
+
+	flatten := func() []openai.ChatCompletionMessage {
+		out := append([]openai.ChatCompletionMessage{}, system...)
+		for _, t := range turns {
+			out = append(out, t...)
+		}
+		return out
+	}
+
+	// the answers of earlier turns hold what the model took from its tool calls
+	for i, t := range turns {
+		kept := make([]openai.ChatCompletionMessage, 0, 2)
+		for _, m := range t {
+			if m.Role == openai.ChatMessageRoleTool || len(m.ToolCalls) > 0 {
+				continue
+			}
+			kept = append(kept, m)
+		}
+		turns[i] = kept
+	}
+	if size(flatten()) <= budget {
+		return flatten()
+	}
+
+	for _, t := range turns {
+		for i, m := range t {
+			if m.Role == openai.ChatMessageRoleUser && len(m.Content) > trimmedPromptChars {
+				t[i].Content = "(code context of this earlier prompt trimmed)\n..." + tail(m.Content, trimmedPromptChars)
+			}
+		}
+	}
+
+	for len(turns) > 1 && size(flatten()) > budget {
+		turns = turns[1:]
+	}
+	return flatten()
+}
+
+// tail returns the last n bytes of s, or a little less to start on a rune
+func tail(s string, n int) string {
+	start := len(s) - n
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return strings.TrimLeft(s[start:], "\n")
+}
@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/rag"
+	"strings"
+)
+
+// maxHoverRelated caps the similar declarations listed in an index hover
+const maxHoverRelated = 5
+
+// IndexHover describes the declaration of the identifier at a location as markdown: where it's declared, how often
+// it's referenced and the indexed code most similar to it. It's empty for declarations that aren't indexed, like
+// those of the standard library. No model is involved, so it's quick enough for an editor's hover.
+func (a *Agent) IndexHover(ctx context.Context, loc Location) (string, error) {
+	snapshot, err := a.Snapshot(ctx)
+	if errors.Is(err, rag.ErrNoSnapshot) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	uri, pos, err := a.lspPosition(loc.Path, loc.Line, loc.Col)
+	if err != nil {
+		return "", err
+	}
+
+	def, err := a.lsp.GoToDefinition(uri, pos.Line, pos.Character)
+	if err != nil || def == nil {
+		return "", err
+	}
+	defPath, err := a.cfg.Workspace.Abs(def.URI)
+	if err != nil {
+		return "", nil
+	}
+
+	// the file may have changed since it was indexed, the current declaration is matched to its indexed version by name
+	chunks, err := a.fileChunks(ctx, defPath)
+	if err != nil {
+		return "", err
+	}
+	decl := enclosingChunk(chunks, def.Range.Start.Line+1)
+	if decl == nil {
+		return "", nil
+	}
+
+	indexed, err := a.ragStore.FindChunks(ctx, snapshot.ID, rag.ChunkQuery{FilePath: defPath, Name: decl.Name})
+	if err != nil {
+		return "", fmt.Errorf("failed to look up %s: %w", decl.Name, err)
+	}
+	var vector []float32
+	for _, c := range indexed {
+		if c.Kind == decl.Kind && len(c.Vector) > 0 {
+			vector = c.Vector
+			break
+		}
+	}
+	if vector == nil {
+		return "", nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("**goon** · `%s` %s · %s:%d-%d", decl.Name, decl.Kind, a.cfg.Workspace.Display(defPath), decl.StartLine, decl.EndLine))
+	if refs, err := a.lsp.FindReferences(uri, pos.Line, pos.Character); err == nil {
+		sb.WriteString(fmt.Sprintf(" · %d references", len(refs)))
+	}
+	sb.WriteString("\n")
+
+	similar, err := a.ragStore.FindSimilarChunks(ctx, snapshot.ID, vector, rag.SearchOptions{Limit: maxHoverRelated + len(indexed)})
+	if err != nil {
+		return "", fmt.Errorf("failed to find similar chunks: %w", err)
+	}
+
+	var related int
+	for _, c := range similar {
+		if related == maxHoverRelated {
+			break
+		}
+		if c.FilePath == defPath && c.Name == decl.Name {
+			continue
+		}
+		if related == 0 {
+			sb.WriteString("\nSimilar code:\n")
+		}
+		related++
+		sb.WriteString(fmt.Sprintf("- `%s` %s · %s:%d\n", c.Name, c.Kind, a.cfg.Workspace.Display(c.FilePath), c.StartLine))
+	}
+
+	return sb.String(), nil
+}
@@ -3,15 +3,23 @@ package agent
 import (
 	"context"
 	"fmt"
-	"github.com/pkoukk/tiktoken-go"
 	"github.com/sajuno/goon/language/golang"
 	"github.com/sajuno/goon/rag"
-	"github.com/sashabaranov/go-openai"
 	"log"
+	"path/filepath"
 )
 
 func (a *Agent) IndexRepository(ctx context.Context, path string) error {
-	chunks, err := golang.ChunkRepository(path)
+	// resolved like workspace roots, chunks are looked up by their absolute paths
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve repository root: %w", err)
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return fmt.Errorf("failed to resolve repository root: %w", err)
+	}
+
+	chunks, err := golang.ChunkRepository(root)
 	if err != nil {
 		return err
 	}
@@ -21,11 +29,27 @@ func (a *Agent) IndexRepository(ctx context.Context, path string) error {
 		return fmt.Errorf("failed to get embeddings for chunks: %w", err)
 	}
 
-	return a.ragStore.SaveChunks(ctx, embeddedChunks)
+	snapshot := rag.Snapshot{
+		Root:           root,
+		EmbeddingModel: string(a.cfg.Embedding.Model),
+		Dimensions:     a.cfg.Embedding.Dimensions,
+	}
+	if len(embeddedChunks) > 0 {
+		// the model decides the dimensions unless they were explicitly shortened
+		snapshot.Dimensions = len(embeddedChunks[0].Vector)
+	}
+
+	snapshot, err = a.ragStore.SaveChunks(ctx, snapshot, embeddedChunks)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("indexed %d chunks into snapshot %s (%s, %d dimensions)\n", len(embeddedChunks), snapshot.ID, snapshot.EmbeddingModel, snapshot.Dimensions)
+	return nil
 }
 
 func (a *Agent) batchEmbedChunks(ctx context.Context, chunks []golang.Chunk) ([]rag.Chunk, error) {
-	enc, err := tiktoken.EncodingForModel("text-embedding-3-small")
+	enc, err := a.tokenizer()
 	if err != nil {
 		return nil, fmt.Errorf("invalid tiktoken encoding: %w", err)
 	}
@@ -44,15 +68,12 @@ func (a *Agent) batchEmbedChunks(ctx context.Context, chunks []golang.Chunk) ([]
 			return nil
 		}
 
-		resp, err := a.openai.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
-			Input: batchContents,
-			Model: openai.SmallEmbedding3,
-		})
+		data, err := a.embed(ctx, batchContents)
 		if err != nil {
 			return fmt.Errorf("embedding request failed: %w", err)
 		}
 
-		for _, e := range resp.Data {
+		for _, e := range data {
 			sourceChunk := batchChunks[e.Index]
 			tokenCount := len(enc.Encode(sourceChunk.Content, nil, nil))
 
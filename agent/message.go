@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"strings"
+)
+
+// annotation is a text annotation of an assistant message, go-openai leaves these untyped
+type annotation struct {
+	Type         string `json:"type"`
+	Text         string `json:"text"`
+	StartIndex   int    `json:"start_index"`
+	EndIndex     int    `json:"end_index"`
+	FileCitation *struct {
+		FileID string `json:"file_id"`
+		Quote  string `json:"quote"`
+	} `json:"file_citation,omitempty"`
+	FilePath *struct {
+		FileID string `json:"file_id"`
+	} `json:"file_path,omitempty"`
+}
+
+// renderMessage turns every content part of a message into text.
+// Annotations are replaced by numbered references listed below the text, images by a placeholder.
+func renderMessage(msg openai.Message) string {
+	var sb strings.Builder
+	for _, part := range msg.Content {
+		switch {
+		case part.Text != nil:
+			sb.WriteString(renderText(*part.Text))
+		case part.ImageFile != nil:
+			sb.WriteString(fmt.Sprintf("\n[image: file %s]\n", part.ImageFile.FileID))
+		case part.ImageURL != nil:
+			sb.WriteString(fmt.Sprintf("\n[image: %s]\n", part.ImageURL.URL))
+		default:
+			sb.WriteString(fmt.Sprintf("\n[unsupported %s content]\n", part.Type))
+		}
+	}
+	return sb.String()
+}
+
+func renderText(text openai.MessageText) string {
+	annotations := decodeAnnotations(text.Annotations)
+	if len(annotations) == 0 {
+		return text.Value
+	}
+
+	value := text.Value
+	var refs []string
+	for _, a := range annotations {
+		if a.Text == "" {
+			continue
+		}
+
+		var ref string
+		switch {
+		case a.FileCitation != nil:
+			ref = fmt.Sprintf("file %s", a.FileCitation.FileID)
+			if a.FileCitation.Quote != "" {
+				ref += fmt.Sprintf(": %q", a.FileCitation.Quote)
+			}
+		case a.FilePath != nil:
+			ref = fmt.Sprintf("file %s", a.FilePath.FileID)
+		default:
+			ref = a.Type
+		}
+
+		refs = append(refs, ref)
+		value = strings.Replace(value, a.Text, fmt.Sprintf("[%d]", len(refs)), 1)
+	}
+
+	if len(refs) == 0 {
+		return value
+	}
+
+	var sb strings.Builder
+	sb.WriteString(value)
+	sb.WriteString("\n")
+	for i, ref := range refs {
+		sb.WriteString(fmt.Sprintf("\n[%d] %s", i+1, ref))
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+func decodeAnnotations(raw []any) []annotation {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+
+	var out []annotation
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil
+	}
+	return out
+}
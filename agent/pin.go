@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"github.com/sajuno/goon/language/golang"
+	"github.com/sajuno/goon/rag"
+	"os"
+	"strings"
+)
+
+// Pin is a file or a symbol that's part of Explain's context whatever the question
+type Pin struct {
+	// Path is the absolute path of a pinned file, empty for symbols
+	Path string
+
+	Symbol Symbol
+}
+
+// ParsePin parses a .go file path, relative to the workspace root, or a symbol as accepted by ParseSymbol
+func (a *Agent) ParsePin(target string) (Pin, error) {
+	if !strings.HasSuffix(target, ".go") {
+		sym, err := ParseSymbol(target)
+		if err != nil {
+			return Pin{}, err
+		}
+		return Pin{Symbol: sym}, nil
+	}
+
+	abs, err := a.cfg.Workspace.Abs(target)
+	if err != nil {
+		return Pin{}, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return Pin{}, err
+	}
+	if info.IsDir() {
+		return Pin{}, fmt.Errorf("%s is a directory, pin its files instead", target)
+	}
+	return Pin{Path: abs}, nil
+}
+
+// PinnedChunks returns the current code of pins, a whole file for pinned files, with their token counts
+func (a *Agent) PinnedChunks(ctx context.Context, pins []Pin) ([]rag.Chunk, error) {
+	enc, err := a.tokenizer()
+	if err != nil {
+		return nil, fmt.Errorf("invalid tiktoken encoding: %w", err)
+	}
+
+	chunks := make([]rag.Chunk, 0, len(pins))
+	for _, pin := range pins {
+		var chunk golang.Chunk
+		if pin.Path != "" {
+			content, err := os.ReadFile(pin.Path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read pinned file: %w", err)
+			}
+			text := strings.TrimRight(string(content), "\n")
+			chunk = golang.Chunk{
+				Name:      a.cfg.Workspace.Display(pin.Path),
+				FilePath:  pin.Path,
+				Content:   text,
+				StartLine: 1,
+				EndLine:   strings.Count(text, "\n") + 1,
+			}
+		} else if chunk, err = a.findSymbol(ctx, pin.Symbol); err != nil {
+			return nil, err
+		}
+
+		chunks = append(chunks, rag.Chunk{Chunk: chunk, Tokens: len(enc.Encode(chunk.Content, nil, nil))})
+	}
+	return chunks, nil
+}
+
+// pinned reports whether a chunk is part of one of the pinned chunks
+func pinned(chunk golang.Chunk, pins []rag.Chunk) bool {
+	for _, pin := range pins {
+		if chunk.FilePath == pin.FilePath && chunk.StartLine >= pin.StartLine && chunk.EndLine <= pin.EndLine {
+			return true
+		}
+	}
+	return false
+}
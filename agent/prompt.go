@@ -2,14 +2,17 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/sajuno/goon/rag"
+	"github.com/sajuno/goon/session"
+	"github.com/sajuno/goon/workspace"
 	"github.com/sashabaranov/go-openai"
 	"strings"
-	"time"
 )
 
-func buildPromptContext(chunks []rag.Chunk, maxTokens int) string {
+func buildPromptContext(ws *workspace.Workspace, chunks []rag.Chunk, maxTokens int) string {
 	var (
 		sb         strings.Builder
 		tokensUsed int
@@ -25,7 +28,7 @@ func buildPromptContext(chunks []rag.Chunk, maxTokens int) string {
 
 		sb.WriteString(fmt.Sprintf("## %s", chunk.Name))
 		if chunk.FilePath != "" {
-			sb.WriteString(fmt.Sprintf(" (%s)", chunk.FilePath))
+			sb.WriteString(fmt.Sprintf(" (%s:%d-%d)", ws.Display(chunk.FilePath), chunk.StartLine, chunk.EndLine))
 		}
 		sb.WriteString("\n\n```go\n")
 		sb.WriteString(chunk.Content)
@@ -38,48 +41,55 @@ func buildPromptContext(chunks []rag.Chunk, maxTokens int) string {
 	return sb.String()
 }
 
-func (a *Agent) promptAI(ctx context.Context, prompt string) (string, error) {
-	thread, err := a.openai.CreateThread(ctx, openai.ThreadRequest{})
-	if err != nil {
-		return "", fmt.Errorf("failed to create new thread: %w", err)
+// promptAI sends the prompt to the configured backend and streams the answer to out
+func (a *Agent) promptAI(ctx context.Context, sess *session.Session, prompt string, out Stream) (string, error) {
+	if a.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.cfg.Timeout)
+		defer cancel()
 	}
 
-	_, err = a.openai.CreateMessage(ctx, thread.ID, openai.MessageRequest{
-		Role:    openai.ChatMessageRoleUser,
-		Content: prompt,
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to create new message: %w", err)
+	switch a.cfg.Backend {
+	case BackendChat:
+		return a.promptChat(ctx, sess, prompt, out)
+	default:
+		return a.promptAssistant(ctx, sess, prompt, out)
 	}
+}
 
-	run, err := a.openai.CreateRun(ctx, thread.ID, openai.RunRequest{
-		AssistantID: a.cfg.ID,
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to create new run: %w", err)
+// promptAssistant sends the prompt to the session's assistant thread, a thread is created for new sessions
+func (a *Agent) promptAssistant(ctx context.Context, sess *session.Session, prompt string, out Stream) (string, error) {
+	if a.cfg.Assistant.ID == "" {
+		return "", errors.New("assistant_id is not configured, set it or use the chat backend")
 	}
 
-	// TODO: add timeout
-	for {
-		time.Sleep(time.Second)
-		runStatus, _ := a.openai.RetrieveRun(ctx, thread.ID, run.ID)
-
-		switch runStatus.Status {
-		case openai.RunStatusCompleted:
-			break
-		case openai.RunStatusFailed:
-			return "", fmt.Errorf("run failed, last error: %s", runStatus.LastError.Message)
-		default:
-		}
-		if runStatus.Status == openai.RunStatusCompleted {
-			break
+	if sess.ThreadID == "" {
+		thread, err := a.openai.CreateThread(ctx, openai.ThreadRequest{})
+		if err != nil {
+			return "", fmt.Errorf("failed to create new thread: %w", err)
 		}
+		sess.ThreadID = thread.ID
 	}
 
-	res, err := a.openai.ListMessage(ctx, thread.ID, nil, nil, nil, nil, nil)
+	_, err := a.openai.CreateMessage(ctx, sess.ThreadID, openai.MessageRequest{
+		Role:    openai.ChatMessageRoleUser,
+		Content: prompt,
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to list message: %w", err)
+		return "", fmt.Errorf("failed to create new message: %w", err)
 	}
 
-	return res.Messages[0].Content[0].Text.Value, nil
+	return a.executeRun(ctx, sess.ThreadID, out)
+}
+
+// decodeJSONAnswer decodes the JSON object in a model's answer, ignoring code fences or prose around it
+func decodeJSONAnswer(answer string, v any) error {
+	start, end := strings.Index(answer, "{"), strings.LastIndex(answer, "}")
+	if start < 0 || end < start {
+		return fmt.Errorf("answer is not JSON: %q", answer)
+	}
+	if err := json.Unmarshal([]byte(answer[start:end+1]), v); err != nil {
+		return fmt.Errorf("failed to decode answer: %w", err)
+	}
+	return nil
 }
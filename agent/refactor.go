@@ -0,0 +1,410 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/gitdiff"
+	"github.com/sajuno/goon/language/golang"
+	"github.com/sajuno/goon/language/lsp"
+	"github.com/sajuno/goon/openai/tools/functions"
+	"github.com/sajuno/goon/rag"
+	"go/format"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	// codeActionDiagnosticsTimeout bounds the wait for diagnostics of a file that wasn't open yet,
+	// quick fixes are only offered for known diagnostics
+	codeActionDiagnosticsTimeout = 3 * time.Second
+	codeActionQuietPeriod        = 300 * time.Millisecond
+)
+
+// ErrNothingToRename is returned when there's no renameable identifier at a position
+var ErrNothingToRename = errors.New("nothing to rename at this position")
+
+// Rename has gopls rename the identifier at a position, line and column are 1-based with the column in bytes.
+// The resulting changes are returned to be previewed and applied with ApplyChanges.
+func (a *Agent) Rename(ctx context.Context, path string, line, col int, newName string) (*ChangeSet, error) {
+	uri, pos, err := a.lspPosition(path, line, col)
+	if err != nil {
+		return nil, err
+	}
+	return a.rename(uri, pos, newName)
+}
+
+func (a *Agent) rename(uri string, pos lsp.Position, newName string) (*ChangeSet, error) {
+	prepared, err := a.lsp.PrepareRename(uri, pos.Line, pos.Character)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare rename: %w", err)
+	}
+	if prepared == nil {
+		return nil, ErrNothingToRename
+	}
+
+	edit, err := a.lsp.Rename(uri, pos.Line, pos.Character, newName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rename: %w", err)
+	}
+
+	summary := fmt.Sprintf("Rename %s to %s", prepared.Placeholder, newName)
+	if prepared.Placeholder == "" {
+		summary = "Rename to " + newName
+	}
+	return a.workspaceEditChanges(summary, *edit)
+}
+
+// CodeActions returns the quick fixes and refactorings gopls offers for a range of lines, both 1-based and inclusive
+func (a *Agent) CodeActions(ctx context.Context, path string, startLine, endLine int) ([]lsp.CodeAction, error) {
+	abs, err := a.cfg.Workspace.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if endLine < startLine {
+		endLine = startLine
+	}
+
+	wasOpen := a.lsp.IsOpen(lsp.FileURI(abs))
+	uri, err := a.openFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !wasOpen {
+		waitCtx, cancel := context.WithTimeout(ctx, codeActionDiagnosticsTimeout)
+		err := a.lsp.WaitForDiagnostics(waitCtx, codeActionQuietPeriod)
+		cancel()
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
+	}
+
+	rng := lsp.Range{
+		Start: lsp.Position{Line: startLine - 1},
+		End:   lsp.Position{Line: endLine},
+	}
+
+	var diagnostics []lsp.Diagnostic
+	for _, d := range a.lsp.Diagnostics(uri) {
+		if d.Range.Start.Line < rng.End.Line && d.Range.End.Line >= rng.Start.Line {
+			diagnostics = append(diagnostics, d)
+		}
+	}
+
+	actions, err := a.lsp.CodeActions(uri, rng, diagnostics)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get code actions: %w", err)
+	}
+
+	// only actions that can be previewed are offered, other commands change go.mod or files on disk themselves
+	previewable := actions[:0]
+	for _, action := range actions {
+		if action.Command == nil || previewableCommands[action.Command.Command] {
+			previewable = append(previewable, action)
+		}
+	}
+	return previewable, nil
+}
+
+// previewableCommands are the gopls commands that make their changes by asking the client to apply edits,
+// executing them changes nothing by itself. Commands like gopls.tidy or gopls.add_dependency run go commands instead.
+var previewableCommands = map[string]bool{
+	"gopls.apply_fix":           true,
+	"gopls.change_signature":    true,
+	"gopls.add_import":          true,
+	"gopls.extract_to_new_file": true,
+}
+
+// CodeActionChanges returns the changes of a code action offered by CodeActions. Its edit is taken as is, its
+// command is executed and the edits gopls asks to apply while it runs are collected, nothing is written to the
+// workspace.
+func (a *Agent) CodeActionChanges(ctx context.Context, action lsp.CodeAction) (*ChangeSet, error) {
+	var edits []lsp.WorkspaceEdit
+	if action.Edit != nil {
+		edits = append(edits, *action.Edit)
+	}
+	if action.Command != nil {
+		if !previewableCommands[action.Command.Command] {
+			return nil, fmt.Errorf("%s changes files itself, its changes can't be previewed", action.Command.Command)
+		}
+		_, commandEdits, err := a.lsp.ExecuteCommand(*action.Command)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute %s: %w", action.Command.Command, err)
+		}
+		edits = append(edits, commandEdits...)
+	}
+
+	return a.workspaceEditChanges(action.Title, edits...)
+}
+
+// workspaceEditChanges turns workspace edits into a change set. Edits have to stay within the workspace,
+// new files can be created, renaming or deleting files isn't supported.
+func (a *Agent) workspaceEditChanges(summary string, edits ...lsp.WorkspaceEdit) (*ChangeSet, error) {
+	byPath := make(map[string][]lsp.TextEdit)
+	created := make(map[string]bool)
+	for _, edit := range edits {
+		for _, op := range edit.Operations {
+			if op.Kind != "create" {
+				return nil, fmt.Errorf("the edit %ss files, which isn't supported", op.Kind)
+			}
+			path, err := a.cfg.Workspace.Abs(op.URI)
+			if err != nil {
+				return nil, fmt.Errorf("the edit creates files outside of the workspace: %w", err)
+			}
+			if _, err := os.Stat(path); err == nil {
+				return nil, fmt.Errorf("the edit creates %s, which already exists", a.cfg.Workspace.Display(path))
+			}
+			created[path] = true
+			if _, ok := byPath[path]; !ok {
+				byPath[path] = nil
+			}
+		}
+		for uri, textEdits := range edit.Changes {
+			path, err := a.cfg.Workspace.Abs(uri)
+			if err != nil {
+				return nil, fmt.Errorf("the edit changes files outside of the workspace: %w", err)
+			}
+			byPath[path] = append(byPath[path], textEdits...)
+		}
+	}
+
+	var files []fileChange
+	for path, textEdits := range byPath {
+		rel, err := a.cfg.Workspace.Rel(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var old []byte
+		if !created[path] {
+			if old, err = os.ReadFile(path); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", rel, err)
+			}
+		}
+
+		updated, err := lsp.ApplyTextEdits(string(old), textEdits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply the edits of %s: %w", rel, err)
+		}
+
+		// renames can change the alignment of the surrounding code
+		if filepath.Ext(path) == ".go" {
+			if formatted, err := format.Source([]byte(updated)); err == nil {
+				updated = string(formatted)
+			}
+		}
+		if updated != string(old) || created[path] {
+			files = append(files, fileChange{path: rel, old: old, new: []byte(updated), created: created[path]})
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("the edit doesn't change anything")
+	}
+
+	return newChangeSet(summary, nil, files), nil
+}
+
+// lspPosition opens a file in gopls and converts a 1-based line and byte column into an LSP position
+func (a *Agent) lspPosition(path string, line, col int) (string, lsp.Position, error) {
+	abs, err := a.cfg.Workspace.Abs(path)
+	if err != nil {
+		return "", lsp.Position{}, err
+	}
+
+	uri, err := a.openFile(abs)
+	if err != nil {
+		return "", lsp.Position{}, err
+	}
+
+	b, err := os.ReadFile(abs)
+	if err != nil {
+		return "", lsp.Position{}, err
+	}
+	lines := strings.Split(string(b), "\n")
+	if line < 1 || line > len(lines) {
+		return "", lsp.Position{}, fmt.Errorf("line %d is outside of %s's %d lines", line, a.cfg.Workspace.Display(abs), len(lines))
+	}
+
+	text := lines[line-1]
+	if col < 1 || col > len(text)+1 {
+		return "", lsp.Position{}, fmt.Errorf("column %d is outside of line %d", col, line)
+	}
+
+	// LSP characters are UTF-16 code units
+	var units int
+	for _, r := range text[:col-1] {
+		if r == utf8.RuneError {
+			units++
+			continue
+		}
+		units += utf16.RuneLen(r)
+	}
+	return uri, lsp.Position{Line: line - 1, Character: units}, nil
+}
+
+// reindexFiles re-chunks and re-embeds changed Go files into the workspace's snapshot, so searches see the changes.
+// Workspaces that weren't indexed are left alone.
+func (a *Agent) reindexFiles(ctx context.Context, paths []string) error {
+	snapshot, err := a.Snapshot(ctx)
+	if errors.Is(err, rag.ErrNoSnapshot) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := snapshot.Compatible(string(a.cfg.Embedding.Model), a.cfg.Embedding.Dimensions); err != nil {
+		return err
+	}
+
+	sort.Strings(paths)
+	for _, path := range paths {
+		if filepath.Ext(path) != ".go" {
+			continue
+		}
+
+		pkgPath, err := a.importPath(ctx, snapshot.ID, path)
+		if err != nil {
+			return err
+		}
+		chunks, err := golang.ChunkFile(path, pkgPath)
+		if err != nil {
+			return err
+		}
+
+		embedded, err := a.batchEmbedChunks(ctx, chunks)
+		if err != nil {
+			return fmt.Errorf("failed to get embeddings for %s: %w", a.cfg.Workspace.Display(path), err)
+		}
+		if err := a.ragStore.ReplaceFileChunks(ctx, snapshot.ID, path, embedded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importPath returns the package a file was indexed with, or derives it from the module path for new files
+func (a *Agent) importPath(ctx context.Context, snapshotID, path string) (string, error) {
+	indexed, err := a.ragStore.FindChunks(ctx, snapshotID, rag.ChunkQuery{FilePath: path})
+	if err != nil {
+		return "", fmt.Errorf("failed to look up chunks of %s: %w", a.cfg.Workspace.Display(path), err)
+	}
+	if len(indexed) > 0 {
+		return indexed[0].Package, nil
+	}
+
+	module := modulePath(a.cfg.Workspace.Root())
+	if module == "" {
+		// ChunkFile falls back to the package name
+		return "", nil
+	}
+
+	rel, err := a.cfg.Workspace.Rel(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return module, nil
+	}
+	return module + "/" + filepath.ToSlash(rel), nil
+}
+
+// modulePath reads the module path from the go.mod in root, empty if there's none
+func modulePath(root string) string {
+	b, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if module, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+			return strings.Trim(strings.TrimSpace(module), `"`)
+		}
+	}
+	return ""
+}
+
+func (a *Agent) renameSymbol(ctx context.Context, in functions.RenameSymbolInput) (functions.ChangesOutput, error) {
+	abs, err := a.cfg.Workspace.Abs(in.URI)
+	if err != nil {
+		return functions.ChangesOutput{}, err
+	}
+	uri, err := a.openFile(abs)
+	if err != nil {
+		return functions.ChangesOutput{}, err
+	}
+
+	changes, err := a.rename(uri, lsp.Position{Line: in.Line, Character: in.Character}, in.NewName)
+	if err != nil {
+		return functions.ChangesOutput{}, err
+	}
+	return a.confirmChanges(ctx, changes)
+}
+
+func (a *Agent) codeActions(ctx context.Context, in functions.CodeActionsInput) (functions.CodeActionsOutput, error) {
+	actions, err := a.CodeActions(ctx, in.URI, in.StartLine+1, in.EndLine+1)
+	if err != nil {
+		return functions.CodeActionsOutput{}, err
+	}
+
+	out := functions.CodeActionsOutput{Actions: make([]functions.CodeActionInfo, 0, len(actions))}
+	for _, action := range actions {
+		info := functions.CodeActionInfo{Title: action.Title, Kind: action.Kind, IsPreferred: action.IsPreferred}
+		for _, d := range action.Diagnostics {
+			info.Fixes = append(info.Fixes, d.Message)
+		}
+		out.Actions = append(out.Actions, info)
+	}
+	return out, nil
+}
+
+func (a *Agent) applyCodeAction(ctx context.Context, in functions.ApplyCodeActionInput) (functions.ChangesOutput, error) {
+	actions, err := a.CodeActions(ctx, in.URI, in.StartLine+1, in.EndLine+1)
+	if err != nil {
+		return functions.ChangesOutput{}, err
+	}
+
+	for _, action := range actions {
+		if action.Title != in.Title {
+			continue
+		}
+		changes, err := a.CodeActionChanges(ctx, action)
+		if err != nil {
+			return functions.ChangesOutput{}, err
+		}
+		return a.confirmChanges(ctx, changes)
+	}
+	return functions.ChangesOutput{}, fmt.Errorf("no code action %q for this range, list them with code_actions", in.Title)
+}
+
+// confirmChanges shows the changes to the user and applies them once confirmed. Without anyone to confirm, like
+// in one-shot commands, the changes are only returned.
+func (a *Agent) confirmChanges(ctx context.Context, changes *ChangeSet) (functions.ChangesOutput, error) {
+	out := functions.ChangesOutput{Summary: changes.Summary, Files: changes.Paths(), Patch: changes.Patch}
+	if len(out.Patch) > maxGoOutput {
+		out.Patch = out.Patch[:maxGoOutput] + "\n... (truncated)"
+	}
+
+	if a.confirm == nil {
+		out.Message = "the changes were not applied, nobody can confirm them here. Show the patch to the user instead"
+		return out, nil
+	}
+
+	ok, err := a.confirm(ctx, fmt.Sprintf("%s\n\n%sApply these changes?", changes.Summary, gitdiff.Colorize(changes.Patch)))
+	if err != nil {
+		return out, err
+	}
+	if !ok {
+		out.Message = "the user declined the changes"
+		return out, nil
+	}
+
+	if err := a.ApplyChanges(ctx, changes); err != nil {
+		return out, err
+	}
+	out.Applied = true
+	return out, nil
+}
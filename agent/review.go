@@ -0,0 +1,346 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/gitdiff"
+	"github.com/sajuno/goon/language/golang"
+	"github.com/sajuno/goon/session"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// maxReviewDiff caps the diff sent to the model, larger changes are reviewed partially
+	maxReviewDiff = 60 * 1024
+
+	// maxReviewDeclarations caps the changed declarations shown in full
+	maxReviewDeclarations = 40 * 1024
+
+	// maxCallNeighbours caps the callers and callees listed per changed function
+	maxCallNeighbours = 8
+)
+
+var ErrNoChanges = errors.New("no changes to review")
+
+type ReviewSeverity string
+
+const (
+	ReviewIssue      ReviewSeverity = "issue"
+	ReviewSuggestion ReviewSeverity = "suggestion"
+	ReviewNit        ReviewSeverity = "nit"
+	ReviewQuestion   ReviewSeverity = "question"
+)
+
+type Review struct {
+	// Base is the branch the changes are compared to, empty for reviews of lines as they are
+	Base    string       `json:"base"`
+	Summary string       `json:"summary"`
+	Files   []FileReview `json:"files"`
+}
+
+type FileReview struct {
+	Path     string          `json:"path"`
+	Comments []ReviewComment `json:"comments"`
+}
+
+type ReviewComment struct {
+	Path string `json:"path"`
+
+	// Line is a line of the new version of the file that's part of the diff, 0 for comments on the file as a whole
+	Line     int            `json:"line"`
+	Severity ReviewSeverity `json:"severity"`
+	Body     string         `json:"body"`
+}
+
+// Review reviews the changes of the working tree compared to base, untracked files included. Changed hunks are mapped to the declarations
+// they touch, which are sent to the model together with their callers and callees.
+func (a *Agent) Review(ctx context.Context, base string, out Stream) (*Review, error) {
+	if out == nil {
+		out = discardStream{}
+	}
+
+	out.Status(fmt.Sprintf("diffing against %s", base))
+	files, err := gitdiff.Diff(ctx, a.cfg.Workspace.Root(), base)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.review(ctx, base, files, true, out)
+}
+
+// ReviewDiff reviews a diff made elsewhere, like in the checkout of another user of a shared server, with paths
+// relative to the workspace root. The workspace doesn't have the changed versions of the files, so only the diff
+// is sent and the model looks up the rest of the code base with its tools.
+func (a *Agent) ReviewDiff(ctx context.Context, base string, files []gitdiff.File, out Stream) (*Review, error) {
+	if out == nil {
+		out = discardStream{}
+	}
+	return a.review(ctx, base, files, false, out)
+}
+
+// review reviews the changed files, declarations are only collected when the files are the ones in the workspace
+func (a *Agent) review(ctx context.Context, base string, files []gitdiff.File, local bool, out Stream) (*Review, error) {
+	var reviewed []gitdiff.File
+	for _, f := range files {
+		if f.Deleted() || f.Binary || len(f.Hunks) == 0 || a.cfg.Workspace.Ignored(f.Path(), false) {
+			continue
+		}
+		reviewed = append(reviewed, f)
+	}
+	if len(reviewed) == 0 {
+		return nil, ErrNoChanges
+	}
+
+	provided := "For each changed file you get the diff, the Go declarations the diff touches and their callers and callees."
+	if !local {
+		provided = "You only get the diff of each changed file, the rest of the codebase may differ slightly from the branch's."
+	}
+
+	out.Status(fmt.Sprintf("collecting context for %d changed files", len(reviewed)))
+	prompt := fmt.Sprintf(`
+# Changes
+
+%s
+
+You are reviewing the changes above, from a branch that is going to be merged into %s.
+%s
+Use your tools to look at more of the codebase where the context isn't enough to judge a change.
+
+Look for bugs, broken callers, missing error handling, races, leaks and unclear code. Skip praise and anything
+a linter or gofmt would catch. Only comment when there's something worth changing or asking.
+
+Respond with JSON only, without code fences or prose around it, in exactly this format:
+{"summary": "overall assessment in a few sentences", "comments": [{"path": "dir/file.go", "line": 12, "severity": "issue", "body": "what's wrong and how to fix it"}]}
+
+path is one of the changed files, line is a line number in the new version of the file within one of its hunks.
+severity is one of "issue", "suggestion", "nit" or "question".
+Be concise, accurate, and if you can an asshole about it, please do so.
+`, a.reviewContext(ctx, reviewed, local, out), base, provided)
+
+	answer, err := a.promptAI(ctx, session.New(), prompt, statusStream{out})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseReview(base, answer, reviewed)
+}
+
+// ReviewLines reviews lines of a file as they are rather than as a change, both 1-based and inclusive.
+// The declarations overlapping the lines are sent along like for Review, comments outside the lines are on the file.
+func (a *Agent) ReviewLines(ctx context.Context, path string, startLine, endLine int, out Stream) (*Review, error) {
+	if out == nil {
+		out = discardStream{}
+	}
+
+	abs, err := a.cfg.Workspace.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := a.cfg.Workspace.Rel(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	// a trailing newline ends the last line rather than starting another one
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if endLine < startLine {
+		endLine = startLine
+	}
+	if startLine < 1 || endLine > len(lines) {
+		return nil, fmt.Errorf("lines %d-%d are outside of %s's %d lines", startLine, endLine, rel, len(lines))
+	}
+
+	// the lines are reviewed as if they were a hunk of a diff, which limits the comments to them
+	f := gitdiff.File{OldPath: rel, NewPath: rel, Hunks: []gitdiff.Hunk{{NewStart: startLine, NewLines: endLine - startLine + 1}}}
+
+	out.Status("collecting context")
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("## %s (lines %d-%d)\n\n```%s\n", rel, startLine, endLine, strings.TrimPrefix(filepath.Ext(rel), ".")))
+	for i := startLine; i <= endLine; i++ {
+		sb.WriteString(fmt.Sprintf("%d\t%s\n", i, lines[i-1]))
+	}
+	sb.WriteString("```\n\n")
+
+	if filepath.Ext(rel) == ".go" {
+		chunks, err := a.fileChunks(ctx, abs)
+		if err != nil {
+			out.Status(fmt.Sprintf("skipping declarations of %s: %v", rel, err))
+		} else if overlapping := changedChunks(f, chunks); len(overlapping) > 0 {
+			var size int
+			sb.WriteString("### Declarations\n\n")
+			a.writeDeclarations(&sb, overlapping, &size, out)
+		}
+	}
+
+	prompt := fmt.Sprintf(`
+# Code
+
+%s
+You are reviewing the code above, lines %d-%d of %s, which are prefixed with their line numbers.
+The declarations they are part of are shown with their callers and callees.
+Use your tools to look at more of the codebase where the context isn't enough to judge the code.
+
+Look for bugs, broken callers, missing error handling, races, leaks and unclear code. Skip praise and anything
+a linter or gofmt would catch. Only comment when there's something worth changing or asking.
+
+Respond with JSON only, without code fences or prose around it, in exactly this format:
+{"summary": "overall assessment in a few sentences", "comments": [{"path": "%s", "line": %d, "severity": "issue", "body": "what's wrong and how to fix it"}]}
+
+line is a line number within %d-%d. severity is one of "issue", "suggestion", "nit" or "question".
+Be concise, accurate, and if you can an asshole about it, please do so.
+`, sb.String(), startLine, endLine, rel, rel, startLine, startLine, endLine)
+
+	answer, err := a.promptAI(ctx, session.New(), prompt, statusStream{out})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseReview("", answer, []gitdiff.File{f})
+}
+
+// reviewContext formats the diff of every file, with the declarations it touches when the files are the workspace's
+func (a *Agent) reviewContext(ctx context.Context, files []gitdiff.File, withDeclarations bool, out Stream) string {
+	var (
+		sb                  strings.Builder
+		diffSize, declsSize int
+	)
+
+	for _, f := range files {
+		var diff strings.Builder
+		for _, h := range f.Hunks {
+			diff.WriteString(h.String())
+		}
+		if diffSize+diff.Len() > maxReviewDiff {
+			sb.WriteString(fmt.Sprintf("## %s\n\n(diff omitted, the change is too large to review at once)\n\n", f.Path()))
+			continue
+		}
+		diffSize += diff.Len()
+
+		status := "modified"
+		if f.OldPath == "" {
+			status = "new file"
+		} else if f.OldPath != f.NewPath {
+			status = "renamed from " + f.OldPath
+		}
+		sb.WriteString(fmt.Sprintf("## %s (%s)\n\n```diff\n%s```\n\n", f.Path(), status, diff.String()))
+
+		if !withDeclarations || filepath.Ext(f.Path()) != ".go" {
+			continue
+		}
+
+		path, err := a.cfg.Workspace.Abs(f.Path())
+		if err != nil {
+			continue
+		}
+		chunks, err := a.fileChunks(ctx, path)
+		if err != nil {
+			out.Status(fmt.Sprintf("skipping declarations of %s: %v", f.Path(), err))
+			continue
+		}
+
+		changed := changedChunks(f, chunks)
+		if len(changed) == 0 {
+			continue
+		}
+
+		sb.WriteString("### Changed declarations\n\n")
+		a.writeDeclarations(&sb, changed, &declsSize, out)
+	}
+
+	return sb.String()
+}
+
+// writeDeclarations writes declarations with their callers and callees, size accumulates the declarations written
+// so far. Declarations beyond maxReviewDeclarations are only named.
+func (a *Agent) writeDeclarations(sb *strings.Builder, chunks []golang.Chunk, size *int, out Stream) {
+	for _, chunk := range chunks {
+		if *size+len(chunk.Content) > maxReviewDeclarations {
+			sb.WriteString(fmt.Sprintf("#### %s (%s, lines %d-%d)\n\n(omitted)\n\n", chunk.Name, chunk.Kind, chunk.StartLine, chunk.EndLine))
+			continue
+		}
+		*size += len(chunk.Content)
+
+		sb.WriteString(fmt.Sprintf("#### %s (%s, lines %d-%d)\n\n```go\n%s\n```\n\n", chunk.Name, chunk.Kind, chunk.StartLine, chunk.EndLine, chunk.Content))
+
+		callers, callees, err := a.callNeighbours(chunk, maxCallNeighbours)
+		if err != nil {
+			out.Status(fmt.Sprintf("no call hierarchy for %s: %v", chunk.Name, err))
+			continue
+		}
+		if len(callers) > 0 {
+			sb.WriteString("Called by: " + joinNeighbours(callers) + "\n\n")
+		}
+		if len(callees) > 0 {
+			sb.WriteString("Calls: " + joinNeighbours(callees) + "\n\n")
+		}
+	}
+}
+
+// changedChunks returns the chunks overlapping a hunk, by the lines of the new version of the file
+func changedChunks(f gitdiff.File, chunks []golang.Chunk) []golang.Chunk {
+	var changed []golang.Chunk
+	for _, chunk := range chunks {
+		for _, h := range f.Hunks {
+			end := h.NewStart + max(h.NewLines, 1) - 1
+			if chunk.StartLine <= end && chunk.EndLine >= h.NewStart {
+				changed = append(changed, chunk)
+				break
+			}
+		}
+	}
+	return changed
+}
+
+func joinNeighbours(neighbours []callNeighbour) string {
+	names := make([]string, 0, len(neighbours))
+	for _, n := range neighbours {
+		names = append(names, n.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// parseReview decodes the model's answer. Comments on files outside of the diff are dropped,
+// comments on lines outside of the hunks become comments on the file
+func parseReview(base, answer string, files []gitdiff.File) (*Review, error) {
+	var decoded struct {
+		Summary  string          `json:"summary"`
+		Comments []ReviewComment `json:"comments"`
+	}
+	if err := decodeJSONAnswer(answer, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode review: %w", err)
+	}
+
+	review := &Review{Base: base, Summary: strings.TrimSpace(decoded.Summary)}
+	for _, f := range files {
+		fileReview := FileReview{Path: f.Path()}
+		for _, c := range decoded.Comments {
+			if strings.TrimPrefix(c.Path, "./") != f.Path() {
+				continue
+			}
+			c.Path = f.Path()
+
+			if !f.ContainsLine(c.Line) {
+				c.Line = 0
+			}
+			switch c.Severity {
+			case ReviewIssue, ReviewSuggestion, ReviewNit, ReviewQuestion:
+			default:
+				c.Severity = ReviewSuggestion
+			}
+			fileReview.Comments = append(fileReview.Comments, c)
+		}
+
+		if len(fileReview.Comments) > 0 {
+			review.Files = append(review.Files, fileReview)
+		}
+	}
+
+	return review, nil
+}
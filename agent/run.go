@@ -0,0 +1,262 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/openai/runstream"
+	"github.com/sashabaranov/go-openai"
+	"io"
+	"log"
+	"time"
+)
+
+var (
+	ErrRunFailed     = errors.New("run failed")
+	ErrRunCancelled  = errors.New("run cancelled")
+	ErrRunExpired    = errors.New("run expired")
+	ErrRunIncomplete = errors.New("run incomplete")
+)
+
+// RunError is returned for runs that ended in any status other than completed.
+// It wraps one of the ErrRun* errors depending on the status.
+type RunError struct {
+	RunID   string
+	Status  openai.RunStatus
+	Code    string
+	Message string
+}
+
+func (e *RunError) Error() string {
+	msg := fmt.Sprintf("run %s %s", e.RunID, e.Status)
+	if e.Code != "" {
+		msg += fmt.Sprintf(" (%s)", e.Code)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *RunError) Unwrap() error {
+	switch e.Status {
+	case openai.RunStatusFailed:
+		return ErrRunFailed
+	case openai.RunStatusCancelled, openai.RunStatusCancelling:
+		return ErrRunCancelled
+	case openai.RunStatusExpired:
+		return ErrRunExpired
+	case openai.RunStatusIncomplete:
+		return ErrRunIncomplete
+	default:
+		return nil
+	}
+}
+
+func newRunError(run openai.Run) *RunError {
+	err := &RunError{RunID: run.ID, Status: run.Status}
+	if run.LastError != nil {
+		err.Code = string(run.LastError.Code)
+		err.Message = run.LastError.Message
+	}
+	if run.Status == openai.RunStatusIncomplete && err.Message == "" {
+		err.Message = "the run hit its token limit before finishing"
+	}
+	return err
+}
+
+func isTerminal(status openai.RunStatus) bool {
+	switch status {
+	case openai.RunStatusCompleted,
+		openai.RunStatusFailed,
+		openai.RunStatusCancelled,
+		openai.RunStatusExpired,
+		openai.RunStatusIncomplete:
+		return true
+	default:
+		return false
+	}
+}
+
+// runState is what's known about a run from its events
+type runState struct {
+	run openai.Run
+
+	// messages completed during the run, in order
+	messages []openai.Message
+}
+
+// executeRun drives a run from creation to a terminal status, executing required tool calls along the way.
+// When ctx is done the run is cancelled on OpenAI's side as well.
+func (a *Agent) executeRun(ctx context.Context, threadID string, out Stream) (string, error) {
+	stream, err := a.runs.CreateRun(ctx, threadID, openai.RunRequest{
+		AssistantID: a.cfg.Assistant.ID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create new run: %w", err)
+	}
+
+	var state runState
+	for {
+		err := consumeRun(stream, out, &state)
+		_ = stream.Close()
+
+		if ctx.Err() != nil {
+			if state.run.ID != "" {
+				a.cancelRun(threadID, state.run.ID)
+			}
+			return "", ctx.Err()
+		}
+
+		if err != nil || !isTerminal(state.run.Status) && state.run.Status != openai.RunStatusRequiresAction {
+			// the stream broke off, fall back to the run's persisted state
+			if state.run.ID == "" {
+				if err == nil {
+					err = io.ErrUnexpectedEOF
+				}
+				return "", fmt.Errorf("run stream ended before the run was created: %w", err)
+			}
+			log.Printf("run stream of %s interrupted (%v), waiting for the run instead", state.run.ID, err)
+
+			if state.run, err = a.awaitRun(ctx, threadID, state.run.ID); err != nil {
+				if ctx.Err() != nil {
+					a.cancelRun(threadID, state.run.ID)
+				}
+				return "", err
+			}
+		}
+
+		switch state.run.Status {
+		case openai.RunStatusCompleted:
+			return a.runAnswer(ctx, threadID, state)
+		case openai.RunStatusRequiresAction:
+			action := state.run.RequiredAction
+			if action == nil || action.SubmitToolOutputs == nil {
+				return "", fmt.Errorf("run %s requires an unsupported action", state.run.ID)
+			}
+
+			var outputs []openai.ToolOutput
+			for _, o := range a.callTools(ctx, action.SubmitToolOutputs.ToolCalls, out) {
+				outputs = append(outputs, openai.ToolOutput{ToolCallID: o.CallID, Output: o.Output})
+			}
+
+			stream, err = a.runs.SubmitToolOutputs(ctx, threadID, state.run.ID, openai.SubmitToolOutputsRequest{
+				ToolOutputs: outputs,
+			})
+			if err != nil {
+				if ctx.Err() != nil {
+					a.cancelRun(threadID, state.run.ID)
+					return "", ctx.Err()
+				}
+				return "", fmt.Errorf("failed to submit tool outputs: %w", err)
+			}
+		default:
+			return "", newRunError(state.run)
+		}
+	}
+}
+
+// consumeRun reads a run's events until the stream ends.
+// Message deltas are written to out, state holds the latest known run and completed messages.
+func consumeRun(stream *runstream.Stream, out Stream, state *runState) error {
+	for {
+		event, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read run stream: %w", err)
+		}
+
+		switch {
+		case event.Name == runstream.EventError:
+			return event.Error()
+		case event.Name == runstream.EventMessageDelta:
+			delta, err := event.MessageDelta()
+			if err != nil {
+				return fmt.Errorf("failed to decode message delta: %w", err)
+			}
+			out.Delta(delta.Text())
+		case event.Name == runstream.EventMessageCompleted:
+			msg, err := event.Message()
+			if err != nil {
+				return fmt.Errorf("failed to decode message: %w", err)
+			}
+			state.messages = append(state.messages, msg)
+		case event.IsRunEvent():
+			run, err := event.Run()
+			if err != nil {
+				return fmt.Errorf("failed to decode run: %w", err)
+			}
+			state.run = run
+		}
+	}
+}
+
+// awaitRun waits for a run to reach a terminal status or to require action, with backoff between retrievals
+func (a *Agent) awaitRun(ctx context.Context, threadID, runID string) (openai.Run, error) {
+	const maxFailures = 3
+	var (
+		delay    = 500 * time.Millisecond
+		failures int
+	)
+
+	for {
+		run, err := a.openai.RetrieveRun(ctx, threadID, runID)
+		switch {
+		case err != nil:
+			failures++
+			if failures >= maxFailures || ctx.Err() != nil {
+				return openai.Run{ID: runID}, fmt.Errorf("failed to retrieve run %s: %w", runID, err)
+			}
+		case isTerminal(run.Status) || run.Status == openai.RunStatusRequiresAction:
+			return run, nil
+		default:
+			failures = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return openai.Run{ID: runID}, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, 5*time.Second)
+	}
+}
+
+// runAnswer renders the messages a completed run produced.
+// They're fetched from the thread when the stream didn't deliver them.
+func (a *Agent) runAnswer(ctx context.Context, threadID string, state runState) (string, error) {
+	messages := state.messages
+	if len(messages) == 0 {
+		order := "asc"
+		res, err := a.openai.ListMessage(ctx, threadID, nil, &order, nil, nil, &state.run.ID)
+		if err != nil {
+			return "", fmt.Errorf("failed to list messages: %w", err)
+		}
+		messages = res.Messages
+	}
+
+	var answer string
+	for _, msg := range messages {
+		if msg.Role != openai.ChatMessageRoleAssistant {
+			continue
+		}
+		answer += renderMessage(msg)
+	}
+
+	if answer == "" {
+		return "", fmt.Errorf("run %s completed without an answer", state.run.ID)
+	}
+	return answer, nil
+}
+
+// cancelRun is called after ctx is done, so it uses a context of its own
+func (a *Agent) cancelRun(threadID, runID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := a.openai.CancelRun(ctx, threadID, runID); err != nil {
+		log.Printf("failed to cancel run %s: %v", runID, err)
+	}
+}
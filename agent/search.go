@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"github.com/sajuno/goon/language/golang"
+	"github.com/sajuno/goon/openai/tools/functions"
+	"github.com/sajuno/goon/rag"
+	"math"
+)
+
+// defaultSearchCodeLimit is lower than the store's default, the model reads the results with read_file and
+// long lists of barely related chunks just burn tokens
+const defaultSearchCodeLimit = 10
+
+// searchCode lets the model query the index itself, with queries of its own rather than the user's question
+func (a *Agent) searchCode(ctx context.Context, in functions.SearchCodeInput) (functions.SearchCodeOutput, error) {
+	opts := rag.SearchOptions{Package: in.Package, Limit: in.Limit}
+	if opts.Limit <= 0 {
+		opts.Limit = defaultSearchCodeLimit
+	}
+	for _, kind := range in.Kinds {
+		opts.Kinds = append(opts.Kinds, golang.ChunkKind(kind))
+	}
+
+	chunks, err := a.Search(ctx, in.Query, opts)
+	if err != nil {
+		return functions.SearchCodeOutput{}, err
+	}
+
+	out := functions.SearchCodeOutput{Results: make([]functions.SearchResult, 0, len(chunks))}
+	for _, chunk := range chunks {
+		out.Results = append(out.Results, functions.SearchResult{
+			Name:       chunk.Name,
+			Kind:       chunk.Kind.String(),
+			Package:    chunk.Package,
+			Path:       a.cfg.Workspace.Display(chunk.FilePath),
+			StartLine:  chunk.StartLine,
+			EndLine:    chunk.EndLine,
+			Similarity: math.Round((1-chunk.Distance)*1000) / 1000,
+		})
+	}
+
+	return out, nil
+}
+
+// Search returns the indexed chunks most similar to a query in the workspace's snapshot
+func (a *Agent) Search(ctx context.Context, query string, opts rag.SearchOptions) ([]rag.SimilarChunk, error) {
+	snapshot, vec, err := a.embedQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, err := a.ragStore.FindSimilarChunks(ctx, snapshot.ID, vec, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search the index: %w", err)
+	}
+	return chunks, nil
+}
+
+// Snapshot returns the latest snapshot of the workspace's repository, rag.ErrNoSnapshot if it wasn't indexed yet
+func (a *Agent) Snapshot(ctx context.Context) (rag.Snapshot, error) {
+	return a.ragStore.LatestSnapshot(ctx, a.cfg.Workspace.Root())
+}
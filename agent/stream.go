@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Stream receives an answer while it's being generated
+type Stream interface {
+	// Delta receives the next piece of the answer
+	Delta(text string)
+
+	// Status receives progress that isn't part of the answer, like tools being called
+	Status(text string)
+}
+
+// TerminalStream prints answers as they arrive, with status lines dimmed in between
+type TerminalStream struct {
+	w io.Writer
+
+	// midLine is set when the last delta didn't end with a newline
+	midLine bool
+}
+
+func NewTerminalStream(w io.Writer) *TerminalStream {
+	return &TerminalStream{w: w}
+}
+
+func (s *TerminalStream) Delta(text string) {
+	if text == "" {
+		return
+	}
+	fmt.Fprint(s.w, text)
+	s.midLine = !strings.HasSuffix(text, "\n")
+}
+
+func (s *TerminalStream) Status(text string) {
+	if s.midLine {
+		fmt.Fprintln(s.w)
+		s.midLine = false
+	}
+	fmt.Fprintf(s.w, "\033[2m» %s\033[0m\n", text)
+}
+
+// Finish terminates the last line of the answer
+func (s *TerminalStream) Finish() {
+	if s.midLine {
+		fmt.Fprintln(s.w)
+		s.midLine = false
+	}
+}
+
+// discardStream is used when the caller is only interested in the final answer
+type discardStream struct{}
+
+func (discardStream) Delta(string)  {}
+func (discardStream) Status(string) {}
+
+// statusStream only forwards status updates, for answers that are parsed rather than shown as they arrive
+type statusStream struct {
+	Stream
+}
+
+func (statusStream) Delta(string) {}
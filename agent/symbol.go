@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/language/golang"
+	"github.com/sajuno/goon/rag"
+	"regexp"
+	"strings"
+)
+
+// Symbol is a parsed reference to a declaration like rag.PGStore.FindSimilarChunks
+type Symbol struct {
+	// Package is an import path or a trailing part of one, empty when only a name was given
+	Package string
+
+	// Receiver is the receiver type of a method
+	Receiver string
+	Name     string
+}
+
+func (s Symbol) String() string {
+	parts := make([]string, 0, 3)
+	for _, p := range []string{s.Package, s.Receiver, s.Name} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// ParseSymbol parses [import/path.]Name or [import/path.]Type.Method, the package can be shortened to its last
+// elements like rag or goon/rag
+func ParseSymbol(s string) (Symbol, error) {
+	dir, rest := "", s
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		dir, rest = s[:i+1], s[i+1:]
+	}
+
+	parts := strings.Split(rest, ".")
+	for _, p := range parts {
+		if p == "" {
+			return Symbol{}, fmt.Errorf("invalid symbol %q", s)
+		}
+	}
+
+	switch len(parts) {
+	case 1:
+		if dir != "" {
+			return Symbol{}, fmt.Errorf("invalid symbol %q, missing a name after the package", s)
+		}
+		return Symbol{Name: parts[0]}, nil
+	case 2:
+		return Symbol{Package: dir + parts[0], Name: parts[1]}, nil
+	case 3:
+		return Symbol{Package: dir + parts[0], Receiver: parts[1], Name: parts[2]}, nil
+	default:
+		return Symbol{}, fmt.Errorf("invalid symbol %q, use package.Name or package.Type.Method", s)
+	}
+}
+
+// receiverPattern matches the receiver of a method declaration, capturing the type name
+var receiverPattern = regexp.MustCompile(`^func\s*\(\s*(?:\w+\s+)?\*?\s*(\w+)`)
+
+// findSymbol looks a symbol up in the index. The chunk is re-read from its file when it changed since indexing.
+func (a *Agent) findSymbol(ctx context.Context, sym Symbol) (golang.Chunk, error) {
+	snapshot, err := a.Snapshot(ctx)
+	if err != nil {
+		return golang.Chunk{}, err
+	}
+
+	candidates, err := a.ragStore.FindChunks(ctx, snapshot.ID, rag.ChunkQuery{Package: sym.Package, Name: sym.Name})
+	if err != nil {
+		return golang.Chunk{}, fmt.Errorf("failed to look up %s: %w", sym, err)
+	}
+
+	var matches []golang.Chunk
+	for _, c := range candidates {
+		// the query matches subpackages as well, a symbol names exactly one package
+		if sym.Package != "" && c.Package != sym.Package && !strings.HasSuffix(c.Package, "/"+sym.Package) {
+			continue
+		}
+		m := receiverPattern.FindStringSubmatch(c.Content)
+		isMethod := m != nil
+		if isMethod != (sym.Receiver != "") || (isMethod && m[1] != sym.Receiver) {
+			continue
+		}
+		matches = append(matches, c.Chunk)
+	}
+
+	switch len(matches) {
+	case 0:
+		return golang.Chunk{}, fmt.Errorf("%s not found in the index", sym)
+	case 1:
+	default:
+		var names []string
+		for _, m := range matches {
+			names = append(names, fmt.Sprintf("%s (%s:%d)", m.Package, a.cfg.Workspace.Display(m.FilePath), m.StartLine))
+		}
+		return golang.Chunk{}, fmt.Errorf("%s is ambiguous, qualify the package: %s", sym, strings.Join(names, ", "))
+	}
+
+	return a.refreshChunk(ctx, matches[0])
+}
+
+// refreshChunk returns the current version of an indexed chunk, matched by name and kind in its file
+func (a *Agent) refreshChunk(ctx context.Context, chunk golang.Chunk) (golang.Chunk, error) {
+	current, err := a.fileChunks(ctx, chunk.FilePath)
+	if err != nil {
+		return golang.Chunk{}, err
+	}
+
+	wantReceiver := receiverPattern.FindStringSubmatch(chunk.Content)
+	for _, c := range current {
+		if c.Name != chunk.Name || c.Kind != chunk.Kind {
+			continue
+		}
+		receiver := receiverPattern.FindStringSubmatch(c.Content)
+		if (receiver == nil) != (wantReceiver == nil) || (receiver != nil && receiver[1] != wantReceiver[1]) {
+			continue
+		}
+		c.Package = chunk.Package
+		return c, nil
+	}
+
+	return golang.Chunk{}, errors.New(chunk.Name + " no longer exists, re-index the repository")
+}
@@ -0,0 +1,360 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/language/golang"
+	"github.com/sajuno/goon/openai/tools/functions"
+	"github.com/sajuno/goon/session"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultTestAttempts is how often a generated test is handed back to the model when it doesn't pass
+	DefaultTestAttempts = 3
+
+	// maxExistingTests caps the existing tests shown as examples of the house style
+	maxExistingTests = 12 * 1024
+
+	// maxTestDependencies caps the declarations of callees sent along with the symbol
+	maxTestDependencies = 16 * 1024
+)
+
+// ErrGoToolsDisabled is returned when generating tests while go_tools are disabled, generated tests are run
+// to verify them and tests execute arbitrary code
+var ErrGoToolsDisabled = errors.New("generated tests are run to verify them, set go_tools.enabled to allow running code")
+
+// goCodeBlock matches the first fenced Go code block of an answer
+var goCodeBlock = regexp.MustCompile("(?s)```go\\s*\\n(.*?)```")
+
+// GeneratedTest is a test file that passed go vet and go test, it isn't written to the workspace until its
+// changes are applied with ApplyChanges
+type GeneratedTest struct {
+	// Path is relative to the repository root
+	Path     string
+	Tests    []string
+	Attempts int
+
+	// Changes create the test file
+	Changes *ChangeSet
+}
+
+// GenerateTest generates a table-driven test for a function or method, like rag.PGStore.FindChunks. The test is vetted
+// and run with the test file overlaid on the workspace, failures are handed back to the model up to attempts times.
+// Running the test requires go_tools to be enabled, ErrGoToolsDisabled is returned otherwise.
+func (a *Agent) GenerateTest(ctx context.Context, symbol string, attempts int, out Stream) (*GeneratedTest, error) {
+	if out == nil {
+		out = discardStream{}
+	}
+	if attempts <= 0 {
+		attempts = DefaultTestAttempts
+	}
+
+	sym, err := ParseSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	out.Status(fmt.Sprintf("looking up %s", sym))
+	chunk, err := a.findSymbol(ctx, sym)
+	if err != nil {
+		return nil, err
+	}
+	return a.generateTest(ctx, chunk, sym.String(), attempts, out)
+}
+
+// GenerateTestAt is GenerateTest for the function or method enclosing a location
+func (a *Agent) GenerateTestAt(ctx context.Context, loc Location, attempts int, out Stream) (*GeneratedTest, error) {
+	if out == nil {
+		out = discardStream{}
+	}
+	if attempts <= 0 {
+		attempts = DefaultTestAttempts
+	}
+
+	abs, err := a.cfg.Workspace.Abs(loc.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	out.Status("looking up " + loc.String())
+	chunks, err := a.fileChunks(ctx, abs)
+	if err != nil {
+		return nil, err
+	}
+	chunk := enclosingChunk(chunks, loc.Line)
+	if chunk == nil {
+		return nil, fmt.Errorf("%s is not within a declaration", loc)
+	}
+	return a.generateTest(ctx, *chunk, chunk.Name, attempts, out)
+}
+
+func (a *Agent) generateTest(ctx context.Context, chunk golang.Chunk, sym string, attempts int, out Stream) (*GeneratedTest, error) {
+	if !a.cfg.GoTools.Enabled {
+		return nil, ErrGoToolsDisabled
+	}
+	if !chunk.IsInvokable() {
+		return nil, fmt.Errorf("%s is a %s, tests can only be generated for functions and methods", sym, chunk.Kind)
+	}
+
+	pkgName, err := packageName(chunk.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(chunk.FilePath)
+	pkgDir, err := a.goPackage(a.cfg.Workspace.Display(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	testPath := testFilePath(chunk)
+	if _, err := os.Stat(testPath); err == nil {
+		return nil, fmt.Errorf("%s already exists", a.cfg.Workspace.Display(testPath))
+	}
+	testRel, err := a.cfg.Workspace.Rel(testPath)
+	if err != nil {
+		return nil, err
+	}
+
+	out.Status("collecting context")
+	prompt := fmt.Sprintf(`
+# Function under test
+
+%s
+
+%s
+Write tests for %s in a new file %s, in package %s.
+
+Follow the conventions of the existing tests: same packages and helpers, same naming and assertion style.
+Write table-driven tests with t.Run subtests, cover the edge cases and error paths of the function, and only use
+the standard library and modules the repository already requires. Don't touch the network, a database or
+anything else outside of the test's temporary directories.
+
+Respond with the complete test file in a single go code block and nothing else.
+`, a.testGenContext(ctx, chunk, dir, out), goModRequires(a.cfg.Workspace.Root()), sym, testRel, pkgName)
+
+	sess := session.New()
+	for attempt := 1; attempt <= attempts; attempt++ {
+		out.Status(fmt.Sprintf("writing tests, attempt %d of %d", attempt, attempts))
+		answer, err := a.promptAI(ctx, sess, prompt, statusStream{out})
+		if err != nil {
+			return nil, err
+		}
+
+		code, tests, err := parseTestFile(answer, pkgName)
+		if err != nil {
+			prompt = fmt.Sprintf("%v. Respond with the complete test file in a single go code block.", err)
+			continue
+		}
+
+		file := fileChange{path: testRel, new: []byte(code), created: true}
+
+		out.Status(fmt.Sprintf("verifying %s", strings.Join(tests, ", ")))
+		result, err := a.verifyTest(ctx, pkgDir, file, tests)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			summary := fmt.Sprintf("%s with %s", file.path, strings.Join(tests, ", "))
+			return &GeneratedTest{
+				Path:     file.path,
+				Tests:    tests,
+				Attempts: attempt,
+				Changes:  newChangeSet(summary, nil, []fileChange{file}),
+			}, nil
+		}
+
+		feedback, _ := json.Marshal(result)
+		prompt = fmt.Sprintf("The tests don't pass, this is the output of %s:\n\n%s\n\nFix the tests, don't change the "+
+			"behaviour they expect unless the expectation is wrong. Respond with the complete test file in a single go code block.",
+			result.Command, feedback)
+	}
+
+	return nil, fmt.Errorf("no passing tests for %s after %d attempts", sym, attempts)
+}
+
+// testGenContext formats the function, the declarations it calls and the existing tests of its package
+func (a *Agent) testGenContext(ctx context.Context, chunk golang.Chunk, dir string, out Stream) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("## %s (%s:%d-%d)\n\n```go\n%s\n```\n\n",
+		chunk.Name, a.cfg.Workspace.Display(chunk.FilePath), chunk.StartLine, chunk.EndLine, chunk.Content))
+
+	_, callees, err := a.callNeighbours(chunk, maxCallNeighbours)
+	if err != nil {
+		out.Status(fmt.Sprintf("no call hierarchy for %s: %v", chunk.Name, err))
+	}
+
+	var size int
+	for _, callee := range callees {
+		decl, ok := a.chunkAt(ctx, callee)
+		if !ok || size+len(decl.Content) > maxTestDependencies {
+			continue
+		}
+		if size == 0 {
+			sb.WriteString("# Dependencies\n\n")
+		}
+		size += len(decl.Content)
+		sb.WriteString(fmt.Sprintf("## %s (%s:%d)\n\n```go\n%s\n```\n\n", decl.Name, callee.Path, decl.StartLine, decl.Content))
+	}
+
+	existing := existingTests(dir, maxExistingTests)
+	if existing == "" {
+		sb.WriteString("# Existing tests\n\nThe package has no tests yet.\n\n")
+	} else {
+		sb.WriteString("# Existing tests\n\n" + existing)
+	}
+
+	return sb.String()
+}
+
+// chunkAt returns the declaration containing a call hierarchy item
+func (a *Agent) chunkAt(ctx context.Context, n callNeighbour) (golang.Chunk, bool) {
+	path, err := a.cfg.Workspace.Abs(n.Path)
+	if err != nil {
+		return golang.Chunk{}, false
+	}
+	chunks, err := a.fileChunks(ctx, path)
+	if err != nil {
+		return golang.Chunk{}, false
+	}
+	for _, c := range chunks {
+		if c.StartLine <= n.Line && n.Line <= c.EndLine {
+			return c, true
+		}
+	}
+	return golang.Chunk{}, false
+}
+
+// verifyTest vets the package with the test file overlaid and runs its tests, a failure is returned as the output
+// of the failing command and nil if the tests pass. The test file isn't written to the workspace.
+func (a *Agent) verifyTest(ctx context.Context, pkg string, file fileChange, tests []string) (*functions.GoCommandOutput, error) {
+	overlay, err := a.newGoOverlay([]fileChange{file})
+	if err != nil {
+		return nil, err
+	}
+	defer overlay.close()
+
+	run, err := a.runGo(ctx, "vet", "-overlay="+overlay.path, pkg)
+	if err != nil {
+		return nil, err
+	}
+	if vet := a.goCommandOutput(run, run.stdout, run.stderr); !vet.Success {
+		overlay.mapPaths(&vet)
+		return &vet, nil
+	}
+
+	run, err = a.runGo(ctx, "test", "-json", "-count=1", "-overlay="+overlay.path, "-run=^("+strings.Join(tests, "|")+")$", pkg)
+	if err != nil {
+		return nil, err
+	}
+	events, rest := parseTestEvents(run.stdout)
+	test := a.goCommandOutput(run, rest, run.stderr)
+	test.FailedTests, test.PassedTests = events.failed, events.passed
+	if len(test.FailedTests) > maxFailedTests {
+		test.FailedTests, test.Truncated = test.FailedTests[:maxFailedTests], true
+	}
+	if !test.Success {
+		overlay.mapPaths(&test)
+		return &test, nil
+	}
+	return nil, nil
+}
+
+// parseTestFile extracts the test file from an answer and returns the names of its tests
+func parseTestFile(answer, pkgName string) (string, []string, error) {
+	code := answer
+	if m := goCodeBlock.FindStringSubmatch(answer); m != nil {
+		code = m[1]
+	}
+
+	f, err := parser.ParseFile(token.NewFileSet(), "generated_test.go", code, parser.SkipObjectResolution)
+	if err != nil {
+		return "", nil, fmt.Errorf("the test file doesn't parse: %w", err)
+	}
+	if name := f.Name.Name; name != pkgName && name != pkgName+"_test" {
+		return "", nil, fmt.Errorf("the test file is in package %s instead of %s", name, pkgName)
+	}
+
+	var tests []string
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && strings.HasPrefix(fn.Name.Name, "Test") && fn.Name.Name != "TestMain" {
+			tests = append(tests, fn.Name.Name)
+		}
+	}
+	if len(tests) == 0 {
+		return "", nil, errors.New("the test file has no Test functions")
+	}
+
+	return strings.TrimSpace(code) + "\n", tests, nil
+}
+
+// testFilePath is <file>_test.go next to the chunk's file, or <file>_<name>_test.go if that one exists already
+func testFilePath(chunk golang.Chunk) string {
+	base := strings.TrimSuffix(chunk.FilePath, ".go")
+	if _, err := os.Stat(base + "_test.go"); err != nil {
+		return base + "_test.go"
+	}
+	return base + "_" + strings.ToLower(chunk.Name) + "_test.go"
+}
+
+func packageName(path string) (string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return f.Name.Name, nil
+}
+
+// existingTests concatenates the test files of a directory up to limit bytes
+func existingTests(dir string, limit int) string {
+	files, err := filepath.Glob(filepath.Join(dir, "*_test.go"))
+	if err != nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, path := range files {
+		b, err := os.ReadFile(path)
+		if err != nil || sb.Len()+len(b) > limit {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("## %s\n\n```go\n%s\n```\n\n", filepath.Base(path), b))
+	}
+	return sb.String()
+}
+
+// goModRequires lists the modules the repository requires, so generated tests don't import anything else
+func goModRequires(root string) string {
+	b, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return ""
+	}
+
+	var requires []string
+	inBlock := false
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "require (":
+			inBlock = true
+		case inBlock && line == ")":
+			inBlock = false
+		case inBlock && line != "":
+			requires = append(requires, "- "+strings.TrimSuffix(line, " // indirect"))
+		case strings.HasPrefix(line, "require "):
+			requires = append(requires, "- "+strings.TrimPrefix(line, "require "))
+		}
+	}
+	if len(requires) == 0 {
+		return ""
+	}
+	return "# Required modules\n\n" + strings.Join(requires, "\n") + "\n\n"
+}
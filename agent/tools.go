@@ -0,0 +1,338 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"github.com/sajuno/goon/language/lsp"
+	"github.com/sajuno/goon/openai/tools/functions"
+	"github.com/sashabaranov/go-openai"
+)
+
+// toolOutput is the result of a single tool call, regardless of the backend that requested it
+type toolOutput struct {
+	CallID string
+	Output string
+}
+
+// callTools executes the tool calls the model requested, failing calls are reported to the model rather than aborting
+func (a *Agent) callTools(ctx context.Context, calls []openai.ToolCall, out Stream) []toolOutput {
+	outputs := make([]toolOutput, 0, len(calls))
+	for _, call := range calls {
+		out.Status(fmt.Sprintf("%s(%s)", call.Function.Name, call.Function.Arguments))
+
+		outputs = append(outputs, toolOutput{
+			CallID: call.ID,
+			Output: a.tools.Call(ctx, call.Function.Name, call.Function.Arguments),
+		})
+	}
+	return outputs
+}
+
+// newToolRegistry declares the tools the model can call, the examples double as documentation for the model.
+// They use placeholders like pkg/file.go, goon's own paths don't exist in the repositories it's used on.
+func (a *Agent) newToolRegistry() *functions.Registry {
+	tools := []functions.Tool{
+		functions.NewTool("search_code",
+			"Semantic search over the indexed code, returns the best matching declarations with their paths and line ranges. Search as often as you need with specific queries, then read the results with read_file",
+			a.searchCode,
+			functions.SearchCodeInput{Query: "where requests are authenticated", Package: "pkg", Kinds: []string{"func", "method"}, Limit: 5},
+		),
+		functions.NewTool("read_file",
+			"Read a file, or a 1-based inclusive line range of it. Lines are prefixed with their number, Go files are opened in the language server automatically",
+			a.readFile,
+			functions.ReadFileInput{Path: "pkg/file.go", StartLine: 1, EndLine: 40},
+		),
+		functions.NewTool("list_directory",
+			"List a directory relative to the repository root, use an empty path for the root",
+			a.listDirectory,
+			functions.ListDirectoryInput{Path: "pkg"},
+		),
+		functions.NewTool("grep",
+			"Search files in the repository for a Go regular expression, optionally within a directory",
+			a.grep,
+			functions.GrepInput{Pattern: `func \(.*\) Name\(`, Path: ""},
+		),
+		functions.NewTool("did_open",
+			"Sends a notification that a text document has been opened (LSP's textDocument/didOpen). Rarely needed, read_file opens Go files automatically",
+			a.didOpen,
+		),
+		functions.NewTool("go_to_definition",
+			"Find the definition of a symbol at a given position (LSP's textDocument/definition)",
+			a.goToDefinition,
+			functions.GoToDefinitionInput{URI: "pkg/file.go", Line: 20, Character: 12},
+		),
+		functions.NewTool("find_references",
+			"Find all references to a symbol at a given position in a document (LSP's textDocument/references)",
+			a.findReferences,
+			functions.FindReferencesInput{URI: "pkg/file.go", Line: 17, Character: 1},
+		),
+		functions.NewTool("hover",
+			"Get the type, signature and documentation of the symbol at a given position (LSP's textDocument/hover)",
+			a.hover,
+			functions.HoverInput{URI: "pkg/file.go", Line: 17, Character: 1},
+		),
+		functions.NewTool("signature_help",
+			"Get the signature and parameter documentation of the function being called at a given position (LSP's textDocument/signatureHelp)",
+			a.signatureHelp,
+		),
+		functions.NewTool("document_symbols",
+			"List the symbols declared in a document with their kinds and ranges (LSP's textDocument/documentSymbol)",
+			a.documentSymbols,
+			functions.DocumentSymbolsInput{URI: "pkg/file.go"},
+		),
+		functions.NewTool("workspace_symbol",
+			"Search symbols across the workspace by name, returns their paths and positions (LSP's workspace/symbol). Use it to go from a name to a location",
+			a.workspaceSymbol,
+			functions.WorkspaceSymbolInput{Query: "Name"},
+		),
+		functions.NewTool("find_implementations",
+			"Find the implementations of an interface or interface method at a given position, or the interfaces a type implements (LSP's textDocument/implementation)",
+			a.findImplementations,
+		),
+		functions.NewTool("go_to_type_definition",
+			"Find the definition of the type of the symbol at a given position (LSP's textDocument/typeDefinition)",
+			a.goToTypeDefinition,
+		),
+		functions.NewTool("incoming_calls",
+			"Find the functions and methods calling the function at a given position (LSP's callHierarchy/incomingCalls)",
+			a.incomingCalls,
+		),
+		functions.NewTool("outgoing_calls",
+			"Find the functions and methods called by the function at a given position (LSP's callHierarchy/outgoingCalls)",
+			a.outgoingCalls,
+		),
+		functions.NewTool("rename_symbol",
+			"Rename the identifier at a given position everywhere it's used, with gopls (LSP's textDocument/rename). Prefer it over editing by hand, the user reviews the resulting patch before it's applied",
+			a.renameSymbol,
+			functions.RenameSymbolInput{URI: "pkg/file.go", Line: 13, Character: 5, NewName: "NewName"},
+		),
+		functions.NewTool("code_actions",
+			"List the quick fixes and refactorings gopls offers for a range of lines, like fixing imports, filling structs or extracting functions (LSP's textDocument/codeAction)",
+			a.codeActions,
+			functions.CodeActionsInput{URI: "pkg/file.go", StartLine: 20, EndLine: 30},
+		),
+		functions.NewTool("apply_code_action",
+			"Apply one of the actions code_actions returned, by its title. The user reviews the resulting patch before it's applied",
+			a.applyCodeAction,
+		),
+		functions.NewTool("diagnostics",
+			"Get the compiler errors, vet findings and lints the language server published for a document, or for every document when uri is empty (LSP's textDocument/publishDiagnostics)",
+			a.diagnostics,
+			functions.DiagnosticsInput{URI: ""},
+		),
+	}
+
+	if a.cfg.GoTools.Enabled {
+		tools = append(tools,
+			functions.NewTool("go_build",
+				"Compile a package with go build, returns the build errors with their file and line",
+				a.goBuild,
+				functions.GoPackageInput{Package: "./pkg"},
+			),
+			functions.NewTool("go_vet",
+				"Run go vet on a package, returns its findings with their file and line",
+				a.goVet,
+				functions.GoPackageInput{Package: "./..."},
+			),
+			functions.NewTool("go_test",
+				"Run the tests of a package with go test -run, returns the failed tests with their output and the amount of passed tests",
+				a.goTest,
+				functions.GoTestInput{Package: "./pkg", Run: "TestName"},
+			),
+			functions.NewTool("go_doc",
+				"Show the documentation of a package or symbol with go doc, including the standard library and dependencies",
+				a.goDoc,
+				functions.GoDocInput{Symbol: "pkg.Type"},
+			),
+		)
+	}
+
+	return functions.MustNewRegistry(tools...)
+}
+
+func (a *Agent) didOpen(_ context.Context, in functions.DidOpenInput) (functions.DidOpenOutput, error) {
+	uri, err := a.cfg.Workspace.URI(in.URI)
+	if err != nil {
+		return functions.DidOpenOutput{}, err
+	}
+	return functions.DidOpenOutput{}, a.lsp.DidOpen(uri, in.LangID, in.Text, in.Version)
+}
+
+func (a *Agent) goToDefinition(_ context.Context, in functions.GoToDefinitionInput) (functions.GoToDefinitionOutput, error) {
+	uri, err := a.cfg.Workspace.URI(in.URI)
+	if err != nil {
+		return functions.GoToDefinitionOutput{}, err
+	}
+
+	location, err := a.lsp.GoToDefinition(uri, in.Line, in.Character)
+	if err != nil {
+		return functions.GoToDefinitionOutput{}, err
+	}
+	if location != nil {
+		location.URI = a.cfg.Workspace.Display(location.URI)
+	}
+	return functions.GoToDefinitionOutput{Location: location}, nil
+}
+
+func (a *Agent) findReferences(_ context.Context, in functions.FindReferencesInput) (functions.FindReferencesOutput, error) {
+	uri, err := a.cfg.Workspace.URI(in.URI)
+	if err != nil {
+		return functions.FindReferencesOutput{}, err
+	}
+
+	locations, err := a.lsp.FindReferences(uri, in.Line, in.Character)
+	if err != nil {
+		return functions.FindReferencesOutput{}, err
+	}
+	return functions.FindReferencesOutput{Locations: a.displayLocations(locations)}, nil
+}
+
+func (a *Agent) hover(_ context.Context, in functions.HoverInput) (functions.HoverOutput, error) {
+	uri, err := a.cfg.Workspace.URI(in.URI)
+	if err != nil {
+		return functions.HoverOutput{}, err
+	}
+
+	hover, err := a.lsp.Hover(uri, in.Line, in.Character)
+	return functions.HoverOutput{Hover: hover}, err
+}
+
+func (a *Agent) signatureHelp(_ context.Context, in functions.SignatureHelpInput) (functions.SignatureHelpOutput, error) {
+	uri, err := a.cfg.Workspace.URI(in.URI)
+	if err != nil {
+		return functions.SignatureHelpOutput{}, err
+	}
+
+	help, err := a.lsp.SignatureHelp(uri, in.Line, in.Character)
+	return functions.SignatureHelpOutput{SignatureHelp: help}, err
+}
+
+func (a *Agent) documentSymbols(_ context.Context, in functions.DocumentSymbolsInput) (functions.DocumentSymbolsOutput, error) {
+	uri, err := a.cfg.Workspace.URI(in.URI)
+	if err != nil {
+		return functions.DocumentSymbolsOutput{}, err
+	}
+
+	symbols, err := a.lsp.DocumentSymbols(uri)
+	return functions.DocumentSymbolsOutput{Symbols: functions.NewDocumentSymbols(symbols)}, err
+}
+
+func (a *Agent) workspaceSymbol(_ context.Context, in functions.WorkspaceSymbolInput) (functions.WorkspaceSymbolOutput, error) {
+	symbols, err := a.lsp.WorkspaceSymbol(in.Query)
+	if err != nil {
+		return functions.WorkspaceSymbolOutput{}, err
+	}
+
+	out := functions.WorkspaceSymbolOutput{Symbols: make([]functions.SymbolInformation, 0, len(symbols))}
+	for _, sym := range symbols {
+		sym.Location.URI = a.cfg.Workspace.Display(sym.Location.URI)
+		out.Symbols = append(out.Symbols, functions.NewSymbolInformation(sym))
+	}
+	return out, nil
+}
+
+func (a *Agent) findImplementations(_ context.Context, in functions.FindImplementationsInput) (functions.FindImplementationsOutput, error) {
+	uri, err := a.cfg.Workspace.URI(in.URI)
+	if err != nil {
+		return functions.FindImplementationsOutput{}, err
+	}
+
+	locations, err := a.lsp.Implementation(uri, in.Line, in.Character)
+	if err != nil {
+		return functions.FindImplementationsOutput{}, err
+	}
+	return functions.FindImplementationsOutput{Locations: a.displayLocations(locations)}, nil
+}
+
+func (a *Agent) goToTypeDefinition(_ context.Context, in functions.GoToTypeDefinitionInput) (functions.GoToTypeDefinitionOutput, error) {
+	uri, err := a.cfg.Workspace.URI(in.URI)
+	if err != nil {
+		return functions.GoToTypeDefinitionOutput{}, err
+	}
+
+	locations, err := a.lsp.TypeDefinition(uri, in.Line, in.Character)
+	if err != nil {
+		return functions.GoToTypeDefinitionOutput{}, err
+	}
+	return functions.GoToTypeDefinitionOutput{Locations: a.displayLocations(locations)}, nil
+}
+
+func (a *Agent) incomingCalls(_ context.Context, in functions.CallHierarchyInput) (functions.IncomingCallsOutput, error) {
+	out := functions.IncomingCallsOutput{}
+	err := a.forCallHierarchy(in, func(item lsp.CallHierarchyItem) error {
+		calls, err := a.lsp.IncomingCalls(item)
+		for _, call := range calls {
+			out.Calls = append(out.Calls, functions.IncomingCall{From: a.displayCallHierarchyItem(call.From), FromRanges: call.FromRanges})
+		}
+		return err
+	})
+	return out, err
+}
+
+func (a *Agent) outgoingCalls(_ context.Context, in functions.CallHierarchyInput) (functions.OutgoingCallsOutput, error) {
+	out := functions.OutgoingCallsOutput{}
+	err := a.forCallHierarchy(in, func(item lsp.CallHierarchyItem) error {
+		calls, err := a.lsp.OutgoingCalls(item)
+		for _, call := range calls {
+			out.Calls = append(out.Calls, functions.OutgoingCall{To: a.displayCallHierarchyItem(call.To), FromRanges: call.FromRanges})
+		}
+		return err
+	})
+	return out, err
+}
+
+func (a *Agent) diagnostics(_ context.Context, in functions.DiagnosticsInput) (functions.DiagnosticsOutput, error) {
+	out := functions.DiagnosticsOutput{}
+	if in.URI != "" {
+		uri, err := a.cfg.Workspace.URI(in.URI)
+		if err != nil {
+			return out, err
+		}
+		out.Documents = append(out.Documents, functions.DocumentDiagnostics{URI: a.cfg.Workspace.Display(uri), Diagnostics: a.lsp.Diagnostics(uri)})
+		return out, nil
+	}
+
+	for uri, diags := range a.lsp.AllDiagnostics() {
+		out.Documents = append(out.Documents, functions.DocumentDiagnostics{URI: a.cfg.Workspace.Display(uri), Diagnostics: diags})
+	}
+	return out, nil
+}
+
+// forCallHierarchy prepares the call hierarchy at the input's position and calls fn for every resulting item
+func (a *Agent) forCallHierarchy(in functions.CallHierarchyInput, fn func(item lsp.CallHierarchyItem) error) error {
+	uri, err := a.cfg.Workspace.URI(in.URI)
+	if err != nil {
+		return err
+	}
+
+	items, err := a.lsp.PrepareCallHierarchy(uri, in.Line, in.Character)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("no function or method at %s:%d:%d", in.URI, in.Line, in.Character)
+	}
+
+	for _, item := range items {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// displayLocations rewrites the URIs of LSP locations to how the workspace displays them
+func (a *Agent) displayLocations(locations []lsp.Location) []lsp.Location {
+	for i := range locations {
+		locations[i].URI = a.cfg.Workspace.Display(locations[i].URI)
+	}
+	return locations
+}
+
+func (a *Agent) displayCallHierarchyItem(item lsp.CallHierarchyItem) functions.CallHierarchyItem {
+	item.URI = a.cfg.Workspace.Display(item.URI)
+
+	// opaque server data is meaningless to the model
+	item.Data = nil
+	return functions.NewCallHierarchyItem(item)
+}
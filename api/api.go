@@ -0,0 +1,136 @@
+// Package api holds the types of goon's HTTP API, shared by the server and the client
+package api
+
+import (
+	"time"
+)
+
+// Paths of the endpoints, all of them require a bearer token
+const (
+	PathStatus  = "/v1/status"
+	PathSearch  = "/v1/search"
+	PathExplain = "/v1/explain"
+	PathReview  = "/v1/review"
+	PathUsage   = "/v1/usage"
+)
+
+// Error is the body of every response that isn't a success
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Status describes the index the server answers from
+type Status struct {
+	SnapshotID     string    `json:"snapshot_id"`
+	Root           string    `json:"root"`
+	EmbeddingModel string    `json:"embedding_model"`
+	Dimensions     int       `json:"dimensions"`
+	IndexedAt      time.Time `json:"indexed_at"`
+}
+
+type SearchRequest struct {
+	Query string `json:"query"`
+
+	// Package filters by import path or a trailing part of one, empty searches every package
+	Package string `json:"package,omitempty"`
+
+	// Kinds filters by declaration kind, like "func" or "struct"
+	Kinds []string `json:"kinds,omitempty"`
+
+	// Limit defaults to 10 and is capped at 50
+	Limit int `json:"limit,omitempty"`
+}
+
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+}
+
+type SearchResult struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Package string `json:"package"`
+
+	// Path is relative to the indexed repository's root
+	Path string `json:"path"`
+
+	// StartLine and EndLine are 1-based
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Content   string `json:"content"`
+
+	// Similarity is 1 - cosine distance, higher is more relevant
+	Similarity float64 `json:"similarity"`
+}
+
+// ExplainRequest asks a question, answered as a stream of server-sent events.
+// SessionID continues an earlier conversation of the same user, empty starts a new one.
+type ExplainRequest struct {
+	Query     string `json:"query"`
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// Events of an explain stream, each event's data is an ExplainEvent
+const (
+	EventStatus = "status"
+	EventDelta  = "delta"
+	EventDone   = "done"
+	EventError  = "error"
+)
+
+// ExplainEvent carries Text for status and delta events, the Answer and SessionID for done
+// and the Error for error events
+type ExplainEvent struct {
+	Text      string `json:"text,omitempty"`
+	Answer    string `json:"answer,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ReviewRequest reviews a change made in the caller's checkout
+type ReviewRequest struct {
+	// Base is the branch the change is going to be merged into, it's only shown to the model
+	Base string `json:"base"`
+
+	// Diff is the change in git's unified diff format, like git diff main... prints it, with paths relative to
+	// the repository root the server indexes
+	Diff string `json:"diff"`
+}
+
+type Review struct {
+	Base    string       `json:"base"`
+	Summary string       `json:"summary"`
+	Files   []FileReview `json:"files"`
+}
+
+type FileReview struct {
+	Path     string          `json:"path"`
+	Comments []ReviewComment `json:"comments"`
+}
+
+type ReviewComment struct {
+	Path string `json:"path"`
+
+	// Line is 0 for comments on the file as a whole
+	Line int `json:"line"`
+
+	// Severity is "issue", "suggestion", "nit" or "question"
+	Severity string `json:"severity"`
+	Body     string `json:"body"`
+}
+
+// Usage is the calling user's requests since the server started, by endpoint path
+type Usage struct {
+	User      string                   `json:"user"`
+	Since     time.Time                `json:"since"`
+	Endpoints map[string]EndpointUsage `json:"endpoints"`
+}
+
+type EndpointUsage struct {
+	Requests int `json:"requests"`
+
+	// Failures are requests answered with a 4xx or 5xx status, or explain streams ending in an error
+	Failures int `json:"failures"`
+
+	// DurationMillis is the time spent answering the requests
+	DurationMillis int64 `json:"duration_millis"`
+}
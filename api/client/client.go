@@ -0,0 +1,191 @@
+// Package client calls goon's HTTP API, for internal tools sharing a team's goon server
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/api"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Error is a response of the server that isn't a success
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("goon server: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// New creates a client for the server at baseURL, like http://goon.internal:8080, authenticating with token.
+// httpClient defaults to http.DefaultClient, explain streams run as long as the answer takes so it shouldn't
+// have a timeout shorter than that.
+func New(baseURL, token string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), token: token, http: httpClient}
+}
+
+func (c *Client) Status(ctx context.Context) (*api.Status, error) {
+	var status api.Status
+	if err := c.do(ctx, http.MethodGet, api.PathStatus, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (c *Client) Search(ctx context.Context, req api.SearchRequest) (*api.SearchResponse, error) {
+	var resp api.SearchResponse
+	if err := c.do(ctx, http.MethodPost, api.PathSearch, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Review reviews the diff of a change in the caller's checkout, see api.ReviewRequest
+func (c *Client) Review(ctx context.Context, req api.ReviewRequest) (*api.Review, error) {
+	var review api.Review
+	if err := c.do(ctx, http.MethodPost, api.PathReview, req, &review); err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+// Usage returns the calling user's requests since the server started
+func (c *Client) Usage(ctx context.Context) (*api.Usage, error) {
+	var usage api.Usage
+	if err := c.do(ctx, http.MethodGet, api.PathUsage, nil, &usage); err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// Explain asks a question and returns the final event with the answer and the session ID to follow up with.
+// onEvent receives the status and delta events as they arrive and may be nil.
+func (c *Client) Explain(ctx context.Context, req api.ExplainRequest, onEvent func(event string, data api.ExplainEvent)) (*api.ExplainEvent, error) {
+	resp, err := c.send(ctx, http.MethodPost, api.PathExplain, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var (
+		event   string
+		data    strings.Builder
+		hasData bool
+	)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			continue
+		case strings.HasPrefix(line, "data:"):
+			if hasData {
+				data.WriteString("\n")
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			hasData = true
+			continue
+		case line != "":
+			// comments and fields goon doesn't send
+			continue
+		}
+
+		// an empty line dispatches the event, there's nothing to dispatch after comments like keep-alives of proxies
+		if !hasData {
+			event = ""
+			continue
+		}
+		hasData = false
+
+		var decoded api.ExplainEvent
+		if err := json.Unmarshal([]byte(data.String()), &decoded); err != nil {
+			return nil, fmt.Errorf("failed to decode %s event: %w", event, err)
+		}
+		data.Reset()
+
+		switch event {
+		case api.EventDone:
+			return &decoded, nil
+		case api.EventError:
+			return nil, &Error{StatusCode: http.StatusOK, Message: decoded.Error}
+		default:
+			if onEvent != nil {
+				onEvent(event, decoded)
+			}
+		}
+		event = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the answer: %w", err)
+	}
+	return nil, errors.New("the answer ended without a done event")
+}
+
+// do sends a JSON request and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	resp, err := c.send(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", path, err)
+	}
+	return nil
+}
+
+// send sends a request, responses that aren't a success are returned as an *Error
+func (c *Client) send(ctx context.Context, method, path string, in any) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var apiErr api.Error
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if json.Unmarshal(b, &apiErr) != nil || apiErr.Error == "" {
+		apiErr.Error = strings.TrimSpace(string(b))
+	}
+	return nil, &Error{StatusCode: resp.StatusCode, Message: apiErr.Error}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"github.com/sajuno/goon/api"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type userKey struct{}
+
+// userFrom returns the authenticated user of a request
+func userFrom(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+// authenticate rejects requests without a known bearer token and adds the token's user to the others
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		user, known := s.tokens[sha256.Sum256([]byte(token))]
+		if !ok || !known {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="goon"`)
+			writeError(w, http.StatusUnauthorized, "missing or unknown API token")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+	})
+}
+
+// account records every request of a user by endpoint and logs it
+func (s *Server) account(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		user, elapsed := userFrom(r.Context()), time.Since(start)
+		failed := rec.status >= 400 || rec.streamFailed
+		s.usage.record(user, r.URL.Path, failed, elapsed)
+		log.Printf("%s %s %s %d %s", user, r.Method, r.URL.Path, rec.status, elapsed.Round(time.Millisecond))
+	})
+}
+
+// statusRecorder keeps the status of a response. Streams are answered with 200 before they can fail,
+// their handlers mark failures on it instead.
+type statusRecorder struct {
+	http.ResponseWriter
+	status       int
+	streamFailed bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController flush the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// accounting counts requests per user and endpoint since the server started
+type accounting struct {
+	since time.Time
+
+	mu     sync.Mutex
+	byUser map[string]map[string]api.EndpointUsage
+}
+
+func newAccounting() *accounting {
+	return &accounting{since: time.Now(), byUser: make(map[string]map[string]api.EndpointUsage)}
+}
+
+func (a *accounting) record(user, path string, failed bool, elapsed time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	endpoints, ok := a.byUser[user]
+	if !ok {
+		endpoints = make(map[string]api.EndpointUsage)
+		a.byUser[user] = endpoints
+	}
+
+	usage := endpoints[path]
+	usage.Requests++
+	if failed {
+		usage.Failures++
+	}
+	usage.DurationMillis += elapsed.Milliseconds()
+	endpoints[path] = usage
+}
+
+func (a *accounting) user(user string) api.Usage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	usage := api.Usage{User: user, Since: a.since, Endpoints: make(map[string]api.EndpointUsage)}
+	for path, u := range a.byUser[user] {
+		usage.Endpoints[path] = u
+	}
+	return usage
+}
+
+// log writes the totals of every user, usage isn't persisted so this is the record of a server's run
+func (a *accounting) log() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for user, endpoints := range a.byUser {
+		for path, u := range endpoints {
+			log.Printf("usage %s %s: %d requests, %d failed, %s", user, path, u.Requests, u.Failures,
+				(time.Duration(u.DurationMillis) * time.Millisecond).Round(time.Millisecond))
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/agent"
+	"github.com/sajuno/goon/api"
+	"github.com/sajuno/goon/gitdiff"
+	"github.com/sajuno/goon/language/golang"
+	"github.com/sajuno/goon/rag"
+	"github.com/sajuno/goon/session"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+)
+
+const (
+	// maxRequestBody bounds request bodies, they're small JSON documents and diffs to review
+	maxRequestBody = 1 << 20
+
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := s.agent.Snapshot(r.Context())
+	if err != nil {
+		writeAgentError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, api.Status{
+		SnapshotID:     snapshot.ID,
+		Root:           snapshot.Root,
+		EmbeddingModel: snapshot.EmbeddingModel,
+		Dimensions:     snapshot.Dimensions,
+		IndexedAt:      snapshot.CreatedAt,
+	})
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	var req api.SearchRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		writeError(w, http.StatusBadRequest, "query is required")
+		return
+	}
+
+	opts := rag.SearchOptions{Package: req.Package, Limit: min(req.Limit, maxSearchLimit)}
+	if opts.Limit <= 0 {
+		opts.Limit = defaultSearchLimit
+	}
+	for _, kind := range req.Kinds {
+		opts.Kinds = append(opts.Kinds, golang.ChunkKind(kind))
+	}
+
+	chunks, err := s.agent.Search(r.Context(), req.Query, opts)
+	if err != nil {
+		writeAgentError(w, err)
+		return
+	}
+
+	resp := api.SearchResponse{Results: make([]api.SearchResult, 0, len(chunks))}
+	for _, chunk := range chunks {
+		resp.Results = append(resp.Results, api.SearchResult{
+			Name:       chunk.Name,
+			Kind:       chunk.Kind.String(),
+			Package:    chunk.Package,
+			Path:       s.agent.Workspace().Display(chunk.FilePath),
+			StartLine:  chunk.StartLine,
+			EndLine:    chunk.EndLine,
+			Content:    chunk.Content,
+			Similarity: math.Round((1-chunk.Distance)*1000) / 1000,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// explain streams the answer as server-sent events. Errors before the stream started are answered with a status,
+// later ones end the stream with an error event.
+func (s *Server) explain(w http.ResponseWriter, r *http.Request) {
+	var req api.ExplainRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		writeError(w, http.StatusBadRequest, "query is required")
+		return
+	}
+
+	store, err := s.sessionStore(userFrom(r.Context()))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sess := session.New()
+	if req.SessionID != "" {
+		if sess, err = store.Load(req.SessionID); err != nil {
+			if errors.Is(err, session.ErrNotFound) {
+				writeError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	events := newEventStream(w)
+	answer, err := s.agent.Explain(r.Context(), sess, req.Query, events)
+	if err != nil {
+		if rec, ok := w.(*statusRecorder); ok {
+			rec.streamFailed = true
+		}
+		events.send(api.EventError, api.ExplainEvent{Error: err.Error()})
+		return
+	}
+
+	if err := store.Save(sess); err != nil {
+		log.Printf("failed to save session %s: %v", sess.ID, err)
+	}
+	events.send(api.EventDone, api.ExplainEvent{Answer: answer, SessionID: sess.ID})
+}
+
+func (s *Server) review(w http.ResponseWriter, r *http.Request) {
+	var req api.ReviewRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Base == "" {
+		writeError(w, http.StatusBadRequest, "base is required")
+		return
+	}
+
+	// the change is reviewed as sent, the server's own checkout is somebody else's working tree
+	files, err := gitdiff.Parse(strings.NewReader(req.Diff))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid diff: %v", err))
+		return
+	}
+
+	review, err := s.agent.ReviewDiff(r.Context(), req.Base, files, nil)
+	if err != nil {
+		writeAgentError(w, err)
+		return
+	}
+
+	resp := api.Review{Base: review.Base, Summary: review.Summary, Files: make([]api.FileReview, 0, len(review.Files))}
+	for _, f := range review.Files {
+		fileReview := api.FileReview{Path: f.Path}
+		for _, c := range f.Comments {
+			fileReview.Comments = append(fileReview.Comments, api.ReviewComment{
+				Path:     c.Path,
+				Line:     c.Line,
+				Severity: string(c.Severity),
+				Body:     c.Body,
+			})
+		}
+		resp.Files = append(resp.Files, fileReview)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) userUsage(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.usage.user(userFrom(r.Context())))
+}
+
+// eventStream writes server-sent events, flushing each one so clients see the answer as it's generated.
+// It's the agent's Stream for explain.
+type eventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func newEventStream(w http.ResponseWriter) *eventStream {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	return &eventStream{w: w, rc: http.NewResponseController(w)}
+}
+
+func (e *eventStream) Delta(text string) {
+	if text != "" {
+		e.send(api.EventDelta, api.ExplainEvent{Text: text})
+	}
+}
+
+func (e *eventStream) Status(text string) {
+	e.send(api.EventStatus, api.ExplainEvent{Text: text})
+}
+
+// send writes an event, write errors mean the client went away and the request's context is cancelled
+func (e *eventStream) send(event string, data api.ExplainEvent) {
+	b, _ := json.Marshal(data)
+	if _, err := fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, b); err != nil {
+		return
+	}
+	_ = e.rc.Flush()
+}
+
+// readJSON decodes a request body, answering with 400 if it's not valid
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, api.Error{Error: message})
+}
+
+// writeAgentError answers with the status fitting an error of the agent
+func writeAgentError(w http.ResponseWriter, err error) {
+	var mismatch *rag.EmbeddingMismatchError
+	switch {
+	case errors.Is(err, rag.ErrNoSnapshot), errors.As(err, &mismatch):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, agent.ErrNoChanges):
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,175 @@
+// Package server serves goon's HTTP API, so a team can share one index and one API key
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/agent"
+	"github.com/sajuno/goon/api"
+	"github.com/sajuno/goon/session"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// DefaultShutdownTimeout is how long requests in flight get to finish when the server is stopped
+const DefaultShutdownTimeout = 30 * time.Second
+
+// userPattern restricts user names, they name the directories their sessions are kept in
+var userPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+type Config struct {
+	// Tokens maps user names to their API tokens
+	Tokens map[string]string
+
+	// SessionDir keeps the explain sessions, in a directory per user
+	SessionDir string
+
+	// ShutdownTimeout defaults to DefaultShutdownTimeout
+	ShutdownTimeout time.Duration
+
+	// TLSCertFile and TLSKeyFile serve the API over HTTPS, tokens are sent in the clear over plain HTTP
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+type Server struct {
+	agent *agent.Agent
+	cfg   Config
+
+	// tokens maps the SHA-256 of tokens to users, so comparing them doesn't leak how much of a token matched
+	tokens map[[sha256.Size]byte]string
+	usage  *accounting
+
+	mu       sync.Mutex
+	sessions map[string]*session.Store
+}
+
+func New(ag *agent.Agent, cfg Config) (*Server, error) {
+	if len(cfg.Tokens) == 0 {
+		return nil, errors.New("no API tokens configured, add users and their tokens to serve.tokens")
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, errors.New("TLS needs both a certificate and a key")
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = DefaultShutdownTimeout
+	}
+
+	s := &Server{
+		agent:    ag,
+		cfg:      cfg,
+		tokens:   make(map[[sha256.Size]byte]string, len(cfg.Tokens)),
+		usage:    newAccounting(),
+		sessions: make(map[string]*session.Store),
+	}
+	for user, token := range cfg.Tokens {
+		if !userPattern.MatchString(user) {
+			return nil, fmt.Errorf("invalid user name %q, use letters, digits, dots, dashes and underscores", user)
+		}
+		if len(token) < 16 {
+			return nil, fmt.Errorf("the token of %s is too short, use at least 16 characters", user)
+		}
+		sum := sha256.Sum256([]byte(token))
+		if other, ok := s.tokens[sum]; ok {
+			return nil, fmt.Errorf("%s and %s have the same token", other, user)
+		}
+		s.tokens[sum] = user
+	}
+
+	return s, nil
+}
+
+// Handler returns the API's routes, every one of them authenticated and accounted for
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+api.PathStatus, s.status)
+	mux.HandleFunc("POST "+api.PathSearch, s.search)
+	mux.HandleFunc("POST "+api.PathExplain, s.explain)
+	mux.HandleFunc("POST "+api.PathReview, s.review)
+	mux.HandleFunc("GET "+api.PathUsage, s.userUsage)
+
+	return s.authenticate(s.account(mux))
+}
+
+// ListenAndServe serves the API on addr until ctx is cancelled. Requests in flight then get the shutdown timeout
+// to finish, explain streams still running after it are cut off.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	// requests outlive ctx during the shutdown, they're cancelled once it's over
+	baseCtx, cancelRequests := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelRequests()
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.cfg.TLSCertFile != "" {
+			log.Printf("serving goon's API on https://%s", addr)
+			serveErr <- srv.ListenAndServeTLS(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+			return
+		}
+		if !loopback(addr) {
+			log.Printf("serving over plain HTTP on %s, tokens are readable on the network unless a TLS terminating proxy is in front", addr)
+		}
+		log.Printf("serving goon's API on http://%s", addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down, waiting up to %s for requests in flight", s.cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	err := srv.Shutdown(shutdownCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		cancelRequests()
+		err = srv.Close()
+	}
+	s.usage.log()
+	return err
+}
+
+// loopback reports whether addr only listens on the loopback interface
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// sessionStore returns the session store of a user, users only see their own sessions
+func (s *Server) sessionStore(user string) (*session.Store, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if store, ok := s.sessions[user]; ok {
+		return store, nil
+	}
+	store, err := session.NewStore(filepath.Join(s.cfg.SessionDir, user))
+	if err != nil {
+		return nil, err
+	}
+	s.sessions[user] = store
+	return store, nil
+}
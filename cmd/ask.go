@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/sajuno/goon/agent"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+func goonAsk(ctx context.Context) *cobra.Command {
+	var (
+		file      string
+		sessionID string
+		cont      bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "ask --file <path:line[:col]> [question]",
+		Short: "answers a question about the code at a location, explaining it if no question is asked",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			loc, _, err := parseLocation(file)
+			if err != nil {
+				return err
+			}
+
+			sess, err := explainSession(sessionID, cont)
+			if err != nil {
+				return err
+			}
+
+			out := agent.NewTerminalStream(os.Stdout)
+			_, err = ag.Ask(ctx, sess, loc, strings.Join(args, " "), out)
+			out.Finish()
+			if err != nil {
+				return fmt.Errorf("failed to answer: %w", err)
+			}
+
+			if err := sessions.Save(sess); err != nil {
+				return fmt.Errorf("failed to save session: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "\nsession %s, ask a follow-up with --session %s\n", sess.ShortID(), sess.ShortID())
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "Location of the code, path:line or path:line:col with 1-based line and byte column")
+	cmd.MarkFlagRequired("file")
+	cmd.Flags().StringVar(&sessionID, "session", "", "Continue the session with this (prefix of an) ID")
+	cmd.Flags().BoolVarP(&cont, "continue", "c", false, "Continue the most recent session")
+	cmd.MarkFlagsMutuallyExclusive("session", "continue")
+
+	return cmd
+}
@@ -4,13 +4,92 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/sajuno/goon/agent"
+	"github.com/sajuno/goon/api/server"
+	"github.com/sajuno/goon/rag"
+	"github.com/sashabaranov/go-openai"
 	"github.com/spf13/viper"
 )
 
 type config struct {
-	AssistantID string `mapstructure:"assistant_id"`
-	APIKey      string `mapstructure:"api_key"`
+	// Backend is either "assistants" or "chat"
+	Backend string     `mapstructure:"backend"`
+	Chat    chatConfig `mapstructure:"chat"`
+
+	// BaseURL of an OpenAI compatible API, empty uses OpenAI itself
+	BaseURL string `mapstructure:"base_url"`
+
+	AssistantID string          `mapstructure:"assistant_id"`
+	RunTimeout  time.Duration   `mapstructure:"run_timeout"`
+	APIKey      string          `mapstructure:"api_key"`
+	SessionDir  string          `mapstructure:"session_dir"`
+	Embedding   embeddingConfig `mapstructure:"embedding"`
+	Index       indexConfig     `mapstructure:"index"`
+	GoTools     goToolsConfig   `mapstructure:"go_tools"`
+	Serve       serveConfig     `mapstructure:"serve"`
+}
+
+type chatConfig struct {
+	Model         string `mapstructure:"model"`
+	MaxToolRounds int    `mapstructure:"max_tool_rounds"`
+	HistoryTokens int    `mapstructure:"history_tokens"`
+}
+
+type embeddingConfig struct {
+	// Model is the OpenAI embedding model used for both indexing and querying
+	Model string `mapstructure:"model"`
+
+	// Dimensions optionally shortens the embeddings, only supported by text-embedding-3 and later.
+	// 0 uses the model's native dimensions
+	Dimensions int `mapstructure:"dimensions"`
+
+	// Encoding is the tiktoken encoding used to count tokens, derived from Model when empty
+	Encoding string `mapstructure:"encoding"`
+}
+
+// indexConfig configures pgvector's approximate nearest neighbour index
+type indexConfig struct {
+	// Method is either "hnsw" or "ivfflat"
+	Method string `mapstructure:"method"`
+
+	M              int `mapstructure:"m"`
+	EfConstruction int `mapstructure:"ef_construction"`
+
+	// Lists for ivfflat, 0 sizes it from the row count
+	Lists int `mapstructure:"lists"`
+
+	// Query-time settings
+	EfSearch int `mapstructure:"ef_search"`
+	Probes   int `mapstructure:"probes"`
+}
+
+// goToolsConfig opts into letting the model run go build, vet, test and doc
+type goToolsConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// serveConfig configures goon serve
+type serveConfig struct {
+	// Addr defaults to the loopback interface, listening on others needs TLS or a TLS terminating proxy in front
+	Addr string `mapstructure:"addr"`
+
+	// TLSCert and TLSKey are PEM files, the API is served over plain HTTP without them
+	TLSCert string `mapstructure:"tls_cert"`
+	TLSKey  string `mapstructure:"tls_key"`
+
+	// Tokens are a list rather than a map since viper lowercases map keys, which would change user names.
+	// Keep the goon.toml holding them readable by the server only
+	Tokens []serveToken `mapstructure:"tokens"`
+
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+}
+
+type serveToken struct {
+	User  string `mapstructure:"user"`
+	Token string `mapstructure:"token"`
 }
 
 var cfg *config
@@ -22,7 +101,30 @@ func loadConfig() error {
 
 	viper.SetEnvPrefix("GOON")
 	viper.AutomaticEnv()
-	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_", ".", "_"))
+
+	viper.SetDefault("backend", string(agent.BackendAssistants))
+	viper.SetDefault("chat.model", openai.GPT4o)
+	viper.SetDefault("chat.max_tool_rounds", 20)
+	viper.SetDefault("chat.history_tokens", agent.DefaultHistoryTokens)
+	viper.SetDefault("run_timeout", 5*time.Minute)
+	viper.SetDefault("embedding.model", string(openai.SmallEmbedding3))
+	viper.SetDefault("embedding.dimensions", 0)
+	viper.SetDefault("embedding.encoding", "")
+
+	viper.SetDefault("go_tools.enabled", false)
+	viper.SetDefault("go_tools.timeout", 2*time.Minute)
+
+	viper.SetDefault("serve.addr", "127.0.0.1:8080")
+	viper.SetDefault("serve.shutdown_timeout", server.DefaultShutdownTimeout)
+
+	indexDefaults := rag.DefaultIndexConfig()
+	viper.SetDefault("index.method", string(indexDefaults.Method))
+	viper.SetDefault("index.m", indexDefaults.M)
+	viper.SetDefault("index.ef_construction", indexDefaults.EfConstruction)
+	viper.SetDefault("index.lists", indexDefaults.Lists)
+	viper.SetDefault("index.ef_search", indexDefaults.EfSearch)
+	viper.SetDefault("index.probes", indexDefaults.Probes)
 
 	if err := viper.ReadInConfig(); err != nil {
 		var configFileNotFoundError viper.ConfigFileNotFoundError
@@ -36,5 +138,17 @@ func loadConfig() error {
 		return fmt.Errorf("unable to decode config into struct: %w", err)
 	}
 
+	switch agent.Backend(cfg.Backend) {
+	case agent.BackendAssistants, agent.BackendChat:
+	default:
+		return fmt.Errorf("unsupported backend %q, use assistants or chat", cfg.Backend)
+	}
+
+	switch rag.IndexMethod(cfg.Index.Method) {
+	case rag.IndexMethodHNSW, rag.IndexMethodIVFFlat:
+	default:
+		return fmt.Errorf("unsupported index method %q, use hnsw or ivfflat", cfg.Index.Method)
+	}
+
 	return nil
 }
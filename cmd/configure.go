@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"github.com/sajuno/goon/agent"
 	"github.com/spf13/cobra"
 )
 
@@ -10,6 +12,10 @@ func configure(ctx context.Context) *cobra.Command {
 		Use:   "configure",
 		Short: "Sets up Open AI for usage with Goon",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if agent.Backend(cfg.Backend) == agent.BackendChat {
+				fmt.Println("The chat backend doesn't use an assistant, there's nothing to configure")
+				return nil
+			}
 			return ag.Configure(ctx)
 		},
 	}
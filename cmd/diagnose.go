@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/sajuno/goon/agent"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+func goonDiagnose(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diagnose [path]",
+		Short: "collects compiler, vet and staticcheck diagnostics from gopls and explains how to fix them",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "."
+			if len(args) > 0 {
+				path = args[0]
+			}
+
+			out := agent.NewTerminalStream(os.Stdout)
+			response, err := ag.Diagnose(ctx, path, out)
+			out.Finish()
+			if err != nil {
+				return fmt.Errorf("failed to diagnose %s: %w", path, err)
+			}
+
+			if response == "" {
+				fmt.Println("No diagnostics, gopls is happy")
+			}
+
+			return nil
+		},
+	}
+
+	return cmd
+}
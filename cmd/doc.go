@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/sajuno/goon/agent"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+func goonDoc(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doc",
+		Short: "audits and writes the doc comments of exported symbols",
+	}
+
+	cmd.AddCommand(goonDocAudit(ctx))
+	cmd.AddCommand(goonDocWrite(ctx))
+
+	return cmd
+}
+
+func goonDocAudit(ctx context.Context) *cobra.Command {
+	var opts agent.DocOptions
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "lists exported symbols with missing, mismatched or stale doc comments",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := agent.NewTerminalStream(os.Stderr)
+			findings, err := ag.AuditDocs(ctx, opts, out)
+			out.Finish()
+			if err != nil {
+				return fmt.Errorf("failed to audit doc comments: %w", err)
+			}
+
+			for _, f := range findings {
+				fmt.Printf("%s:%d: %s%-10s\033[0m %s: %s\n", f.Path, f.Line, docProblemColor(f.Problem), f.Problem, f.Symbol, f.Reason)
+			}
+			if len(findings) == 0 {
+				fmt.Fprintln(os.Stderr, "All exported symbols are documented")
+			}
+			return nil
+		},
+	}
+
+	addDocFlags(cmd, &opts)
+
+	return cmd
+}
+
+func goonDocWrite(ctx context.Context) *cobra.Command {
+	var (
+		opts    agent.DocOptions
+		outPath string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "write",
+		Short: "writes doc comments for the findings of an audit as a patch, apply it with git apply",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := agent.NewTerminalStream(os.Stderr)
+			patch, err := ag.WriteDocs(ctx, opts, out)
+			out.Finish()
+			if err != nil {
+				return fmt.Errorf("failed to write doc comments: %w", err)
+			}
+
+			if patch == "" {
+				fmt.Fprintln(os.Stderr, "Nothing to write")
+				return nil
+			}
+			if outPath == "" {
+				fmt.Print(patch)
+				return nil
+			}
+			if err := os.WriteFile(outPath, []byte(patch), 0o644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", outPath, err)
+			}
+			fmt.Fprintf(os.Stderr, "wrote %s, review it and apply it with git apply %s\n", outPath, outPath)
+			return nil
+		},
+	}
+
+	addDocFlags(cmd, &opts)
+	cmd.Flags().StringVarP(&outPath, "out", "o", "", "Write the patch to this file instead of stdout")
+
+	return cmd
+}
+
+func addDocFlags(cmd *cobra.Command, opts *agent.DocOptions) {
+	cmd.Flags().StringVar(&opts.Package, "pkg", "", "Package directory relative to the repository root, like ./rag or ./rag/..., defaults to the whole repository")
+	cmd.Flags().BoolVar(&opts.Static, "static", false, "Only check for missing and mismatched comments, without asking the model which are stale")
+}
+
+func docProblemColor(problem agent.DocProblem) string {
+	switch problem {
+	case agent.DocMissing:
+		return "\033[31m"
+	case agent.DocStale:
+		return "\033[33m"
+	default:
+		return "\033[36m"
+	}
+}
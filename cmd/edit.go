@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/sajuno/goon/agent"
+	"github.com/sajuno/goon/gitdiff"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+func goonEdit(ctx context.Context) *cobra.Command {
+	var (
+		sessionID string
+		cont      bool
+		patchPath string
+		yes       bool
+		attempts  int
+	)
+
+	cmd := &cobra.Command{
+		Use:     "edit <instruction>",
+		Aliases: []string{"refactor"},
+		Short:   "changes the code base as instructed, showing the diff before applying it",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sess, err := explainSession(sessionID, cont)
+			if err != nil {
+				return err
+			}
+
+			instruction := strings.Join(args, " ")
+			out := agent.NewTerminalStream(os.Stderr)
+			changes, err := ag.ProposeEdit(ctx, sess, instruction, attempts, out)
+			out.Finish()
+			if err != nil {
+				return fmt.Errorf("failed to edit: %w", err)
+			}
+
+			if err := sessions.Save(sess); err != nil {
+				return fmt.Errorf("failed to save session: %w", err)
+			}
+
+			if patchPath != "" {
+				if err := os.WriteFile(patchPath, []byte(changes.Patch), 0o644); err != nil {
+					return fmt.Errorf("failed to write %s: %w", patchPath, err)
+				}
+				fmt.Fprintf(os.Stderr, "%s\n\nwrote %s, apply it with git apply %s\n", changes.Summary, patchPath, patchPath)
+				return nil
+			}
+
+			fmt.Printf("%s\n\n%s\n", changes.Summary, gitdiff.Colorize(changes.Patch))
+			if !yes && !confirmStdin("Apply these changes?") {
+				fmt.Fprintf(os.Stderr, "Not applied, continue with --session %s to change them\n", sess.ShortID())
+				return nil
+			}
+
+			if err := ag.ApplyChanges(ctx, changes); err != nil {
+				return fmt.Errorf("failed to apply changes: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "Changed %s\n", strings.Join(changes.Paths(), ", "))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&sessionID, "session", "", "Continue the session with this (prefix of an) ID")
+	cmd.Flags().BoolVarP(&cont, "continue", "c", false, "Continue the most recent session")
+	cmd.MarkFlagsMutuallyExclusive("session", "continue")
+	cmd.Flags().StringVar(&patchPath, "patch", "", "Write the changes to this patch file instead of applying them")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Apply the changes without asking")
+	cmd.MarkFlagsMutuallyExclusive("patch", "yes")
+	cmd.Flags().IntVar(&attempts, "attempts", agent.DefaultEditAttempts, "How often edits that don't apply or build are handed back to be fixed")
+
+	return cmd
+}
+
+// confirmStdin asks a yes/no question on the terminal, anything but yes is no
+func confirmStdin(question string) bool {
+	fmt.Fprintf(os.Stderr, "\033[33m%s [y/N] \033[0m", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -3,31 +3,62 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"github.com/sajuno/goon/agent"
+	"github.com/sajuno/goon/session"
 	"github.com/spf13/cobra"
+	"os"
 	"strings"
 )
 
 func goonExplain(ctx context.Context) *cobra.Command {
-	var pkgName string
+	var (
+		pkgName   string
+		sessionID string
+		cont      bool
+	)
 
 	cmd := &cobra.Command{
 		Use:   "explain <query>",
 		Short: "explain will attempt to answer a question about the code base",
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			sess, err := explainSession(sessionID, cont)
+			if err != nil {
+				return err
+			}
+
 			prompt := strings.Join(args, " ")
-			response, err := ag.Explain(ctx, prompt)
+			out := agent.NewTerminalStream(os.Stdout)
+			_, err = ag.Explain(ctx, sess, prompt, out)
+			out.Finish()
 			if err != nil {
 				return fmt.Errorf("failed to generate goonExplain: %w", err)
 			}
 
-			fmt.Println(response)
+			if err := sessions.Save(sess); err != nil {
+				return fmt.Errorf("failed to save session: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "\nsession %s, ask a follow-up with --session %s\n", sess.ShortID(), sess.ShortID())
 
 			return nil
 		},
 	}
 
 	cmd.Flags().StringVar(&pkgName, "pkg", "", "Optional Go package name to narrow search scope")
+	cmd.Flags().StringVar(&sessionID, "session", "", "Continue the session with this (prefix of an) ID")
+	cmd.Flags().BoolVarP(&cont, "continue", "c", false, "Continue the most recent session")
+	cmd.MarkFlagsMutuallyExclusive("session", "continue")
 
 	return cmd
 }
+
+func explainSession(id string, cont bool) (*session.Session, error) {
+	switch {
+	case id != "":
+		return sessions.Load(id)
+	case cont:
+		return sessions.Latest()
+	default:
+		return session.New(), nil
+	}
+}
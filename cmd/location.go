@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/sajuno/goon/agent"
+	"strconv"
+	"strings"
+)
+
+// parseLocation parses path:line[:col], line may be a range start-end for commands that take one
+func parseLocation(s string) (agent.Location, int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return agent.Location{}, 0, fmt.Errorf("invalid location %q, expected path:line[:col]", s)
+	}
+
+	loc := agent.Location{Path: parts[0]}
+	lines := strings.SplitN(parts[1], "-", 2)
+	line, err := strconv.Atoi(lines[0])
+	if err != nil || line < 1 {
+		return agent.Location{}, 0, fmt.Errorf("invalid line in %q", s)
+	}
+	loc.Line = line
+
+	endLine := line
+	if len(lines) == 2 {
+		if endLine, err = strconv.Atoi(lines[1]); err != nil || endLine < line {
+			return agent.Location{}, 0, fmt.Errorf("invalid line range in %q", s)
+		}
+	}
+
+	if len(parts) == 3 {
+		if loc.Col, err = strconv.Atoi(parts[2]); err != nil || loc.Col < 1 {
+			return agent.Location{}, 0, fmt.Errorf("invalid column in %q", s)
+		}
+	}
+
+	return loc, endLine, nil
+}
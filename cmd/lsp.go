@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"context"
+	"github.com/sajuno/goon/lspserver"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+func goonLsp(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lsp",
+		Short: "runs goon as a language server on stdio, for code actions and hovers in editors",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return lspserver.Serve(ctx, ag, sessions, os.Stdin, os.Stdout)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"context"
+	"github.com/sajuno/goon/mcp"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+func goonMcp(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "mcp",
+		Short:       "runs goon as an MCP server on stdio, offering its index and language server as tools to other agents",
+		Annotations: map[string]string{withoutGoTools: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return mcp.Serve(ctx, ag.ExternalTools(), os.Stdin, os.Stdout)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/sajuno/goon/agent"
+	"github.com/sajuno/goon/gitdiff"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+func goonRename(ctx context.Context) *cobra.Command {
+	var (
+		patchPath string
+		yes       bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rename <path:line:col> <new-name>",
+		Short: "renames the identifier at a position everywhere it's used, with gopls",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			loc, _, err := parseLocation(args[0])
+			if err != nil {
+				return err
+			}
+			if loc.Col == 0 {
+				return fmt.Errorf("rename needs a column, path:line:col")
+			}
+
+			changes, err := ag.Rename(ctx, loc.Path, loc.Line, loc.Col, args[1])
+			if err != nil {
+				return err
+			}
+			return applyChanges(ctx, changes, patchPath, yes)
+		},
+	}
+
+	cmd.Flags().StringVar(&patchPath, "patch", "", "Write the changes to this patch file instead of applying them")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Apply the changes without asking")
+	cmd.MarkFlagsMutuallyExclusive("patch", "yes")
+
+	return cmd
+}
+
+func goonAction(ctx context.Context) *cobra.Command {
+	var (
+		patchPath string
+		yes       bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "action <path:line[-end]> [title]",
+		Short: "lists the quick fixes and refactorings gopls offers for lines, or applies the one with the title",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			loc, endLine, err := parseLocation(args[0])
+			if err != nil {
+				return err
+			}
+
+			actions, err := ag.CodeActions(ctx, loc.Path, loc.Line, endLine)
+			if err != nil {
+				return err
+			}
+
+			title := strings.Join(args[1:], " ")
+			if title == "" {
+				if len(actions) == 0 {
+					fmt.Fprintln(os.Stderr, "No code actions")
+				}
+				for _, action := range actions {
+					fmt.Printf("%s\t%s\n", action.Title, action.Kind)
+				}
+				return nil
+			}
+
+			for _, action := range actions {
+				if !strings.EqualFold(action.Title, title) {
+					continue
+				}
+				changes, err := ag.CodeActionChanges(ctx, action)
+				if err != nil {
+					return err
+				}
+				return applyChanges(ctx, changes, patchPath, yes)
+			}
+			return fmt.Errorf("no code action %q at %s", title, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&patchPath, "patch", "", "Write the changes to this patch file instead of applying them")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Apply the changes without asking")
+	cmd.MarkFlagsMutuallyExclusive("patch", "yes")
+
+	return cmd
+}
+
+// applyChanges writes changes to a patch file, or shows them and applies them once confirmed
+func applyChanges(ctx context.Context, changes *agent.ChangeSet, patchPath string, yes bool) error {
+	if patchPath != "" {
+		if err := os.WriteFile(patchPath, []byte(changes.Patch), 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", patchPath, err)
+		}
+		fmt.Fprintf(os.Stderr, "%s\n\nwrote %s, apply it with git apply %s\n", changes.Summary, patchPath, patchPath)
+		return nil
+	}
+
+	fmt.Printf("%s\n\n%s\n", changes.Summary, gitdiff.Colorize(changes.Patch))
+	if !yes && !confirmStdin("Apply these changes?") {
+		fmt.Fprintln(os.Stderr, "Not applied")
+		return nil
+	}
+
+	if err := ag.ApplyChanges(ctx, changes); err != nil {
+		return fmt.Errorf("failed to apply changes: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Changed %s\n", strings.Join(changes.Paths(), ", "))
+	return nil
+}
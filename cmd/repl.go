@@ -11,8 +11,7 @@ func goonRepl(ctx context.Context) *cobra.Command {
 		Use:   "repl",
 		Short: "Starts Goon's repl for interactive assistance",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			repl.Start(ctx, ag)
-			return nil
+			return repl.Start(ctx, ag, sessions)
 		},
 	}
 
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/agent"
+	"github.com/sajuno/goon/gitdiff"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func goonReview(ctx context.Context) *cobra.Command {
+	var (
+		base   string
+		format string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "review",
+		Short: "reviews the changes of the current branch and working tree against a base branch, untracked files included",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var render func(io.Writer, *agent.Review) error
+			switch format {
+			case "terminal":
+				render = renderReviewTerminal
+			case "markdown":
+				render = renderReviewMarkdown
+			case "json":
+				// GitHub expects paths relative to the repository, the workspace can be a subdirectory of it
+				prefix, err := workspacePrefix(ctx, ag.Workspace().Root())
+				if err != nil {
+					return err
+				}
+				render = func(w io.Writer, review *agent.Review) error {
+					return renderReviewJSON(w, review, prefix)
+				}
+			default:
+				return fmt.Errorf("unsupported format %q, use terminal, markdown or json", format)
+			}
+
+			// progress goes to stderr so markdown and json output can be redirected
+			review, err := ag.Review(ctx, base, agent.NewTerminalStream(os.Stderr))
+			if errors.Is(err, agent.ErrNoChanges) {
+				fmt.Fprintf(os.Stderr, "No changes against %s\n", base)
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to review changes against %s: %w", base, err)
+			}
+
+			return render(os.Stdout, review)
+		},
+	}
+
+	cmd.Flags().StringVar(&base, "base", "main", "Branch the changes are going to be merged into")
+	cmd.Flags().StringVar(&format, "format", "terminal", "Output format: terminal, markdown or json")
+
+	return cmd
+}
+
+func renderReviewTerminal(w io.Writer, review *agent.Review) error {
+	fmt.Fprintf(w, "\n%s\n", review.Summary)
+
+	for _, f := range review.Files {
+		fmt.Fprintf(w, "\n\033[1m%s\033[0m\n", f.Path)
+		for _, c := range f.Comments {
+			location := "file"
+			if c.Line > 0 {
+				location = fmt.Sprintf("%d", c.Line)
+			}
+			fmt.Fprintf(w, "  %s%-10s\033[0m \033[2m%5s\033[0m  %s\n", severityColor(c.Severity), c.Severity, location, indent(c.Body, 20))
+		}
+	}
+
+	if len(review.Files) == 0 {
+		fmt.Fprintln(w, "\nNo comments")
+	}
+	return nil
+}
+
+func severityColor(severity agent.ReviewSeverity) string {
+	switch severity {
+	case agent.ReviewIssue:
+		return "\033[31m"
+	case agent.ReviewSuggestion:
+		return "\033[33m"
+	default:
+		return "\033[36m"
+	}
+}
+
+// indent aligns continuation lines of multi-line comments with the first one
+func indent(text string, n int) string {
+	return strings.ReplaceAll(strings.TrimSpace(text), "\n", "\n"+strings.Repeat(" ", n))
+}
+
+func renderReviewMarkdown(w io.Writer, review *agent.Review) error {
+	fmt.Fprintf(w, "# Review against `%s`\n\n%s\n", review.Base, review.Summary)
+
+	for _, f := range review.Files {
+		fmt.Fprintf(w, "\n## `%s`\n\n", f.Path)
+		for _, c := range f.Comments {
+			if c.Line > 0 {
+				fmt.Fprintf(w, "- **%s** line %d: %s\n", c.Severity, c.Line, c.Body)
+			} else {
+				fmt.Fprintf(w, "- **%s**: %s\n", c.Severity, c.Body)
+			}
+		}
+	}
+	return nil
+}
+
+// githubReview is the payload of GitHub's create review endpoint, POST /repos/{owner}/{repo}/pulls/{pull_number}/reviews
+type githubReview struct {
+	Body     string          `json:"body"`
+	Event    string          `json:"event"`
+	Comments []githubComment `json:"comments"`
+}
+
+type githubComment struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Side string `json:"side"`
+	Body string `json:"body"`
+}
+
+// workspacePrefix returns the slash separated path of root relative to the git toplevel, empty when root is the toplevel
+func workspacePrefix(ctx context.Context, root string) (string, error) {
+	toplevel, err := gitdiff.Toplevel(ctx, root)
+	if err != nil {
+		return "", err
+	}
+	// the workspace root has its symlinks resolved
+	if toplevel, err = filepath.EvalSymlinks(toplevel); err != nil {
+		return "", fmt.Errorf("failed to resolve the git toplevel: %w", err)
+	}
+
+	rel, err := filepath.Rel(toplevel, root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the workspace in the repository: %w", err)
+	}
+	if rel == "." {
+		return "", nil
+	}
+	return filepath.ToSlash(rel) + "/", nil
+}
+
+// renderReviewJSON writes the review as a GitHub review, comments on whole files can't be posted as review comments
+// and are added to the body instead. prefix is prepended to the workspace relative paths of the review.
+func renderReviewJSON(w io.Writer, review *agent.Review, prefix string) error {
+	payload := githubReview{Body: review.Summary, Event: "COMMENT", Comments: []githubComment{}}
+
+	var fileComments []string
+	for _, f := range review.Files {
+		for _, c := range f.Comments {
+			body := fmt.Sprintf("**%s**: %s", c.Severity, c.Body)
+			if c.Line == 0 {
+				fileComments = append(fileComments, fmt.Sprintf("- `%s` %s", prefix+c.Path, body))
+				continue
+			}
+			payload.Comments = append(payload.Comments, githubComment{Path: prefix + c.Path, Line: c.Line, Side: "RIGHT", Body: body})
+		}
+	}
+	if len(fileComments) > 0 {
+		payload.Body += "\n\n" + strings.Join(fileComments, "\n")
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(payload)
+}
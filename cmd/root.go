@@ -2,20 +2,34 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	pgxvec "github.com/pgvector/pgvector-go/pgx"
 	"github.com/sajuno/goon/agent"
+	"github.com/sajuno/goon/gitdiff"
 	"github.com/sajuno/goon/language/lsp"
+	"github.com/sajuno/goon/openai/runstream"
 	"github.com/sajuno/goon/rag"
+	"github.com/sajuno/goon/session"
+	"github.com/sajuno/goon/workspace"
 	"github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
 )
 
 // global agent instance
 var ag *agent.Agent
 
+// withoutGoTools annotates commands answering other users or agents, there's no one to confirm the go commands
+// the model wants to run so go_tools are disabled for them
+const withoutGoTools = "goon/without-go-tools"
+
+// global session store, shared by explain and the repl
+var sessions *session.Store
+
 func NewRootCmd(ctx context.Context) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "goon",
@@ -42,20 +56,129 @@ func NewRootCmd(ctx context.Context) *cobra.Command {
 				return fmt.Errorf("postgres not ready: %w", err)
 			}
 
-			lspClient, err := lsp.NewGoplsClient(ctx)
+			store := rag.NewPGStore(pool, rag.IndexConfig{
+				Method:         rag.IndexMethod(cfg.Index.Method),
+				M:              cfg.Index.M,
+				EfConstruction: cfg.Index.EfConstruction,
+				Lists:          cfg.Index.Lists,
+				EfSearch:       cfg.Index.EfSearch,
+				Probes:         cfg.Index.Probes,
+			})
+
+			root, err := workspaceRoot(ctx, store)
+			if err != nil {
+				return err
+			}
+
+			ws, err := workspace.New(root)
+			if err != nil {
+				return err
+			}
+
+			lspClient, err := lsp.NewGoplsClient(ctx, ws.Root())
 			if err != nil {
 				return err
 			}
 
-			ag = agent.New(openai.NewClient(cfg.APIKey), rag.NewPGStore(pool), agent.AssistantConfig{ID: cfg.AssistantID}, lspClient)
-			return nil
+			agentCfg := agent.Config{
+				Workspace: ws,
+				Backend:   agent.Backend(cfg.Backend),
+				Timeout:   cfg.RunTimeout,
+				Assistant: agent.AssistantConfig{ID: cfg.AssistantID},
+				Chat: agent.ChatConfig{
+					Model:         cfg.Chat.Model,
+					MaxToolRounds: cfg.Chat.MaxToolRounds,
+					HistoryTokens: cfg.Chat.HistoryTokens,
+				},
+				Embedding: agent.EmbeddingConfig{
+					Model:      openai.EmbeddingModel(cfg.Embedding.Model),
+					Dimensions: cfg.Embedding.Dimensions,
+					Encoding:   cfg.Embedding.Encoding,
+				},
+				GoTools: agent.GoToolsConfig{
+					Enabled: cfg.GoTools.Enabled && cmd.Annotations[withoutGoTools] == "",
+					Timeout: cfg.GoTools.Timeout,
+				},
+			}
+
+			openaiCfg := openai.DefaultConfig(cfg.APIKey)
+			if cfg.BaseURL != "" {
+				openaiCfg.BaseURL = cfg.BaseURL
+			}
+
+			ag = agent.New(openai.NewClientWithConfig(openaiCfg), runstream.New(cfg.APIKey, cfg.BaseURL), store, agentCfg, lspClient)
+
+			dir, err := sessionDir()
+			if err != nil {
+				return err
+			}
+			sessions, err = session.NewStore(dir)
+			return err
 		},
 	}
 
 	cmd.AddCommand(goonExplain(ctx))
+	cmd.AddCommand(goonAsk(ctx))
 	cmd.AddCommand(goonIndex(ctx))
 	cmd.AddCommand(goonRepl(ctx))
+	cmd.AddCommand(goonLsp(ctx))
+	cmd.AddCommand(goonMcp(ctx))
+	cmd.AddCommand(goonServe(ctx))
 	cmd.AddCommand(configure(ctx))
+	cmd.AddCommand(goonDiagnose(ctx))
+	cmd.AddCommand(goonReview(ctx))
+	cmd.AddCommand(goonTest(ctx))
+	cmd.AddCommand(goonDoc(ctx))
+	cmd.AddCommand(goonEdit(ctx))
+	cmd.AddCommand(goonRename(ctx))
+	cmd.AddCommand(goonAction(ctx))
 
 	return cmd
 }
+
+// sessionDir is the configured session directory, or the default one
+func sessionDir() (string, error) {
+	if cfg.SessionDir != "" {
+		return cfg.SessionDir, nil
+	}
+	dir, err := session.DefaultDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine session directory: %w", err)
+	}
+	return dir, nil
+}
+
+// workspaceRoot is the repository goon runs in: the closest directory containing the working directory that was indexed,
+// up to the git toplevel. Outside of indexed directories it's the git toplevel, or the working directory outside of git.
+func workspaceRoot(ctx context.Context, store rag.Store) (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	// snapshot roots are stored with symlinks resolved
+	if wd, err = filepath.EvalSymlinks(wd); err != nil {
+		return "", fmt.Errorf("failed to resolve the working directory: %w", err)
+	}
+
+	top := wd
+	if toplevel, err := gitdiff.Toplevel(ctx, wd); err == nil {
+		if top, err = filepath.EvalSymlinks(toplevel); err != nil {
+			return "", fmt.Errorf("failed to resolve the git toplevel: %w", err)
+		}
+	}
+
+	for dir := wd; ; dir = filepath.Dir(dir) {
+		_, err := store.LatestSnapshot(ctx, dir)
+		if err == nil {
+			return dir, nil
+		}
+		if !errors.Is(err, rag.ErrNoSnapshot) {
+			return "", err
+		}
+		if dir == top || filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	return top, nil
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/sajuno/goon/api/server"
+	"github.com/spf13/cobra"
+	"path/filepath"
+)
+
+func goonServe(ctx context.Context) *cobra.Command {
+	var addr string
+
+	cmd := &cobra.Command{
+		Use:         "serve",
+		Short:       "serves search, explain and review over an authenticated HTTP API, sharing one index with a team",
+		Annotations: map[string]string{withoutGoTools: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := sessionDir()
+			if err != nil {
+				return err
+			}
+
+			tokens := make(map[string]string, len(cfg.Serve.Tokens))
+			for _, t := range cfg.Serve.Tokens {
+				if _, ok := tokens[t.User]; ok {
+					return fmt.Errorf("serve.tokens lists %s more than once", t.User)
+				}
+				tokens[t.User] = t.Token
+			}
+
+			srv, err := server.New(ag, server.Config{
+				Tokens:          tokens,
+				SessionDir:      filepath.Join(dir, "serve"),
+				ShutdownTimeout: cfg.Serve.ShutdownTimeout,
+				TLSCertFile:     cfg.Serve.TLSCert,
+				TLSKeyFile:      cfg.Serve.TLSKey,
+			})
+			if err != nil {
+				return err
+			}
+
+			if addr == "" {
+				addr = cfg.Serve.Addr
+			}
+			return srv.ListenAndServe(ctx, addr)
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "addr", "", "address to listen on, defaults to serve.addr")
+
+	return cmd
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/sajuno/goon/agent"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+func goonTest(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test",
+		Short: "works on the tests of the code base",
+	}
+
+	cmd.AddCommand(goonTestGen(ctx))
+
+	return cmd
+}
+
+func goonTestGen(ctx context.Context) *cobra.Command {
+	var (
+		attempts  int
+		patchPath string
+		yes       bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "gen <symbol>",
+		Short: "generates a table-driven test for a function or method, like rag.PGStore.FindChunks, runs it and shows it before writing it (requires go_tools.enabled)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := agent.NewTerminalStream(os.Stderr)
+			generated, err := ag.GenerateTest(ctx, args[0], attempts, out)
+			out.Finish()
+			if err != nil {
+				return fmt.Errorf("failed to generate tests for %s: %w", args[0], err)
+			}
+
+			fmt.Fprintf(os.Stderr, "%s pass after %d attempt(s)\n", strings.Join(generated.Tests, ", "), generated.Attempts)
+			return applyChanges(ctx, generated.Changes, patchPath, yes)
+		},
+	}
+
+	cmd.Flags().IntVar(&attempts, "attempts", agent.DefaultTestAttempts, "How often failing tests are handed back to be fixed")
+	cmd.Flags().StringVar(&patchPath, "patch", "", "Write the test file to this patch file instead of the package")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Write the test file without asking")
+	cmd.MarkFlagsMutuallyExclusive("patch", "yes")
+
+	return cmd
+}
@@ -0,0 +1,27 @@
+package gitdiff
+
+import (
+	"strings"
+)
+
+// Colorize adds terminal colors to a patch, like git diff --color
+func Colorize(patch string) string {
+	var sb strings.Builder
+	for _, line := range strings.SplitAfter(patch, "\n") {
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "diff --git "), strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "+++ "),
+			strings.HasPrefix(line, "new file mode"), strings.HasPrefix(line, "deleted file mode"):
+			sb.WriteString("\033[1m" + strings.TrimSuffix(line, "\n") + "\033[0m\n")
+		case strings.HasPrefix(line, "@@"):
+			sb.WriteString("\033[36m" + strings.TrimSuffix(line, "\n") + "\033[0m\n")
+		case strings.HasPrefix(line, "+"):
+			sb.WriteString("\033[32m" + strings.TrimSuffix(line, "\n") + "\033[0m\n")
+		case strings.HasPrefix(line, "-"):
+			sb.WriteString("\033[31m" + strings.TrimSuffix(line, "\n") + "\033[0m\n")
+		default:
+			sb.WriteString(line)
+		}
+	}
+	return sb.String()
+}
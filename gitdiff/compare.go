@@ -0,0 +1,239 @@
+package gitdiff
+
+import (
+	"strings"
+)
+
+// contextLines is the number of unchanged lines around changes, like git's default
+const contextLines = 3
+
+const noNewline = `\ No newline at end of file`
+
+// Compare diffs two versions of a file line by line. Paths are relative to the repository root, empty for added
+// and deleted files. The result has no hunks if the contents are equal.
+func Compare(oldPath, newPath string, old, new []byte) File {
+	f := File{OldPath: oldPath, NewPath: newPath}
+
+	a, b := splitLines(string(old)), splitLines(string(new))
+	edits := diffLines(a, b)
+
+	for i := 0; i < len(edits); i++ {
+		if edits[i].op == opEqual {
+			continue
+		}
+
+		// extend the hunk while the next change is close enough for the contexts to overlap
+		start, last := max(i-contextLines, 0), i
+		for j := i + 1; j < len(edits) && j-last <= 2*contextLines; j++ {
+			if edits[j].op != opEqual {
+				last = j
+			}
+		}
+		end := min(last+contextLines+1, len(edits))
+
+		f.Hunks = append(f.Hunks, hunk(edits[start:end]))
+		i = end - 1
+	}
+
+	return f
+}
+
+// String formats the file as a patch git apply accepts
+func (f File) String() string {
+	if len(f.Hunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("diff --git a/" + f.Path() + " b/" + f.Path() + "\n")
+	switch {
+	case f.OldPath == "":
+		sb.WriteString("new file mode 100644\n--- /dev/null\n")
+	default:
+		sb.WriteString("--- a/" + f.OldPath + "\n")
+	}
+	if f.Deleted() {
+		sb.WriteString("+++ /dev/null\n")
+	} else {
+		sb.WriteString("+++ b/" + f.NewPath + "\n")
+	}
+	for _, h := range f.Hunks {
+		sb.WriteString(h.String())
+	}
+	return sb.String()
+}
+
+type op int
+
+const (
+	opEqual op = iota
+	opDelete
+	opInsert
+)
+
+type edit struct {
+	op op
+
+	// oldLine and newLine are the 0-based lines of both versions before the edit is applied
+	oldLine, newLine int
+	text             string
+}
+
+func hunk(edits []edit) Hunk {
+	h := Hunk{OldStart: edits[0].oldLine + 1, NewStart: edits[0].newLine + 1}
+	for _, e := range edits {
+		text := strings.TrimSuffix(e.text, "\n")
+		switch e.op {
+		case opEqual:
+			h.Lines = append(h.Lines, " "+text)
+			h.OldLines++
+			h.NewLines++
+		case opDelete:
+			h.Lines = append(h.Lines, "-"+text)
+			h.OldLines++
+		case opInsert:
+			h.Lines = append(h.Lines, "+"+text)
+			h.NewLines++
+		}
+		if !strings.HasSuffix(e.text, "\n") {
+			h.Lines = append(h.Lines, noNewline)
+		}
+	}
+
+	// empty ranges start at the line before them
+	if h.OldLines == 0 {
+		h.OldStart--
+	}
+	if h.NewLines == 0 {
+		h.NewStart--
+	}
+	return h
+}
+
+// splitLines splits text into lines that keep their newline, so a missing newline at the end is a difference
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// maxEditDistance bounds the edit distance diffLines searches for, the trace of Myers' algorithm takes O(D²) memory.
+// Larger rewrites are diffed as the removal of the old lines and the insertion of the new ones.
+const maxEditDistance = 1000
+
+// diffLines returns the shortest edit script from a to b using Myers' algorithm, or a plain replacement of the
+// changed lines for rewrites beyond maxEditDistance
+func diffLines(a, b []string) []edit {
+	// common lines at the start and end are equal either way, leaving them out keeps the search small
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]edit, 0, prefix+suffix)
+	for i := range prefix {
+		edits = append(edits, edit{op: opEqual, oldLine: i, newLine: i, text: a[i]})
+	}
+
+	oldMiddle, newMiddle := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	middle, ok := myers(oldMiddle, newMiddle)
+	if !ok {
+		middle = middle[:0]
+		for i, line := range oldMiddle {
+			middle = append(middle, edit{op: opDelete, oldLine: i, newLine: 0, text: line})
+		}
+		for i, line := range newMiddle {
+			middle = append(middle, edit{op: opInsert, oldLine: len(oldMiddle), newLine: i, text: line})
+		}
+	}
+	for _, e := range middle {
+		e.oldLine += prefix
+		e.newLine += prefix
+		edits = append(edits, e)
+	}
+
+	for i := range suffix {
+		edits = append(edits, edit{op: opEqual, oldLine: len(a) - suffix + i, newLine: len(b) - suffix + i, text: a[len(a)-suffix+i]})
+	}
+	return edits
+}
+
+// myers returns the shortest edit script from a to b, false if it's longer than maxEditDistance
+func myers(a, b []string) ([]edit, bool) {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+
+	// trace holds the part of v round d reads, k from -d-1 to d+1, as it was before the round,
+	// to walk the path back from the end
+	var trace [][]int
+	at := func(d, k int) int {
+		return trace[d][k+d+1]
+	}
+search:
+	for d := 0; d <= n+m; d++ {
+		if d > maxEditDistance {
+			return nil, false
+		}
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var edits []edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && at(d, k-1) < at(d, k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(d, prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			edits = append(edits, edit{op: opEqual, oldLine: x, newLine: y, text: a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				edits = append(edits, edit{op: opInsert, oldLine: x, newLine: y, text: b[y]})
+			} else {
+				x--
+				edits = append(edits, edit{op: opDelete, oldLine: x, newLine: y, text: a[x]})
+			}
+		}
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits, true
+}
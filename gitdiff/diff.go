@@ -0,0 +1,274 @@
+package gitdiff
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// File is the diff of a single file
+type File struct {
+	// OldPath and NewPath are relative to the diffed directory, empty for added and deleted files respectively
+	OldPath string
+	NewPath string
+
+	Binary bool
+	Hunks  []Hunk
+}
+
+// Path is the path of the file after the change, or before it for deleted files
+func (f File) Path() string {
+	if f.NewPath != "" {
+		return f.NewPath
+	}
+	return f.OldPath
+}
+
+func (f File) Deleted() bool {
+	return f.NewPath == ""
+}
+
+// ContainsLine reports whether a line of the new version of the file is part of a hunk
+func (f File) ContainsLine(line int) bool {
+	for _, h := range f.Hunks {
+		if h.ContainsLine(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hunk is a changed region, starts are 1-based lines
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+
+	// Section is the text after the @@ markers, git puts the enclosing function there
+	Section string
+
+	// Lines are prefixed with ' ', '+' or '-'
+	Lines []string
+}
+
+// ContainsLine reports whether a line of the new version of the file falls within the hunk
+func (h Hunk) ContainsLine(line int) bool {
+	return line >= h.NewStart && line < h.NewStart+h.NewLines
+}
+
+// String formats the hunk like git does
+func (h Hunk) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines))
+	if h.Section != "" {
+		sb.WriteString(" " + h.Section)
+	}
+	sb.WriteString("\n")
+	for _, l := range h.Lines {
+		sb.WriteString(l + "\n")
+	}
+	return sb.String()
+}
+
+// Diff returns the changes of the working tree in dir compared to where it branched off from base,
+// like a pull request of the current branch into base would show them, including uncommitted changes and
+// untracked files that aren't ignored. Only changes within dir are returned, with paths relative to it,
+// so dir can be a subdirectory of the repository.
+func Diff(ctx context.Context, dir, base string) ([]File, error) {
+	if strings.HasPrefix(base, "-") {
+		return nil, fmt.Errorf("invalid base %q", base)
+	}
+
+	mergeBase, err := git(ctx, dir, "merge-base", base, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find merge base with %s: %w", base, err)
+	}
+
+	out, err := git(ctx, dir, "diff", "--no-color", "--no-ext-diff", "--find-renames", "--unified=3", "--relative",
+		strings.TrimSpace(string(mergeBase)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff against %s: %w", base, err)
+	}
+
+	files, err := Parse(bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+
+	untracked, err := untrackedFiles(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	return append(files, untracked...), nil
+}
+
+// untrackedFiles returns the files in dir git doesn't track and doesn't ignore as added files
+func untrackedFiles(ctx context.Context, dir string) ([]File, error) {
+	out, err := git(ctx, dir, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list untracked files: %w", err)
+	}
+
+	var files []File
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path == "" {
+			continue
+		}
+		abs := filepath.Join(dir, filepath.FromSlash(path))
+		// symlinks could point outside of the repository, their targets aren't part of the change
+		if info, err := os.Lstat(abs); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			continue
+		}
+		content, err := os.ReadFile(abs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read untracked file %s: %w", path, err)
+		}
+		if bytes.IndexByte(content, 0) >= 0 {
+			files = append(files, File{NewPath: path, Binary: true})
+			continue
+		}
+		files = append(files, Compare("", path, nil, content))
+	}
+	return files, nil
+}
+
+// Toplevel returns the root of the git working tree dir is in
+func Toplevel(ctx context.Context, dir string) (string, error) {
+	out, err := git(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("failed to find the git toplevel of %s: %w", dir, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+// Parse reads unified diff output of git diff
+func Parse(r io.Reader) ([]File, error) {
+	var (
+		files []File
+		file  *File
+		hunk  *Hunk
+	)
+
+	flush := func() {
+		if file == nil {
+			return
+		}
+		if hunk != nil {
+			file.Hunks = append(file.Hunks, *hunk)
+			hunk = nil
+		}
+		files = append(files, *file)
+		file = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			file = &File{}
+			// paths are taken from the ---/+++ lines, these are only a fallback for files without hunks
+			if a, b, ok := strings.Cut(strings.TrimPrefix(line, "diff --git "), " b/"); ok {
+				file.OldPath, file.NewPath = strings.TrimPrefix(a, "a/"), b
+			}
+			continue
+		case file == nil:
+			continue
+		}
+
+		if hunk != nil {
+			switch {
+			case strings.HasPrefix(line, " "), strings.HasPrefix(line, "+"), strings.HasPrefix(line, "-"), line == "":
+				hunk.Lines = append(hunk.Lines, line)
+				continue
+			case strings.HasPrefix(line, `\`):
+				// "\ No newline at end of file"
+				continue
+			}
+			file.Hunks = append(file.Hunks, *hunk)
+			hunk = nil
+		}
+
+		switch {
+		case strings.HasPrefix(line, "@@ "):
+			m := hunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("invalid hunk header %q", line)
+			}
+			hunk = &Hunk{
+				OldStart: atoi(m[1], 0),
+				OldLines: atoi(m[2], 1),
+				NewStart: atoi(m[3], 0),
+				NewLines: atoi(m[4], 1),
+				Section:  m[5],
+			}
+		case strings.HasPrefix(line, "--- "):
+			file.OldPath = diffPath(strings.TrimPrefix(line, "--- "), "a/")
+		case strings.HasPrefix(line, "+++ "):
+			file.NewPath = diffPath(strings.TrimPrefix(line, "+++ "), "b/")
+		case strings.HasPrefix(line, "new file mode"):
+			file.OldPath = ""
+		case strings.HasPrefix(line, "deleted file mode"):
+			file.NewPath = ""
+		case strings.HasPrefix(line, "Binary files"):
+			file.Binary = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read diff: %w", err)
+	}
+	flush()
+
+	return files, nil
+}
+
+func diffPath(p, prefix string) string {
+	// git quotes paths with special characters
+	if unquoted, err := strconv.Unquote(p); err == nil {
+		p = unquoted
+	}
+	if p == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(p, prefix)
+}
+
+func atoi(s string, fallback int) int {
+	if s == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
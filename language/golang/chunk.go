@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"go/ast"
+	"go/parser"
 	"go/token"
 	"go/types"
 	"golang.org/x/tools/go/packages"
@@ -106,6 +107,21 @@ func ChunkRepository(path string) ([]Chunk, error) {
 	return allChunks, nil
 }
 
+// ChunkFile parses a single go file into Chunks without loading its package, for files that changed since
+// they were indexed. pkgPath is the file's import path, the package name is used if it's empty
+func ChunkFile(path, pkgPath string) ([]Chunk, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if pkgPath == "" {
+		pkgPath = file.Name.Name
+	}
+	return chunkASTFile(file, fset, pkgPath, nil)
+}
+
 // chunkFile reads a go file and deconstructs it into Chunks
 func chunkASTFile(file *ast.File, fset *token.FileSet, pkgPath string, info *types.Info) ([]Chunk, error) {
 	var chunks []Chunk
@@ -0,0 +1,223 @@
+package golang
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"strings"
+)
+
+// FileDocs holds the doc comments of a file's exported declarations
+type FileDocs struct {
+	Path    string
+	Package string
+
+	// Generated files are left alone, their docs come from the generator
+	Generated bool
+
+	// PackageDoc is the package comment of the file, if it has one
+	PackageDoc string
+
+	// PackageLine is the line of the package clause
+	PackageLine int
+
+	// PackageDocStart and PackageDocEnd are the lines of the package comment, 0 if there's none
+	PackageDocStart, PackageDocEnd int
+
+	Decls []DocDecl
+}
+
+// DocDecl is an exported declaration that should be documented
+type DocDecl struct {
+	// Name is the declared name, without the receiver of methods
+	Name string
+
+	// Receiver is the receiver type of methods
+	Receiver string
+	Kind     ChunkKind
+
+	// Line is the first line of the declaration, the doc comment goes right above it
+	Line int
+
+	// Indent is the indentation of the declaration, for specs of a group
+	Indent string
+
+	// DocStart and DocEnd are the lines of the doc comment, 0 if there's none
+	DocStart, DocEnd int
+	Doc              string
+
+	// GroupDoc documents the group a const, var or type spec is part of, go doc shows it for the whole group
+	GroupDoc string
+
+	// Signature is the declaration without the body of functions
+	Signature string
+	Content   string
+}
+
+// QualifiedName is Name, or Receiver.Name for methods
+func (d DocDecl) QualifiedName() string {
+	if d.Receiver != "" {
+		return d.Receiver + "." + d.Name
+	}
+	return d.Name
+}
+
+// Documented reports whether go doc shows a comment for the declaration
+func (d DocDecl) Documented() bool {
+	return d.Doc != "" || d.GroupDoc != ""
+}
+
+// ParseDocs returns the exported declarations of a Go file with their doc comments. Methods of unexported types are
+// left out, go doc doesn't show them either.
+func ParseDocs(path string) (FileDocs, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return FileDocs{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return FileDocs{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	docs := FileDocs{
+		Path:        path,
+		Package:     file.Name.Name,
+		Generated:   ast.IsGenerated(file),
+		PackageDoc:  file.Doc.Text(),
+		PackageLine: fset.Position(file.Package).Line,
+	}
+	docs.PackageDocStart, docs.PackageDocEnd = commentLines(fset, file.Doc)
+
+	line := func(pos token.Pos) int { return fset.Position(pos).Line }
+	source := func(from, to token.Pos) string {
+		return string(src[fset.Position(from).Offset:fset.Position(to).Offset])
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() {
+				continue
+			}
+			receiver := receiverName(d)
+			if d.Recv != nil && !ast.IsExported(receiver) {
+				continue
+			}
+
+			kind := ChunkKindFunc
+			if receiver != "" {
+				kind = ChunkKindMethod
+			}
+			signature := source(d.Pos(), d.Type.End())
+
+			dd := DocDecl{
+				Name:      d.Name.Name,
+				Receiver:  receiver,
+				Kind:      kind,
+				Line:      line(d.Pos()),
+				Doc:       d.Doc.Text(),
+				Signature: signature,
+				Content:   source(d.Pos(), d.End()),
+			}
+			dd.DocStart, dd.DocEnd = commentLines(fset, d.Doc)
+			docs.Decls = append(docs.Decls, dd)
+
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			grouped := d.Lparen.IsValid()
+			kind := classifyGenDecl(d)
+
+			for _, spec := range d.Specs {
+				var (
+					names []*ast.Ident
+					doc   *ast.CommentGroup
+				)
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					names, doc = []*ast.Ident{s.Name}, s.Doc
+				case *ast.ValueSpec:
+					names, doc = s.Names, s.Doc
+				}
+
+				var name string
+				for _, n := range names {
+					if n.IsExported() {
+						name = n.Name
+						break
+					}
+				}
+				if name == "" {
+					continue
+				}
+
+				dd := DocDecl{Name: name, Kind: kind}
+				if grouped {
+					dd.Line = line(spec.Pos())
+					dd.Indent = indentation(src, fset.Position(spec.Pos()).Offset)
+					dd.GroupDoc = d.Doc.Text()
+					dd.Signature = source(spec.Pos(), spec.End())
+				} else {
+					dd.Line = line(d.Pos())
+					doc = d.Doc
+					dd.Signature = source(d.Pos(), d.End())
+				}
+				dd.Doc = doc.Text()
+				dd.DocStart, dd.DocEnd = commentLines(fset, doc)
+				dd.Content = dd.Signature
+				docs.Decls = append(docs.Decls, dd)
+			}
+		}
+	}
+
+	return docs, nil
+}
+
+// receiverName returns the type name of a method's receiver, without pointers and type parameters
+func receiverName(d *ast.FuncDecl) string {
+	if d.Recv == nil || len(d.Recv.List) == 0 {
+		return ""
+	}
+
+	expr := d.Recv.List[0].Type
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		case *ast.ParenExpr:
+			expr = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			var sb strings.Builder
+			_ = printer.Fprint(&sb, token.NewFileSet(), expr)
+			return sb.String()
+		}
+	}
+}
+
+func commentLines(fset *token.FileSet, doc *ast.CommentGroup) (int, int) {
+	if doc == nil {
+		return 0, 0
+	}
+	return fset.Position(doc.Pos()).Line, fset.Position(doc.End()).Line
+}
+
+// indentation returns the whitespace between the start of the line and offset
+func indentation(src []byte, offset int) string {
+	start := offset
+	for start > 0 && (src[start-1] == ' ' || src[start-1] == '\t') {
+		start--
+	}
+	return string(src[start:offset])
+}
@@ -0,0 +1,41 @@
+package lsp
+
+// PrepareCallHierarchy resolves the function or method at the given position into call hierarchy items
+func (c *Client) PrepareCallHierarchy(uri string, line, char int) ([]CallHierarchyItem, error) {
+	params := TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     Position{Line: line, Character: char},
+	}
+
+	var items []CallHierarchyItem
+	if err := c.call("textDocument/prepareCallHierarchy", params, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// IncomingCalls returns the callers of an item returned by PrepareCallHierarchy
+func (c *Client) IncomingCalls(item CallHierarchyItem) ([]CallHierarchyIncomingCall, error) {
+	params := struct {
+		Item CallHierarchyItem `json:"item"`
+	}{Item: item}
+
+	var calls []CallHierarchyIncomingCall
+	if err := c.call("callHierarchy/incomingCalls", params, &calls); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
+
+// OutgoingCalls returns the callees of an item returned by PrepareCallHierarchy
+func (c *Client) OutgoingCalls(item CallHierarchyItem) ([]CallHierarchyOutgoingCall, error) {
+	params := struct {
+		Item CallHierarchyItem `json:"item"`
+	}{Item: item}
+
+	var calls []CallHierarchyOutgoingCall
+	if err := c.call("callHierarchy/outgoingCalls", params, &calls); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
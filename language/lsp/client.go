@@ -3,24 +3,59 @@ package lsp
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"strconv"
 	"strings"
+	"sync"
 )
 
+// ErrClosed is returned for calls that were pending or made after the server's output ended
+var ErrClosed = errors.New("lsp connection closed")
+
 type Client struct {
 	stdin  io.WriteCloser
 	stdout *bufio.Reader
+
+	// writeMu serializes messages on stdin
+	writeMu sync.Mutex
+
+	mu        sync.Mutex
+	pending   map[string]chan *Message
+	readErr   error
+	documents map[string]document
+
+	diagnostics *diagnosticStore
+
+	// execMu serializes ExecuteCommand, collectedEdits holds the edits the server asks to apply while
+	// a command runs and is nil otherwise
+	execMu         sync.Mutex
+	collectedEdits []WorkspaceEdit
 }
 
-func NewClient(s Server) (*Client, error) {
+// Config is sent to the server during initialization
+type Config struct {
+	// RootURI is the file:// URI of the workspace root
+	RootURI string
+
+	// InitializationOptions are server specific settings
+	InitializationOptions map[string]any
+}
+
+func NewClient(s Server, cfg Config) (*Client, error) {
 	client := &Client{
-		stdin:  s.Stdin(),
-		stdout: s.Stdout(),
+		stdin:       s.Stdin(),
+		stdout:      s.Stdout(),
+		pending:     make(map[string]chan *Message),
+		documents:   make(map[string]document),
+		diagnostics: newDiagnosticStore(),
 	}
 
-	if err := client.initialize(); err != nil {
+	go client.readLoop()
+
+	if err := client.initialize(cfg); err != nil {
 		s.Close()
 		return nil, err
 	}
@@ -29,24 +64,37 @@ func NewClient(s Server) (*Client, error) {
 }
 
 func (c *Client) send(msg *Message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return writeMessage(c.stdin, msg)
+}
+
+func (c *Client) read() (*Message, error) {
+	return readMessage(c.stdout)
+}
+
+// writeMessage writes a message with its Content-Length header, callers serialize writes
+func writeMessage(w io.Writer, msg *Message) error {
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
 
 	head := fmt.Sprintf("Content-Length: %d\r\n\r\n", len(data))
-	if _, err := c.stdin.Write([]byte(head)); err != nil {
+	if _, err := w.Write([]byte(head)); err != nil {
 		return err
 	}
 
-	_, err = c.stdin.Write(data)
+	_, err = w.Write(data)
 	return err
 }
 
-func (c *Client) read() (*Message, error) {
+// readMessage reads the next message, both sides of a connection frame messages the same way
+func readMessage(r *bufio.Reader) (*Message, error) {
 	header := ""
 	for {
-		line, err := c.stdout.ReadString('\n')
+		line, err := r.ReadString('\n')
 		if err != nil {
 			return nil, err
 		}
@@ -59,7 +107,7 @@ func (c *Client) read() (*Message, error) {
 	headers := parseHeaders(header)
 	length, _ := strconv.Atoi(headers["Content-Length"])
 	body := make([]byte, length)
-	_, err := io.ReadFull(c.stdout, body)
+	_, err := io.ReadFull(r, body)
 	if err != nil {
 		return nil, err
 	}
@@ -71,6 +119,157 @@ func (c *Client) read() (*Message, error) {
 	return &msg, nil
 }
 
+// readLoop dispatches everything the server sends.
+// Responses go to the pending call with the same ID, notifications and requests of the server are handled in place.
+func (c *Client) readLoop() {
+	for {
+		msg, err := c.read()
+		if err != nil {
+			c.closePending(err)
+			return
+		}
+
+		switch {
+		case msg.Method == "":
+			c.resolve(msg)
+		case msg.ID == nil:
+			c.handleNotification(msg)
+		default:
+			c.handleRequest(msg)
+		}
+	}
+}
+
+func (c *Client) resolve(msg *Message) {
+	c.mu.Lock()
+	ch, ok := c.pending[string(msg.ID)]
+	delete(c.pending, string(msg.ID))
+	c.mu.Unlock()
+
+	if ok {
+		ch <- msg
+	}
+}
+
+func (c *Client) closePending(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readErr = fmt.Errorf("%w: %v", ErrClosed, err)
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+}
+
+func (c *Client) handleNotification(msg *Message) {
+	switch msg.Method {
+	case "textDocument/publishDiagnostics":
+		var params PublishDiagnosticsParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			log.Printf("invalid diagnostics from language server: %v", err)
+			return
+		}
+		c.diagnostics.publish(params)
+	case "window/logMessage", "window/showMessage":
+		var params struct {
+			Type    int    `json:"type"`
+			Message string `json:"message"`
+		}
+		// only errors are worth surfacing, gopls is chatty
+		if err := json.Unmarshal(msg.Params, &params); err == nil && params.Type == 1 {
+			log.Printf("language server: %s", params.Message)
+		}
+	}
+}
+
+// handleRequest answers requests of the server. Apart from workspace/applyEdit none of them need anything from us,
+// but they have to be answered or the server may wait on them.
+func (c *Client) handleRequest(msg *Message) {
+	resp := &Message{JsonRPC: "2.0", ID: msg.ID, Result: json.RawMessage("null")}
+	if msg.Method == "workspace/applyEdit" {
+		resp.Result = c.collectEdit(msg.Params)
+	}
+	if err := c.send(resp); err != nil {
+		log.Printf("failed to answer %s: %v", msg.Method, err)
+	}
+}
+
+// collectEdit keeps an edit the server asks to apply while ExecuteCommand runs. The edit is reported as applied,
+// goon applies it after the user confirmed it and the server learns about it through didChange like any other change.
+func (c *Client) collectEdit(params json.RawMessage) json.RawMessage {
+	var req struct {
+		Edit WorkspaceEdit `json:"edit"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil {
+		log.Printf("invalid workspace edit from language server: %v", err)
+		return json.RawMessage(`{"applied":false,"failureReason":"invalid workspace edit"}`)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.collectedEdits == nil {
+		return json.RawMessage(`{"applied":false,"failureReason":"edits are only accepted while executing a command"}`)
+	}
+	c.collectedEdits = append(c.collectedEdits, req.Edit)
+	return json.RawMessage(`{"applied":true}`)
+}
+
+// call sends a request and decodes its result into result, which is left untouched for null results
+func (c *Client) call(method string, params any, result any) error {
+	paramBytes, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	msg := newMessage(method, paramBytes)
+	ch := make(chan *Message, 1)
+
+	c.mu.Lock()
+	if c.readErr != nil {
+		c.mu.Unlock()
+		return c.readErr
+	}
+	c.pending[string(msg.ID)] = ch
+	c.mu.Unlock()
+
+	if err := c.send(msg); err != nil {
+		c.mu.Lock()
+		delete(c.pending, string(msg.ID))
+		c.mu.Unlock()
+		return err
+	}
+
+	resp, ok := <-ch
+	if !ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.readErr
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s: %w", method, resp.Error)
+	}
+
+	if len(resp.Result) == 0 || string(resp.Result) == "null" || result == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("failed to decode %s result: %w", method, err)
+	}
+	return nil
+}
+
+// notify sends a notification, which the server doesn't respond to
+func (c *Client) notify(method string, params any) error {
+	paramBytes, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.send(newNotification(method, paramBytes))
+}
+
 func parseHeaders(h string) map[string]string {
 	headers := make(map[string]string)
 	lines := strings.Split(h, "\r\n")
@@ -85,21 +284,49 @@ func parseHeaders(h string) map[string]string {
 	return headers
 }
 
-func (c *Client) initialize() error {
-	params := map[string]interface{}{
-		"processId":    nil,
-		"rootUri":      nil,
-		"capabilities": map[string]any{},
-	}
-	paramBytes, _ := json.Marshal(params)
-	if err := c.send(newMessage("initialize", paramBytes)); err != nil {
-		return err
+func (c *Client) initialize(cfg Config) error {
+	var rootURI any
+	if cfg.RootURI != "" {
+		rootURI = cfg.RootURI
 	}
 
-	_, err := c.read()
-	if err != nil {
+	params := map[string]interface{}{
+		"processId": nil,
+		"rootUri":   rootURI,
+		"capabilities": map[string]any{
+			"textDocument": map[string]any{
+				"documentSymbol": map[string]any{
+					"hierarchicalDocumentSymbolSupport": true,
+				},
+				"hover": map[string]any{
+					"contentFormat": []string{"markdown", "plaintext"},
+				},
+				"publishDiagnostics": map[string]any{},
+				"rename": map[string]any{
+					"prepareSupport": true,
+				},
+				"codeAction": map[string]any{
+					"codeActionLiteralSupport": map[string]any{
+						"codeActionKind": map[string]any{
+							"valueSet": []string{"quickfix", "refactor", "refactor.extract", "refactor.inline", "refactor.rewrite", "source", "source.organizeImports"},
+						},
+					},
+				},
+			},
+			"workspace": map[string]any{
+				"applyEdit": true,
+				"workspaceEdit": map[string]any{
+					"documentChanges":    true,
+					"resourceOperations": []string{"create"},
+				},
+				"executeCommand": map[string]any{},
+			},
+		},
+		"initializationOptions": cfg.InitializationOptions,
+	}
+	if err := c.call("initialize", params, nil); err != nil {
 		return err
 	}
 
-	return c.send(newMessage("initialize", nil))
+	return c.notify("initialized", map[string]any{})
 }
@@ -3,18 +3,37 @@ package lsp
 import (
 	"context"
 	"github.com/sajuno/goon/language/lsp/gopls"
+	"net/url"
+	"path/filepath"
 )
 
-func NewGoplsClient(ctx context.Context) (*Client, error) {
+// NewGoplsClient starts gopls for the workspace at root
+func NewGoplsClient(ctx context.Context, root string) (*Client, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
 	s, err := gopls.Start(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := NewClient(s)
+	client, err := NewClient(s, Config{
+		RootURI: FileURI(root),
+		InitializationOptions: map[string]any{
+			// staticcheck's analyzers in addition to vet's
+			"staticcheck": true,
+		},
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	return client, nil
 }
+
+// FileURI returns the file:// URI of an absolute path
+func FileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
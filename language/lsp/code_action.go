@@ -0,0 +1,111 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Command is a server command, run with ExecuteCommand
+type Command struct {
+	Title     string            `json:"title"`
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments,omitempty"`
+}
+
+// CodeAction is a quick fix or refactoring. Its Edit is applied before its Command is executed,
+// either may be missing. Servers answering with bare Commands are converted to CodeActions with only a Command.
+type CodeAction struct {
+	Title       string         `json:"title"`
+	Kind        string         `json:"kind,omitempty"`
+	Diagnostics []Diagnostic   `json:"diagnostics,omitempty"`
+	IsPreferred bool           `json:"isPreferred,omitempty"`
+	Edit        *WorkspaceEdit `json:"edit,omitempty"`
+	Command     *Command       `json:"command,omitempty"`
+}
+
+// CodeActions returns the code actions for a range of a document. diagnostics are the ones overlapping the range,
+// quick fixes are offered for them. only limits the kinds of actions, like "quickfix" or "refactor", if given.
+func (c *Client) CodeActions(uri string, rng Range, diagnostics []Diagnostic, only ...string) ([]CodeAction, error) {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+
+	actionContext := map[string]any{"diagnostics": diagnostics}
+	if len(only) > 0 {
+		actionContext["only"] = only
+	}
+	params := map[string]any{
+		"textDocument": TextDocumentIdentifier{URI: uri},
+		"range":        rng,
+		"context":      actionContext,
+	}
+
+	var raw []json.RawMessage
+	if err := c.call("textDocument/codeAction", params, &raw); err != nil {
+		return nil, err
+	}
+
+	actions := make([]CodeAction, 0, len(raw))
+	for _, r := range raw {
+		var probe struct {
+			Command json.RawMessage `json:"command"`
+		}
+		if err := json.Unmarshal(r, &probe); err != nil {
+			return nil, fmt.Errorf("failed to decode code action: %w", err)
+		}
+
+		// a Command has a string command, a CodeAction an optional Command object
+		var name string
+		if json.Unmarshal(probe.Command, &name) == nil && name != "" {
+			var cmd Command
+			if err := json.Unmarshal(r, &cmd); err != nil {
+				return nil, fmt.Errorf("failed to decode command: %w", err)
+			}
+			actions = append(actions, CodeAction{Title: cmd.Title, Command: &cmd})
+			continue
+		}
+
+		var action CodeAction
+		if err := json.Unmarshal(r, &action); err != nil {
+			return nil, fmt.Errorf("failed to decode code action: %w", err)
+		}
+		actions = append(actions, action)
+	}
+
+	return actions, nil
+}
+
+// ExecuteCommand runs a server command. Servers apply the edits of commands by asking the client to,
+// those edits are returned instead of being applied so they can be previewed.
+func (c *Client) ExecuteCommand(cmd Command) (json.RawMessage, []WorkspaceEdit, error) {
+	// edits are collected per command, commands can't run concurrently
+	c.execMu.Lock()
+	defer c.execMu.Unlock()
+
+	c.mu.Lock()
+	c.collectedEdits = []WorkspaceEdit{}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.collectedEdits = nil
+		c.mu.Unlock()
+	}()
+
+	params := struct {
+		Command   string            `json:"command"`
+		Arguments []json.RawMessage `json:"arguments,omitempty"`
+	}{Command: cmd.Command, Arguments: cmd.Arguments}
+
+	var result json.RawMessage
+	err := c.call("workspace/executeCommand", params, &result)
+
+	c.mu.Lock()
+	edits := c.collectedEdits
+	c.mu.Unlock()
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, edits, nil
+}
@@ -0,0 +1,281 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+)
+
+// JSON-RPC and LSP error codes of responses
+const (
+	CodeParseError           = -32700
+	CodeInvalidParams        = -32602
+	CodeMethodNotFound       = -32601
+	CodeInternalError        = -32603
+	CodeServerNotInitialized = -32002
+	CodeRequestCancelled     = -32800
+)
+
+// Handler answers the requests and notifications an editor sends to a server. The result of a notification is
+// dropped, an error returned for a request is sent as is if it's an *Error and as an internal error otherwise.
+type Handler func(ctx context.Context, method string, params json.RawMessage) (any, error)
+
+// Conn is the server side of a connection to an editor. Notifications are handled in order, requests concurrently
+// so long running ones don't block the editor, and the server can call the editor while handling them.
+type Conn struct {
+	r *bufio.Reader
+	w io.Writer
+
+	// writeMu serializes messages on w
+	writeMu sync.Mutex
+
+	mu sync.Mutex
+
+	// pending holds the calls to the editor waiting for a response, inflight cancels the editor's requests
+	pending  map[string]chan *Message
+	inflight map[string]context.CancelFunc
+	readErr  error
+}
+
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{
+		r:        bufio.NewReader(r),
+		w:        w,
+		pending:  make(map[string]chan *Message),
+		inflight: make(map[string]context.CancelFunc),
+	}
+}
+
+// Serve reads messages until the editor sends exit, closes the connection or ctx is cancelled.
+// Requests still running then are cancelled, Serve doesn't wait for them.
+func (c *Conn) Serve(ctx context.Context, handler Handler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	messages := make(chan *Message)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := readMessage(c.r)
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				log.Printf("invalid message from editor: %v", err)
+				continue
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		var msg *Message
+		select {
+		case <-ctx.Done():
+			c.closePending(ctx.Err())
+			return ctx.Err()
+		case err := <-readErr:
+			c.closePending(err)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case msg = <-messages:
+		}
+
+		switch {
+		case msg.Method == "":
+			c.resolve(msg)
+		case msg.Method == "exit":
+			c.closePending(io.EOF)
+			return nil
+		case msg.Method == "$/cancelRequest":
+			c.cancel(msg.Params)
+		case msg.ID == nil:
+			if _, err := handler(ctx, msg.Method, msg.Params); err != nil {
+				log.Printf("failed to handle %s: %v", msg.Method, err)
+			}
+		default:
+			reqCtx, reqCancel := context.WithCancel(ctx)
+			c.mu.Lock()
+			c.inflight[string(msg.ID)] = reqCancel
+			c.mu.Unlock()
+
+			go c.handleRequest(reqCtx, handler, msg)
+		}
+	}
+}
+
+func (c *Conn) handleRequest(ctx context.Context, handler Handler, msg *Message) {
+	defer func() {
+		c.mu.Lock()
+		if cancel, ok := c.inflight[string(msg.ID)]; ok {
+			cancel()
+			delete(c.inflight, string(msg.ID))
+		}
+		c.mu.Unlock()
+	}()
+
+	resp := &Message{JsonRPC: "2.0", ID: msg.ID}
+	result, err := handler(ctx, msg.Method, msg.Params)
+	switch {
+	case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+		resp.Error = &Error{Code: CodeRequestCancelled, Message: "request cancelled"}
+	case err != nil:
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+	default:
+		data, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = &Error{Code: CodeInternalError, Message: fmt.Sprintf("failed to encode result: %v", err)}
+			break
+		}
+		resp.Result = data
+	}
+
+	if err := c.send(resp); err != nil {
+		log.Printf("failed to answer %s: %v", msg.Method, err)
+	}
+}
+
+// cancel cancels the context of a request in flight, the handler decides whether it stops
+func (c *Conn) cancel(params json.RawMessage) {
+	var p struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cancel, ok := c.inflight[string(p.ID)]; ok {
+		cancel()
+	}
+}
+
+// Call sends a request to the editor and decodes its result into result, which is left untouched for null results
+func (c *Conn) Call(ctx context.Context, method string, params any, result any) error {
+	paramBytes, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	msg := newMessage(method, paramBytes)
+	ch := make(chan *Message, 1)
+
+	c.mu.Lock()
+	if c.readErr != nil {
+		c.mu.Unlock()
+		return c.readErr
+	}
+	c.pending[string(msg.ID)] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, string(msg.ID))
+		c.mu.Unlock()
+	}()
+
+	if err := c.send(msg); err != nil {
+		return err
+	}
+
+	var resp *Message
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case r, ok := <-ch:
+		if !ok {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return c.readErr
+		}
+		resp = r
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s: %w", method, resp.Error)
+	}
+
+	if len(resp.Result) == 0 || string(resp.Result) == "null" || result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("failed to decode %s result: %w", method, err)
+	}
+	return nil
+}
+
+// Notify sends a notification to the editor
+func (c *Conn) Notify(method string, params any) error {
+	paramBytes, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.send(newNotification(method, paramBytes))
+}
+
+// PublishDiagnostics replaces the diagnostics the server shows for a document, an empty list clears them.
+// Severities are sent as numbers, editors don't accept the names Diagnostic is encoded with otherwise.
+func (c *Conn) PublishDiagnostics(uri string, diagnostics []Diagnostic) error {
+	type wireDiagnostic struct {
+		Diagnostic
+		Severity int `json:"severity,omitempty"`
+	}
+
+	wire := make([]wireDiagnostic, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		wire = append(wire, wireDiagnostic{Diagnostic: d, Severity: int(d.Severity)})
+	}
+	return c.Notify("textDocument/publishDiagnostics", map[string]any{
+		"uri":         uri,
+		"diagnostics": wire,
+	})
+}
+
+func (c *Conn) send(msg *Message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return writeMessage(c.w, msg)
+}
+
+func (c *Conn) resolve(msg *Message) {
+	c.mu.Lock()
+	ch, ok := c.pending[string(msg.ID)]
+	delete(c.pending, string(msg.ID))
+	c.mu.Unlock()
+
+	if ok {
+		ch <- msg
+	}
+}
+
+func (c *Conn) closePending(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readErr = fmt.Errorf("%w: %v", ErrClosed, err)
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	for _, cancel := range c.inflight {
+		cancel()
+	}
+}
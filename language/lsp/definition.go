@@ -10,29 +10,15 @@ func (c *Client) GoToDefinition(uri string, line, char int) (*Location, error) {
 		TextDocument: TextDocumentIdentifier{URI: uri},
 		Position:     Position{Line: line, Character: char},
 	}
-	paramBytes, _ := json.Marshal(params)
-	msg := newMessage(
-		"textDocument/definition",
-		paramBytes,
-	)
 
-	if err := c.send(msg); err != nil {
+	var result json.RawMessage
+	if err := c.call("textDocument/definition", params, &result); err != nil {
 		return nil, err
 	}
 
-	resp, err := c.read()
+	locations, err := decodeLocations(result)
 	if err != nil {
-		return nil, err
-	}
-
-	var locations []Location
-	if err := json.Unmarshal(resp.Result, &locations); err != nil {
-		var single Location
-		if err2 := json.Unmarshal(resp.Result, &single); err2 == nil {
-			locations = append(locations, single)
-		} else {
-			return nil, fmt.Errorf("failed to decode location: %w", err)
-		}
+		return nil, fmt.Errorf("failed to decode location: %w", err)
 	}
 	if len(locations) == 0 {
 		return nil, nil
@@ -40,3 +26,20 @@ func (c *Client) GoToDefinition(uri string, line, char int) (*Location, error) {
 
 	return &locations[0], nil
 }
+
+// decodeLocations decodes results that can be a single Location, a list of them or null
+func decodeLocations(result json.RawMessage) ([]Location, error) {
+	if len(result) == 0 || string(result) == "null" {
+		return nil, nil
+	}
+
+	var locations []Location
+	if err := json.Unmarshal(result, &locations); err != nil {
+		var single Location
+		if err2 := json.Unmarshal(result, &single); err2 != nil {
+			return nil, err
+		}
+		locations = append(locations, single)
+	}
+	return locations, nil
+}
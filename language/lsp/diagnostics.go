@@ -0,0 +1,80 @@
+package lsp
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// diagnosticStore keeps the latest diagnostics per URI, servers replace them wholesale with every publish
+type diagnosticStore struct {
+	mu    sync.Mutex
+	byURI map[string][]Diagnostic
+
+	// published is signalled on every publish, without blocking
+	published chan struct{}
+}
+
+func newDiagnosticStore() *diagnosticStore {
+	return &diagnosticStore{
+		byURI:     make(map[string][]Diagnostic),
+		published: make(chan struct{}, 1),
+	}
+}
+
+func (s *diagnosticStore) publish(params PublishDiagnosticsParams) {
+	s.mu.Lock()
+	if len(params.Diagnostics) == 0 {
+		delete(s.byURI, params.URI)
+	} else {
+		s.byURI[params.URI] = params.Diagnostics
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.published <- struct{}{}:
+	default:
+	}
+}
+
+// Diagnostics returns the latest diagnostics published for a document
+func (c *Client) Diagnostics(uri string) []Diagnostic {
+	c.diagnostics.mu.Lock()
+	defer c.diagnostics.mu.Unlock()
+
+	return slices.Clone(c.diagnostics.byURI[uri])
+}
+
+// AllDiagnostics returns the latest diagnostics of every document that has any
+func (c *Client) AllDiagnostics() map[string][]Diagnostic {
+	c.diagnostics.mu.Lock()
+	defer c.diagnostics.mu.Unlock()
+
+	return maps.Clone(c.diagnostics.byURI)
+}
+
+// WaitForDiagnostics blocks until the server published diagnostics and then stayed quiet for the given period,
+// or until ctx is done. Servers publish asynchronously after files are opened or changed, there is no explicit end.
+func (c *Client) WaitForDiagnostics(ctx context.Context, quiet time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.diagnostics.published:
+	}
+
+	timer := time.NewTimer(quiet)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.diagnostics.published:
+			timer.Reset(quiet)
+		case <-timer.C:
+			return nil
+		}
+	}
+}
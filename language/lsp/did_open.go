@@ -1,18 +1,47 @@
 package lsp
 
-import (
-	"encoding/json"
-)
-
+// DidOpen opens a document in the server. Opening an already open document is safe,
+// changed text is sent as a full didChange instead and unchanged text is a no-op.
 func (c *Client) DidOpen(uri, langID, text string, version int) error {
+	c.mu.Lock()
+	doc, open := c.documents[uri]
+	if open && doc.text == text {
+		c.mu.Unlock()
+		return nil
+	}
+	if open {
+		version = max(version, doc.version+1)
+	}
+	c.documents[uri] = document{version: version, text: text}
+	c.mu.Unlock()
+
+	if open {
+		params := DidChangeTextDocumentParams{}
+		params.TextDocument.URI = uri
+		params.TextDocument.Version = version
+		params.ContentChanges = []TextDocumentContentChangeEvent{{Text: text}}
+		return c.notify("textDocument/didChange", params)
+	}
+
 	params := DidOpenTextDocumentParams{}
 	params.TextDocument.URI = uri
 	params.TextDocument.LanguageID = langID
 	params.TextDocument.Version = version
 	params.TextDocument.Text = text
-	paramBytes, _ := json.Marshal(params)
-	return c.send(newMessage(
-		"textDocument/didOpen",
-		paramBytes,
-	))
+	return c.notify("textDocument/didOpen", params)
+}
+
+// IsOpen reports whether a document has been opened
+func (c *Client) IsOpen(uri string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.documents[uri]
+	return ok
+}
+
+// document is the state of an opened document as the server knows it
+type document struct {
+	version int
+	text    string
 }
@@ -0,0 +1,16 @@
+package lsp
+
+// Hover returns the type and documentation of the symbol at the given position, nil if there is nothing to show
+func (c *Client) Hover(uri string, line, char int) (*Hover, error) {
+	params := TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     Position{Line: line, Character: char},
+	}
+
+	var hover *Hover
+	if err := c.call("textDocument/hover", params, &hover); err != nil {
+		return nil, err
+	}
+
+	return hover, nil
+}
@@ -0,0 +1,36 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Implementation returns the implementations of the interface (method) at the given position,
+// or the interfaces implemented by the type at it
+func (c *Client) Implementation(uri string, line, char int) ([]Location, error) {
+	return c.locations("textDocument/implementation", uri, line, char)
+}
+
+// TypeDefinition returns the definition of the type of the symbol at the given position
+func (c *Client) TypeDefinition(uri string, line, char int) ([]Location, error) {
+	return c.locations("textDocument/typeDefinition", uri, line, char)
+}
+
+// locations calls a position based method that results in locations
+func (c *Client) locations(method, uri string, line, char int) ([]Location, error) {
+	params := TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     Position{Line: line, Character: char},
+	}
+
+	var result json.RawMessage
+	if err := c.call(method, params, &result); err != nil {
+		return nil, err
+	}
+
+	locations, err := decodeLocations(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s locations: %w", method, err)
+	}
+	return locations, nil
+}
@@ -2,22 +2,35 @@ package lsp
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/google/uuid"
+	"strconv"
+	"strings"
 )
 
 type Message struct {
-	JsonRPC string          `json:"jsonrpc"`
-	ID      string          `json:"id,omitempty"`
-	Method  string          `json:"method,omitempty"`
-	Params  json.RawMessage `json:"params,omitempty"`
-	Result  json.RawMessage `json:"result,omitempty"`
-	Error   *Error          `json:"error,omitempty"`
+	JsonRPC string `json:"jsonrpc"`
+
+	// ID is kept raw, servers may use numbers or strings and responses have to echo it exactly
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
 }
 
 func newMessage(method string, params json.RawMessage) *Message {
 	return &Message{
 		JsonRPC: "2.0",
-		ID:      uuid.NewString(),
+		ID:      json.RawMessage(strconv.Quote(uuid.NewString())),
+		Method:  method,
+		Params:  params,
+	}
+}
+
+func newNotification(method string, params json.RawMessage) *Message {
+	return &Message{
+		JsonRPC: "2.0",
 		Method:  method,
 		Params:  params,
 	}
@@ -28,6 +41,10 @@ type Error struct {
 	Message string `json:"message"`
 }
 
+func (e *Error) Error() string {
+	return fmt.Sprintf("lsp error %d: %s", e.Code, e.Message)
+}
+
 type Position struct {
 	Line      int `json:"line"`
 	Character int `json:"character"`
@@ -51,10 +68,214 @@ type DidOpenTextDocumentParams struct {
 	} `json:"textDocument"`
 }
 
+// DidChangeTextDocumentParams only supports full document changes, which is all goon sends
+type DidChangeTextDocumentParams struct {
+	TextDocument struct {
+		URI     string `json:"uri"`
+		Version int    `json:"version"`
+	} `json:"textDocument"`
+	ContentChanges []TextDocumentContentChangeEvent `json:"contentChanges"`
+}
+
+type TextDocumentContentChangeEvent struct {
+	Text string `json:"text"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
 type Location struct {
 	URI   string `json:"uri"`
-	Range struct {
-		Start Position `json:"start"`
-		End   Position `json:"end"`
-	} `json:"range"`
+	Range Range  `json:"range"`
+}
+
+// MarkupContent is LSP's MarkupContent, the deprecated MarkedString forms are decoded into it as well
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+func (m *MarkupContent) UnmarshalJSON(b []byte) error {
+	// plain string
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*m = MarkupContent{Kind: "plaintext", Value: s}
+		return nil
+	}
+
+	// list of MarkedStrings, joined as markdown
+	if len(b) > 0 && b[0] == '[' {
+		var parts []MarkupContent
+		if err := json.Unmarshal(b, &parts); err != nil {
+			return err
+		}
+		values := make([]string, 0, len(parts))
+		for _, p := range parts {
+			values = append(values, p.Value)
+		}
+		*m = MarkupContent{Kind: "markdown", Value: strings.Join(values, "\n\n")}
+		return nil
+	}
+
+	// MarkupContent or a MarkedString with a language
+	var obj struct {
+		Kind     string `json:"kind"`
+		Language string `json:"language"`
+		Value    string `json:"value"`
+	}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return err
+	}
+	if obj.Language != "" {
+		*m = MarkupContent{Kind: "markdown", Value: fmt.Sprintf("```%s\n%s\n```", obj.Language, obj.Value)}
+		return nil
+	}
+	*m = MarkupContent{Kind: obj.Kind, Value: obj.Value}
+	return nil
+}
+
+// Hover is the result of textDocument/hover, usually a symbol's signature and documentation
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+// SignatureHelp is the result of textDocument/signatureHelp
+type SignatureHelp struct {
+	Signatures      []SignatureInformation `json:"signatures"`
+	ActiveSignature int                    `json:"activeSignature"`
+	ActiveParameter int                    `json:"activeParameter"`
+}
+
+type SignatureInformation struct {
+	Label         string                 `json:"label"`
+	Documentation *MarkupContent         `json:"documentation,omitempty"`
+	Parameters    []ParameterInformation `json:"parameters,omitempty"`
+}
+
+type ParameterInformation struct {
+	// Label is either the parameter's text or a [start, end) range within the signature's label
+	Label         json.RawMessage `json:"label"`
+	Documentation *MarkupContent  `json:"documentation,omitempty"`
+}
+
+// SymbolKind is LSP's SymbolKind enumeration. It's encoded as a number like the protocol requires,
+// call hierarchy items are sent back to the server as they were received. Tool output uses its name instead.
+type SymbolKind int
+
+var symbolKindNames = []string{
+	"", "file", "module", "namespace", "package", "class", "method", "property", "field", "constructor",
+	"enum", "interface", "function", "variable", "constant", "string", "number", "boolean", "array",
+	"object", "key", "null", "enum_member", "struct", "event", "operator", "type_parameter",
+}
+
+func (k SymbolKind) String() string {
+	if k > 0 && int(k) < len(symbolKindNames) {
+		return symbolKindNames[k]
+	}
+	return fmt.Sprintf("kind(%d)", int(k))
+}
+
+// DocumentSymbol is a symbol declared in a document, with its nested symbols as children
+type DocumentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           SymbolKind       `json:"kind"`
+	Range          Range            `json:"range"`
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []DocumentSymbol `json:"children,omitempty"`
+}
+
+// SymbolInformation is a symbol with its location, as returned by workspace/symbol
+type SymbolInformation struct {
+	Name          string     `json:"name"`
+	Kind          SymbolKind `json:"kind"`
+	Location      Location   `json:"location"`
+	ContainerName string     `json:"containerName,omitempty"`
+}
+
+// CallHierarchyItem is a function or method in a call hierarchy.
+// Data is opaque to the client and has to be sent back unchanged in calls requests.
+type CallHierarchyItem struct {
+	Name           string          `json:"name"`
+	Kind           SymbolKind      `json:"kind"`
+	Detail         string          `json:"detail,omitempty"`
+	URI            string          `json:"uri"`
+	Range          Range           `json:"range"`
+	SelectionRange Range           `json:"selectionRange"`
+	Data           json.RawMessage `json:"data,omitempty"`
+}
+
+// CallHierarchyIncomingCall is a caller of an item, FromRanges are the call sites within From
+type CallHierarchyIncomingCall struct {
+	From       CallHierarchyItem `json:"from"`
+	FromRanges []Range           `json:"fromRanges"`
+}
+
+// CallHierarchyOutgoingCall is a callee of an item, FromRanges are the call sites within the calling item
+type CallHierarchyOutgoingCall struct {
+	To         CallHierarchyItem `json:"to"`
+	FromRanges []Range           `json:"fromRanges"`
+}
+
+// DiagnosticSeverity is LSP's DiagnosticSeverity, it's encoded by name for readability
+type DiagnosticSeverity int
+
+const (
+	SeverityError       DiagnosticSeverity = 1
+	SeverityWarning     DiagnosticSeverity = 2
+	SeverityInformation DiagnosticSeverity = 3
+	SeverityHint        DiagnosticSeverity = 4
+)
+
+var severityNames = []string{"", "error", "warning", "information", "hint"}
+
+func (s DiagnosticSeverity) String() string {
+	if s > 0 && int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return "error" // servers should treat a missing severity as an error
+}
+
+func (s DiagnosticSeverity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *DiagnosticSeverity) UnmarshalJSON(b []byte) error {
+	var n int
+	if err := json.Unmarshal(b, &n); err == nil {
+		*s = DiagnosticSeverity(n)
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return err
+	}
+	for i, severityName := range severityNames {
+		if severityName == name && i > 0 {
+			*s = DiagnosticSeverity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown diagnostic severity %q", name)
+}
+
+// Diagnostic is a compiler error, vet finding or lint published by the server
+type Diagnostic struct {
+	Range    Range              `json:"range"`
+	Severity DiagnosticSeverity `json:"severity,omitempty"`
+
+	// Code is a number or a string, depending on the source
+	Code    json.RawMessage `json:"code,omitempty"`
+	Source  string          `json:"source,omitempty"`
+	Message string          `json:"message"`
+}
+
+type PublishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Version     *int         `json:"version,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
 }
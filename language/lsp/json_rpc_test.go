@@ -0,0 +1,41 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCallHierarchyItemRoundTrip(t *testing.T) {
+	// as gopls sends it from textDocument/prepareCallHierarchy
+	in := `{"name":"Review","kind":12,"detail":"github.com/sajuno/goon/agent","uri":"file:///repo/agent/review.go",` +
+		`"range":{"start":{"line":59,"character":0},"end":{"line":72,"character":1}},` +
+		`"selectionRange":{"start":{"line":59,"character":17},"end":{"line":59,"character":23}},` +
+		`"data":{"opaque":[1,2]}}`
+
+	var item CallHierarchyItem
+	if err := json.Unmarshal([]byte(in), &item); err != nil {
+		t.Fatalf("failed to decode item: %v", err)
+	}
+	if item.Kind != 12 || item.Kind.String() != "function" {
+		t.Fatalf("kind = %d (%s), want 12 (function)", item.Kind, item.Kind)
+	}
+
+	out, err := json.Marshal(item)
+	if err != nil {
+		t.Fatalf("failed to encode item: %v", err)
+	}
+
+	// the item goes back to the server in callHierarchy/incomingCalls and outgoingCalls and has to be unchanged
+	var want, got map[string]any
+	if err := json.Unmarshal([]byte(in), &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	wantJSON, _ := json.Marshal(want)
+	gotJSON, _ := json.Marshal(got)
+	if string(gotJSON) != string(wantJSON) {
+		t.Fatalf("round trip changed the item\n got: %s\nwant: %s", gotJSON, wantJSON)
+	}
+}
@@ -0,0 +1,64 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// PrepareRename is the result of textDocument/prepareRename
+type PrepareRename struct {
+	// Range is the identifier that would be renamed
+	Range       Range  `json:"range"`
+	Placeholder string `json:"placeholder,omitempty"`
+}
+
+// PrepareRename checks whether the symbol at the given position can be renamed, nil is returned if it can't.
+func (c *Client) PrepareRename(uri string, line, char int) (*PrepareRename, error) {
+	params := TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     Position{Line: line, Character: char},
+	}
+
+	var result json.RawMessage
+	if err := c.call("textDocument/prepareRename", params, &result); err != nil {
+		return nil, err
+	}
+	if len(result) == 0 || string(result) == "null" {
+		return nil, nil
+	}
+
+	// the result is a Range, a range with a placeholder or {defaultBehavior: true}
+	var prepared struct {
+		PrepareRename
+		Start           *Position `json:"start"`
+		End             *Position `json:"end"`
+		DefaultBehavior bool      `json:"defaultBehavior"`
+	}
+	if err := json.Unmarshal(result, &prepared); err != nil {
+		return nil, fmt.Errorf("failed to decode prepareRename result: %w", err)
+	}
+	if prepared.Start != nil && prepared.End != nil {
+		prepared.Range = Range{Start: *prepared.Start, End: *prepared.End}
+	}
+	return &prepared.PrepareRename, nil
+}
+
+// Rename returns the edits that rename the symbol at the given position, without applying them
+func (c *Client) Rename(uri string, line, char int, newName string) (*WorkspaceEdit, error) {
+	params := struct {
+		TextDocumentPositionParams
+		NewName string `json:"newName"`
+	}{
+		TextDocumentPositionParams: TextDocumentPositionParams{
+			TextDocument: TextDocumentIdentifier{URI: uri},
+			Position:     Position{Line: line, Character: char},
+		},
+		NewName: newName,
+	}
+
+	var edit WorkspaceEdit
+	if err := c.call("textDocument/rename", params, &edit); err != nil {
+		return nil, err
+	}
+	return &edit, nil
+}
@@ -0,0 +1,61 @@
+package lsp
+
+import (
+	"encoding/json"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// SignatureHelp returns the signature of the function call surrounding the given position
+func (c *Client) SignatureHelp(uri string, line, char int) (*SignatureHelp, error) {
+	params := TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     Position{Line: line, Character: char},
+	}
+
+	var help *SignatureHelp
+	if err := c.call("textDocument/signatureHelp", params, &help); err != nil {
+		return nil, err
+	}
+	if help == nil {
+		return nil, nil
+	}
+
+	// resolve offset labels to text, they're meaningless without the signature
+	for i := range help.Signatures {
+		sig := &help.Signatures[i]
+		for j := range sig.Parameters {
+			var offsets [2]int
+			if err := json.Unmarshal(sig.Parameters[j].Label, &offsets); err != nil {
+				continue
+			}
+			start, ok := labelOffset(sig.Label, offsets[0])
+			if !ok {
+				continue
+			}
+			end, ok := labelOffset(sig.Label, offsets[1])
+			if !ok || start > end {
+				continue
+			}
+			sig.Parameters[j].Label, _ = json.Marshal(sig.Label[start:end])
+		}
+	}
+
+	return help, nil
+}
+
+// labelOffset converts an offset in UTF-16 code units, which label ranges are given in, to a byte offset of label.
+// It's false for offsets outside of the label or within a rune.
+func labelOffset(label string, units int) (int, bool) {
+	if units < 0 {
+		return 0, false
+	}
+
+	n, i := 0, 0
+	for i < len(label) && n < units {
+		r, size := utf8.DecodeRuneInString(label[i:])
+		n += utf16.RuneLen(r)
+		i += size
+	}
+	return i, n == units
+}
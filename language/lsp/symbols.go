@@ -0,0 +1,66 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DocumentSymbols returns the symbols declared in a document.
+// Servers answering with flat SymbolInformation are converted to DocumentSymbols without children.
+func (c *Client) DocumentSymbols(uri string) ([]DocumentSymbol, error) {
+	params := struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+	}{TextDocument: TextDocumentIdentifier{URI: uri}}
+
+	var raw []json.RawMessage
+	if err := c.call("textDocument/documentSymbol", params, &raw); err != nil {
+		return nil, err
+	}
+
+	symbols := make([]DocumentSymbol, 0, len(raw))
+	for _, r := range raw {
+		var probe struct {
+			Location *Location `json:"location"`
+		}
+		if err := json.Unmarshal(r, &probe); err != nil {
+			return nil, fmt.Errorf("failed to decode document symbol: %w", err)
+		}
+
+		if probe.Location != nil {
+			var info SymbolInformation
+			if err := json.Unmarshal(r, &info); err != nil {
+				return nil, fmt.Errorf("failed to decode symbol information: %w", err)
+			}
+			symbols = append(symbols, DocumentSymbol{
+				Name:           info.Name,
+				Detail:         info.ContainerName,
+				Kind:           info.Kind,
+				Range:          info.Location.Range,
+				SelectionRange: info.Location.Range,
+			})
+			continue
+		}
+
+		var sym DocumentSymbol
+		if err := json.Unmarshal(r, &sym); err != nil {
+			return nil, fmt.Errorf("failed to decode document symbol: %w", err)
+		}
+		symbols = append(symbols, sym)
+	}
+
+	return symbols, nil
+}
+
+// WorkspaceSymbol searches symbols across the workspace by (fuzzy) name
+func (c *Client) WorkspaceSymbol(query string) ([]SymbolInformation, error) {
+	params := struct {
+		Query string `json:"query"`
+	}{Query: query}
+
+	var symbols []SymbolInformation
+	if err := c.call("workspace/symbol", params, &symbols); err != nil {
+		return nil, err
+	}
+
+	return symbols, nil
+}
@@ -0,0 +1,154 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// TextEdit replaces a range of a document, AnnotatedTextEdits decode into it as well
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// ResourceOperation creates, renames or deletes a file as part of a WorkspaceEdit
+type ResourceOperation struct {
+	// Kind is "create", "rename" or "delete"
+	Kind string `json:"kind"`
+
+	// URI is set for create and delete, OldURI and NewURI for rename
+	URI    string `json:"uri,omitempty"`
+	OldURI string `json:"oldUri,omitempty"`
+	NewURI string `json:"newUri,omitempty"`
+}
+
+// WorkspaceEdit is a set of changes to documents. Servers send text edits either as changes or as documentChanges,
+// both are decoded into Changes. Resource operations are kept in order in Operations.
+type WorkspaceEdit struct {
+	Changes    map[string][]TextEdit `json:"changes,omitempty"`
+	Operations []ResourceOperation   `json:"-"`
+}
+
+func (e *WorkspaceEdit) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Changes         map[string][]TextEdit `json:"changes"`
+		DocumentChanges []json.RawMessage     `json:"documentChanges"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	e.Changes = raw.Changes
+	if e.Changes == nil {
+		e.Changes = make(map[string][]TextEdit)
+	}
+
+	// documentChanges take precedence over changes if a server sends both
+	if len(raw.DocumentChanges) > 0 {
+		e.Changes = make(map[string][]TextEdit)
+	}
+	for _, dc := range raw.DocumentChanges {
+		var probe struct {
+			Kind string `json:"kind"`
+		}
+		if err := json.Unmarshal(dc, &probe); err != nil {
+			return fmt.Errorf("failed to decode document change: %w", err)
+		}
+
+		if probe.Kind != "" {
+			var op ResourceOperation
+			if err := json.Unmarshal(dc, &op); err != nil {
+				return fmt.Errorf("failed to decode %s operation: %w", probe.Kind, err)
+			}
+			e.Operations = append(e.Operations, op)
+			continue
+		}
+
+		var edit struct {
+			TextDocument TextDocumentIdentifier `json:"textDocument"`
+			Edits        []TextEdit             `json:"edits"`
+		}
+		if err := json.Unmarshal(dc, &edit); err != nil {
+			return fmt.Errorf("failed to decode text document edit: %w", err)
+		}
+		e.Changes[edit.TextDocument.URI] = append(e.Changes[edit.TextDocument.URI], edit.Edits...)
+	}
+
+	return nil
+}
+
+// ApplyTextEdits applies edits to a document. Edits must not overlap, edits at the same position are applied in
+// order. Characters are UTF-16 code units, like LSP positions are by default.
+func ApplyTextEdits(text string, edits []TextEdit) (string, error) {
+	type span struct {
+		start, end int
+		newText    string
+	}
+
+	lineStarts := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	offset := func(p Position) (int, error) {
+		if p.Line < 0 || p.Line >= len(lineStarts) {
+			if p.Line == len(lineStarts) && p.Character == 0 {
+				return len(text), nil
+			}
+			return 0, fmt.Errorf("line %d is outside of the document's %d lines", p.Line, len(lineStarts))
+		}
+
+		start := lineStarts[p.Line]
+		end := len(text)
+		if p.Line+1 < len(lineStarts) {
+			end = lineStarts[p.Line+1] - 1
+		}
+
+		// characters past the end of a line mean the end of the line
+		units, i := 0, start
+		for i < end && units < p.Character {
+			r, size := utf8.DecodeRuneInString(text[i:end])
+			units += utf16.RuneLen(r)
+			i += size
+		}
+		return i, nil
+	}
+
+	spans := make([]span, 0, len(edits))
+	for _, e := range edits {
+		start, err := offset(e.Range.Start)
+		if err != nil {
+			return "", err
+		}
+		end, err := offset(e.Range.End)
+		if err != nil {
+			return "", err
+		}
+		if end < start {
+			return "", fmt.Errorf("edit ends before it starts at %d:%d", e.Range.Start.Line, e.Range.Start.Character)
+		}
+		spans = append(spans, span{start: start, end: end, newText: e.NewText})
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var sb strings.Builder
+	pos := 0
+	for _, s := range spans {
+		if s.start < pos {
+			return "", fmt.Errorf("edits overlap at offset %d", s.start)
+		}
+		sb.WriteString(text[pos:s.start])
+		sb.WriteString(s.newText)
+		pos = s.end
+	}
+	sb.WriteString(text[pos:])
+
+	return sb.String(), nil
+}
@@ -0,0 +1,314 @@
+package lspserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/agent"
+	"github.com/sajuno/goon/language/lsp"
+	"github.com/sajuno/goon/session"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// codeActionKind is the kind of goon's code actions, editors list refactorings with the selection
+const codeActionKind = "refactor.goon"
+
+// Commands run with workspace/executeCommand. Explain, test and review take the document URI and a range as
+// arguments, ask a URI, a position and the question.
+const (
+	commandExplain      = "goon.explain"
+	commandGenerateTest = "goon.generateTest"
+	commandReview       = "goon.review"
+	commandAsk          = "goon.ask"
+)
+
+func commandNames() []string {
+	return []string{commandExplain, commandGenerateTest, commandReview, commandAsk}
+}
+
+// codeActions offers goon's commands for the selection, reviews only for non-empty selections
+func (s *server) codeActions(p lsp.CodeActionParams) []lsp.CodeAction {
+	actions := []lsp.CodeAction{}
+	if !wantsKind(p.Context.Only) {
+		return actions
+	}
+	path, err := uriPath(p.TextDocument.URI)
+	if err != nil || filepath.Ext(path) != ".go" {
+		return actions
+	}
+	if _, err := s.agent.Workspace().Abs(path); err != nil {
+		return actions
+	}
+
+	args := arguments(p.TextDocument.URI, p.Range)
+	action := func(title, command string) lsp.CodeAction {
+		return lsp.CodeAction{
+			Title:   title,
+			Kind:    codeActionKind,
+			Command: &lsp.Command{Title: title, Command: command, Arguments: args},
+		}
+	}
+
+	actions = append(actions, action("Explain this", commandExplain))
+	if !strings.HasSuffix(path, "_test.go") {
+		actions = append(actions, action("Generate test", commandGenerateTest))
+	}
+	if p.Range.Start != p.Range.End {
+		actions = append(actions, action("Review selection", commandReview))
+	}
+	return actions
+}
+
+// wantsKind reports whether goon's actions are among the kinds an editor asks for, all kinds if it names none
+func wantsKind(only []string) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, kind := range only {
+		if kind == codeActionKind || strings.HasPrefix(codeActionKind, kind+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func arguments(values ...any) []json.RawMessage {
+	args := make([]json.RawMessage, 0, len(values))
+	for _, v := range values {
+		b, _ := json.Marshal(v)
+		args = append(args, b)
+	}
+	return args
+}
+
+// decodeArguments decodes the arguments of a command into targets, in order
+func decodeArguments(args []json.RawMessage, targets ...any) error {
+	if len(args) != len(targets) {
+		return &lsp.Error{Code: lsp.CodeInvalidParams, Message: fmt.Sprintf("expected %d arguments, got %d", len(targets), len(args))}
+	}
+	for i, arg := range args {
+		if err := json.Unmarshal(arg, targets[i]); err != nil {
+			return &lsp.Error{Code: lsp.CodeInvalidParams, Message: fmt.Sprintf("invalid argument %d: %v", i+1, err)}
+		}
+	}
+	return nil
+}
+
+// executeCommand runs one of goon's commands. Failures are shown to the user as well as returned,
+// editors don't reliably surface errors of commands they run from code actions.
+func (s *server) executeCommand(ctx context.Context, p lsp.ExecuteCommandParams) (any, error) {
+	var (
+		uri string
+		rng lsp.Range
+	)
+
+	var run func(ctx context.Context) (any, error)
+	switch p.Command {
+	case commandExplain, commandGenerateTest, commandReview:
+		if err := decodeArguments(p.Arguments, &uri, &rng); err != nil {
+			return nil, err
+		}
+		switch p.Command {
+		case commandExplain:
+			run = func(ctx context.Context) (any, error) { return s.explain(ctx, uri, rng) }
+		case commandGenerateTest:
+			run = func(ctx context.Context) (any, error) { return s.generateTest(ctx, uri, rng) }
+		case commandReview:
+			run = func(ctx context.Context) (any, error) { return s.review(ctx, uri, rng) }
+		}
+	case commandAsk:
+		var (
+			pos      lsp.Position
+			question string
+		)
+		if err := decodeArguments(p.Arguments, &uri, &pos, &question); err != nil {
+			return nil, err
+		}
+		run = func(ctx context.Context) (any, error) { return s.ask(ctx, uri, pos, question) }
+	default:
+		return nil, &lsp.Error{Code: lsp.CodeInvalidParams, Message: "unknown command " + p.Command}
+	}
+
+	s.busy.Lock()
+	defer s.busy.Unlock()
+
+	result, err := run(ctx)
+	if err != nil && ctx.Err() == nil {
+		s.showMessage(lsp.MessageError, "goon: "+err.Error())
+	}
+	return result, err
+}
+
+func (s *server) explain(ctx context.Context, uri string, rng lsp.Range) (any, error) {
+	question := agent.DefaultAskQuestion
+	if startLine, endLine := lineRange(rng); endLine > startLine {
+		question = fmt.Sprintf("Explain lines %d-%d.", startLine, endLine)
+	}
+	return s.ask(ctx, uri, rng.Start, question)
+}
+
+func (s *server) ask(ctx context.Context, uri string, pos lsp.Position, question string) (any, error) {
+	loc, err := s.location(uri, pos)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	sess, ok := s.sessionsByURI[uri]
+	if !ok {
+		sess = session.New()
+		s.sessionsByURI[uri] = sess
+	}
+	s.mu.Unlock()
+
+	out := s.startProgress(ctx, "goon: "+question)
+	answer, err := s.agent.Ask(ctx, sess, loc, question, out)
+	out.end()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sessions.Save(sess); err != nil {
+		s.showMessage(lsp.MessageWarning, fmt.Sprintf("goon: failed to save session: %v", err))
+	}
+
+	s.showAnswer(ctx, "answer", fmt.Sprintf("# %s\n\n_%s_\n\n%s\n", question, s.agent.Workspace().Display(loc.Path), answer))
+	return answer, nil
+}
+
+func (s *server) generateTest(ctx context.Context, uri string, rng lsp.Range) (any, error) {
+	loc, err := s.location(uri, rng.Start)
+	if err != nil {
+		return nil, err
+	}
+
+	out := s.startProgress(ctx, "goon: generating tests")
+	generated, err := s.agent.GenerateTestAt(ctx, loc, agent.DefaultTestAttempts, out)
+	out.end()
+	if err != nil {
+		return nil, err
+	}
+
+	// the test passed with the file overlaid, it's only written once the user saw it
+	s.showAnswer(ctx, "test", fmt.Sprintf("# %s\n\n%s pass after %d attempt(s)\n\n```diff\n%s```\n",
+		generated.Path, strings.Join(generated.Tests, ", "), generated.Attempts, generated.Changes.Patch))
+	write, err := s.confirm(ctx, fmt.Sprintf("Write %s?", generated.Path))
+	if err != nil || !write {
+		return nil, err
+	}
+	if err := s.agent.ApplyChanges(ctx, generated.Changes); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", generated.Path, err)
+	}
+
+	path := filepath.Join(s.agent.Workspace().Root(), filepath.FromSlash(generated.Path))
+	s.showDocument(ctx, lsp.FileURI(path))
+	return generated, nil
+}
+
+// review reviews the selected lines and shows the comments as diagnostics, until the document is closed
+func (s *server) review(ctx context.Context, uri string, rng lsp.Range) (any, error) {
+	loc, err := s.location(uri, rng.Start)
+	if err != nil {
+		return nil, err
+	}
+	startLine, endLine := lineRange(rng)
+
+	out := s.startProgress(ctx, "goon: reviewing")
+	review, err := s.agent.ReviewLines(ctx, loc.Path, startLine, endLine, out)
+	out.end()
+	if err != nil {
+		return nil, err
+	}
+
+	diagnostics := []lsp.Diagnostic{}
+	for _, f := range review.Files {
+		for _, c := range f.Comments {
+			line := c.Line
+			if line == 0 {
+				line = startLine
+			}
+			code, _ := json.Marshal(string(c.Severity))
+			diagnostics = append(diagnostics, lsp.Diagnostic{
+				Range:    lsp.Range{Start: lsp.Position{Line: line - 1}, End: lsp.Position{Line: line}},
+				Severity: reviewSeverity(c.Severity),
+				Code:     code,
+				Source:   "goon",
+				Message:  c.Body,
+			})
+		}
+	}
+
+	s.mu.Lock()
+	s.reviewed[uri] = true
+	s.mu.Unlock()
+	if err := s.conn.PublishDiagnostics(uri, diagnostics); err != nil {
+		return nil, err
+	}
+
+	summary := review.Summary
+	if len(diagnostics) == 0 {
+		summary += " No comments."
+	}
+	s.showMessage(lsp.MessageInfo, "goon: "+summary)
+	return review, nil
+}
+
+func reviewSeverity(severity agent.ReviewSeverity) lsp.DiagnosticSeverity {
+	switch severity {
+	case agent.ReviewIssue:
+		return lsp.SeverityWarning
+	case agent.ReviewSuggestion:
+		return lsp.SeverityInformation
+	default:
+		return lsp.SeverityHint
+	}
+}
+
+// lineRange returns the 1-based, inclusive lines of a range. A range ending at the start of a line, like
+// a selection of whole lines, doesn't include that line.
+func lineRange(rng lsp.Range) (int, int) {
+	start, end := rng.Start.Line+1, rng.End.Line+1
+	if rng.End.Character == 0 && rng.End.Line > rng.Start.Line {
+		end--
+	}
+	return start, max(start, end)
+}
+
+// showAnswer opens an answer as a markdown document in the editor, or shows it as a message if the editor can't
+// open documents for a server
+func (s *server) showAnswer(ctx context.Context, name, markdown string) {
+	dir := filepath.Join(os.TempDir(), "goon")
+	path := filepath.Join(dir, name+"-"+strconv.FormatInt(time.Now().UnixNano(), 36)+".md")
+	if err := os.MkdirAll(dir, 0o755); err == nil {
+		if err := os.WriteFile(path, []byte(markdown), 0o644); err == nil && s.showDocument(ctx, lsp.FileURI(path)) {
+			return
+		}
+	}
+	s.showMessage(lsp.MessageInfo, markdown)
+}
+
+// showDocument asks the editor to open a document, reporting whether it did
+func (s *server) showDocument(ctx context.Context, uri string) bool {
+	s.mu.Lock()
+	supported := s.capabilities.Window.ShowDocument.Support
+	s.mu.Unlock()
+	if !supported {
+		return false
+	}
+
+	var result lsp.ShowDocumentResult
+	err := s.conn.Call(ctx, "window/showDocument", lsp.ShowDocumentParams{URI: uri, TakeFocus: true}, &result)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		s.showMessage(lsp.MessageWarning, fmt.Sprintf("goon: failed to open %s: %v", uri, err))
+	}
+	return err == nil && result.Success
+}
+
+func (s *server) showMessage(typ lsp.MessageType, message string) {
+	_ = s.conn.Notify("window/showMessage", lsp.ShowMessageParams{Type: typ, Message: message})
+}
@@ -0,0 +1,60 @@
+package lspserver
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/sajuno/goon/language/lsp"
+	"log"
+)
+
+// progress shows the status of a command as work done progress in the editor. Answers aren't streamed,
+// they're shown once complete.
+type progress struct {
+	conn  *lsp.Conn
+	token string
+}
+
+// startProgress begins a progress with a title, editors that don't support work done progress get the status
+// in the server's log instead
+func (s *server) startProgress(ctx context.Context, title string) *progress {
+	s.mu.Lock()
+	supported := s.capabilities.Window.WorkDoneProgress
+	s.mu.Unlock()
+
+	p := &progress{conn: s.conn}
+	if !supported {
+		log.Print(title)
+		return p
+	}
+
+	token := uuid.NewString()
+	if err := s.conn.Call(ctx, "window/workDoneProgress/create", lsp.WorkDoneProgressCreateParams{Token: token}, nil); err != nil {
+		log.Printf("failed to create progress: %v", err)
+		return p
+	}
+	p.token = token
+	p.send(lsp.WorkDoneProgress{Kind: "begin", Title: title})
+	return p
+}
+
+func (p *progress) Delta(string) {}
+
+func (p *progress) Status(text string) {
+	if p.token == "" {
+		log.Print(text)
+		return
+	}
+	p.send(lsp.WorkDoneProgress{Kind: "report", Message: text})
+}
+
+func (p *progress) end() {
+	if p.token != "" {
+		p.send(lsp.WorkDoneProgress{Kind: "end"})
+	}
+}
+
+func (p *progress) send(value lsp.WorkDoneProgress) {
+	if err := p.conn.Notify("$/progress", lsp.ProgressParams{Token: p.token, Value: value}); err != nil {
+		log.Printf("failed to report progress: %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package lspserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/agent"
+	"github.com/sajuno/goon/language/lsp"
+	"github.com/sajuno/goon/session"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Serve runs goon as a language server for an editor, speaking LSP on in and out until the editor exits.
+// Explanations and reviews run the same agent as the other commands, questions about a document share a session
+// while it's open so they can be followed up on.
+func Serve(ctx context.Context, ag *agent.Agent, sessions *session.Store, in io.Reader, out io.Writer) error {
+	s := &server{
+		conn:          lsp.NewConn(in, out),
+		agent:         ag,
+		sessions:      sessions,
+		sessionsByURI: make(map[string]*session.Session),
+		documents:     make(map[string]string),
+		reviewed:      make(map[string]bool),
+	}
+	ag.SetConfirm(s.confirm)
+
+	return s.conn.Serve(ctx, s.handle)
+}
+
+type server struct {
+	conn     *lsp.Conn
+	agent    *agent.Agent
+	sessions *session.Store
+
+	// busy serializes the commands running the agent
+	busy sync.Mutex
+
+	mu           sync.Mutex
+	initialized  bool
+	capabilities lsp.ClientCapabilities
+
+	// documents holds the text of the documents open in the editor, reviewed the documents with review diagnostics
+	documents map[string]string
+	reviewed  map[string]bool
+
+	// sessionsByURI holds the conversation about each document, questions about it follow up on each other
+	sessionsByURI map[string]*session.Session
+}
+
+func (s *server) handle(ctx context.Context, method string, params json.RawMessage) (any, error) {
+	if method != "initialize" && !s.isInitialized() {
+		return nil, &lsp.Error{Code: lsp.CodeServerNotInitialized, Message: "initialize has to be sent first"}
+	}
+
+	switch method {
+	case "initialize":
+		return s.initialize(params)
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		var p lsp.DidOpenTextDocumentParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.setDocument(p.TextDocument.URI, p.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var p lsp.DidChangeTextDocumentParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		// changes are full documents, the last one is the current text
+		if n := len(p.ContentChanges); n > 0 {
+			s.setDocument(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var p lsp.DidCloseTextDocumentParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		return nil, s.closeDocument(p.TextDocument.URI)
+	case "textDocument/hover":
+		var p lsp.TextDocumentPositionParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.hover(ctx, p)
+	case "textDocument/codeAction":
+		var p lsp.CodeActionParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.codeActions(p), nil
+	case "workspace/executeCommand":
+		var p lsp.ExecuteCommandParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.executeCommand(ctx, p)
+	default:
+		return nil, &lsp.Error{Code: lsp.CodeMethodNotFound, Message: "method not supported: " + method}
+	}
+}
+
+func (s *server) initialize(params json.RawMessage) (any, error) {
+	var p lsp.InitializeParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, invalidParams(err)
+	}
+
+	s.mu.Lock()
+	s.initialized = true
+	s.capabilities = p.Capabilities
+	s.mu.Unlock()
+
+	if p.RootURI != "" {
+		if _, err := s.agent.Workspace().Abs(p.RootURI); err != nil {
+			log.Printf("the editor's workspace %s isn't the indexed repository %s, only files in the latter are supported", p.RootURI, s.agent.Workspace().Root())
+		}
+	}
+
+	return lsp.InitializeResult{
+		Capabilities: lsp.ServerCapabilities{
+			TextDocumentSync:       lsp.TextDocumentSyncFull,
+			HoverProvider:          true,
+			CodeActionProvider:     &lsp.CodeActionOptions{CodeActionKinds: []string{codeActionKind}},
+			ExecuteCommandProvider: &lsp.ExecuteCommandOptions{Commands: commandNames()},
+		},
+		ServerInfo: &lsp.ServerInfo{Name: "goon"},
+	}, nil
+}
+
+// hover adds what the index knows about the identifier under the cursor, editors show it next to gopls' hover.
+// Failures only mean there's nothing to add.
+func (s *server) hover(ctx context.Context, p lsp.TextDocumentPositionParams) (*lsp.Hover, error) {
+	loc, err := s.location(p.TextDocument.URI, p.Position)
+	if err != nil {
+		return nil, nil
+	}
+
+	markdown, err := s.agent.IndexHover(ctx, loc)
+	if err != nil {
+		log.Printf("no hover for %s: %v", loc, err)
+		return nil, nil
+	}
+	if markdown == "" {
+		return nil, nil
+	}
+	return &lsp.Hover{Contents: lsp.MarkupContent{Kind: "markdown", Value: markdown}}, nil
+}
+
+func (s *server) isInitialized() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.initialized
+}
+
+func (s *server) setDocument(uri, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.documents[uri] = text
+}
+
+func (s *server) closeDocument(uri string) error {
+	s.mu.Lock()
+	delete(s.documents, uri)
+	reviewed := s.reviewed[uri]
+	delete(s.reviewed, uri)
+	// the conversation stays resumable from the session store, the next question starts a new one
+	delete(s.sessionsByURI, uri)
+	s.mu.Unlock()
+
+	if reviewed {
+		return s.conn.PublishDiagnostics(uri, nil)
+	}
+	return nil
+}
+
+// location converts a position in an editor's document to a location on disk. The agent works on the files on
+// disk, documents with unsaved changes would have it look at different code than the editor shows.
+func (s *server) location(uri string, pos lsp.Position) (agent.Location, error) {
+	path, err := uriPath(uri)
+	if err != nil {
+		return agent.Location{}, err
+	}
+
+	disk, err := os.ReadFile(path)
+	if err != nil {
+		return agent.Location{}, err
+	}
+
+	s.mu.Lock()
+	text, open := s.documents[uri]
+	s.mu.Unlock()
+	if open && text != string(disk) {
+		return agent.Location{}, fmt.Errorf("%s has unsaved changes, save it first", filepath.Base(path))
+	}
+
+	lines := bytes.Split(disk, []byte("\n"))
+	if pos.Line < 0 || pos.Line >= len(lines) {
+		return agent.Location{}, fmt.Errorf("line %d is outside of %s", pos.Line+1, filepath.Base(path))
+	}
+
+	return agent.Location{Path: path, Line: pos.Line + 1, Col: byteColumn(string(lines[pos.Line]), pos.Character)}, nil
+}
+
+// byteColumn converts a character of a line in UTF-16 code units to a 1-based byte column
+func byteColumn(line string, character int) int {
+	units, i := 0, 0
+	for i < len(line) && units < character {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		units += utf16.RuneLen(r)
+		i += size
+	}
+	return i + 1
+}
+
+func uriPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("%s is not a file", uri)
+	}
+	return filepath.FromSlash(u.Path), nil
+}
+
+// confirm asks the user with a message offering yes and no, a dismissed message is a no
+func (s *server) confirm(ctx context.Context, prompt string) (bool, error) {
+	var picked *lsp.MessageActionItem
+	err := s.conn.Call(ctx, "window/showMessageRequest", lsp.ShowMessageRequestParams{
+		Type:    lsp.MessageInfo,
+		Message: "goon: " + prompt,
+		Actions: []lsp.MessageActionItem{{Title: "Yes"}, {Title: "No"}},
+	}, &picked)
+	if err != nil {
+		return false, err
+	}
+	return picked != nil && picked.Title == "Yes", nil
+}
+
+func invalidParams(err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return &lsp.Error{Code: lsp.CodeParseError, Message: err.Error()}
+	}
+	return &lsp.Error{Code: lsp.CodeInvalidParams, Message: err.Error()}
+}
@@ -0,0 +1,230 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/language/lsp"
+	"github.com/sajuno/goon/openai/tools/functions"
+	"io"
+	"log"
+	"slices"
+	"sync"
+)
+
+// protocolVersions are the MCP versions the server speaks, newest first. The tools subset goon implements
+// didn't change between them.
+var protocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// maxMessageSize bounds a single message, tool arguments are small
+const maxMessageSize = 4 << 20
+
+// Serve runs a Model Context Protocol server on in and out, offering tools as MCP tools until in is closed and
+// the calls in flight are answered. Messages are JSON-RPC, one per line. Tool calls run concurrently and can be
+// cancelled by the client.
+func Serve(ctx context.Context, tools *functions.Registry, in io.Reader, out io.Writer) error {
+	s := &server{
+		tools:    tools,
+		out:      out,
+		inflight: make(map[string]context.CancelFunc),
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+
+	var wg sync.WaitGroup
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var msg lsp.Message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			s.send(&lsp.Message{JsonRPC: "2.0", ID: json.RawMessage("null"), Error: &lsp.Error{Code: lsp.CodeParseError, Message: err.Error()}})
+			continue
+		}
+
+		switch {
+		case msg.Method == "":
+			// responses, the server doesn't call the client
+		case msg.ID == nil:
+			s.handleNotification(&msg)
+		default:
+			reqCtx, reqCancel := context.WithCancel(ctx)
+			s.mu.Lock()
+			s.inflight[string(msg.ID)] = reqCancel
+			s.mu.Unlock()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.handleRequest(reqCtx, &msg)
+			}()
+		}
+	}
+
+	// calls in flight are answered, clients may close their end once they sent everything
+	wg.Wait()
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read message: %w", err)
+	}
+	return nil
+}
+
+type server struct {
+	tools *functions.Registry
+
+	// writeMu serializes messages on out
+	writeMu sync.Mutex
+	out     io.Writer
+
+	mu       sync.Mutex
+	inflight map[string]context.CancelFunc
+}
+
+func (s *server) handleNotification(msg *lsp.Message) {
+	if msg.Method != "notifications/cancelled" {
+		return
+	}
+
+	var params struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, ok := s.inflight[string(params.RequestID)]; ok {
+		cancel()
+	}
+}
+
+func (s *server) handleRequest(ctx context.Context, msg *lsp.Message) {
+	defer func() {
+		s.mu.Lock()
+		if cancel, ok := s.inflight[string(msg.ID)]; ok {
+			cancel()
+			delete(s.inflight, string(msg.ID))
+		}
+		s.mu.Unlock()
+	}()
+
+	result, err := s.handle(ctx, msg.Method, msg.Params)
+
+	// cancelled requests aren't answered
+	if ctx.Err() != nil {
+		return
+	}
+
+	resp := &lsp.Message{JsonRPC: "2.0", ID: msg.ID}
+	if err != nil {
+		var rpcErr *lsp.Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &lsp.Error{Code: lsp.CodeInternalError, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+	} else if resp.Result, err = json.Marshal(result); err != nil {
+		resp.Error = &lsp.Error{Code: lsp.CodeInternalError, Message: fmt.Sprintf("failed to encode result: %v", err)}
+	}
+	s.send(resp)
+}
+
+func (s *server) handle(ctx context.Context, method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &lsp.Error{Code: lsp.CodeInvalidParams, Message: err.Error()}
+		}
+
+		// answer with the client's version if it's supported, the client decides whether it can work with ours otherwise
+		version := protocolVersions[0]
+		if slices.Contains(protocolVersions, p.ProtocolVersion) {
+			version = p.ProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{"listChanged": false}},
+			"serverInfo":      map[string]any{"name": "goon", "version": "dev"},
+			"instructions":    "goon indexes a Go repository. Search it semantically, look up declarations by name and navigate with gopls, positions are 0-based and paths relative to the repository root.",
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return s.listTools(), nil
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &lsp.Error{Code: lsp.CodeInvalidParams, Message: err.Error()}
+		}
+		return s.callTool(ctx, p.Name, p.Arguments)
+	default:
+		return nil, &lsp.Error{Code: lsp.CodeMethodNotFound, Message: "method not supported: " + method}
+	}
+}
+
+type tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+func (s *server) listTools() map[string]any {
+	tools := make([]tool, 0, len(s.tools.Tools()))
+	for _, t := range s.tools.Tools() {
+		description := t.Description
+		for _, example := range t.Examples {
+			description += "\nExample: " + string(example)
+		}
+		tools = append(tools, tool{Name: t.Name, Description: description, InputSchema: t.Schema()})
+	}
+	return map[string]any{"tools": tools}
+}
+
+type content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type callResult struct {
+	Content []content `json:"content"`
+	IsError bool      `json:"isError"`
+}
+
+// callTool runs a tool, failed calls are results with isError set so the calling model sees what went wrong.
+// Unknown tools are protocol errors.
+func (s *server) callTool(ctx context.Context, name string, arguments json.RawMessage) (callResult, error) {
+	if !slices.ContainsFunc(s.tools.Tools(), func(t functions.Tool) bool { return t.Name == name }) {
+		return callResult{}, &lsp.Error{Code: lsp.CodeInvalidParams, Message: fmt.Sprintf("unknown tool %q", name)}
+	}
+
+	output, failed := s.tools.Invoke(ctx, name, string(arguments))
+	return callResult{Content: []content{{Type: "text", Text: output}}, IsError: failed}, nil
+}
+
+func (s *server) send(msg *lsp.Message) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("failed to encode response: %v", err)
+		return
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if _, err := s.out.Write(append(b, '\n')); err != nil {
+		log.Printf("failed to send response: %v", err)
+	}
+}
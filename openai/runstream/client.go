@@ -0,0 +1,91 @@
+// Package runstream implements OpenAI's streaming Assistants runs, which go-openai doesn't support.
+// Runs are created and resumed with server-sent events instead of being polled for their status.
+package runstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const DefaultBaseURL = "https://api.openai.com/v1"
+
+type Client struct {
+	apiKey  string
+	baseURL string
+	http    *http.Client
+}
+
+func New(apiKey, baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{apiKey: apiKey, baseURL: baseURL, http: http.DefaultClient}
+}
+
+// CreateRun starts a run on the thread and streams its events
+func (c *Client) CreateRun(ctx context.Context, threadID string, req openai.RunRequest) (*Stream, error) {
+	body := struct {
+		openai.RunRequest
+		Stream bool `json:"stream"`
+	}{RunRequest: req, Stream: true}
+
+	return c.stream(ctx, fmt.Sprintf("/threads/%s/runs", threadID), body)
+}
+
+// SubmitToolOutputs resumes a run that requires action and streams its remaining events
+func (c *Client) SubmitToolOutputs(ctx context.Context, threadID, runID string, req openai.SubmitToolOutputsRequest) (*Stream, error) {
+	body := struct {
+		openai.SubmitToolOutputsRequest
+		Stream bool `json:"stream"`
+	}{SubmitToolOutputsRequest: req, Stream: true}
+
+	return c.stream(ctx, fmt.Sprintf("/threads/%s/runs/%s/submit_tool_outputs", threadID, runID), body)
+}
+
+func (c *Client) stream(ctx context.Context, path string, body any) (*Stream, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("OpenAI-Beta", "assistants=v2")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, decodeError(resp)
+	}
+
+	return newStream(resp.Body), nil
+}
+
+func decodeError(resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+
+	var apiErr struct {
+		Error *openai.APIError `json:"error"`
+	}
+	if err := json.Unmarshal(b, &apiErr); err == nil && apiErr.Error != nil {
+		apiErr.Error.HTTPStatusCode = resp.StatusCode
+		return apiErr.Error
+	}
+
+	return &openai.RequestError{HTTPStatusCode: resp.StatusCode, Err: fmt.Errorf("%s", bytes.TrimSpace(b))}
+}
@@ -0,0 +1,154 @@
+package runstream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Event names of the Assistants streaming API, see https://platform.openai.com/docs/api-reference/assistants-streaming/events
+const (
+	EventRunCreated        = "thread.run.created"
+	EventRunQueued         = "thread.run.queued"
+	EventRunInProgress     = "thread.run.in_progress"
+	EventRunRequiresAction = "thread.run.requires_action"
+	EventRunCompleted      = "thread.run.completed"
+	EventRunIncomplete     = "thread.run.incomplete"
+	EventRunFailed         = "thread.run.failed"
+	EventRunCancelling     = "thread.run.cancelling"
+	EventRunCancelled      = "thread.run.cancelled"
+	EventRunExpired        = "thread.run.expired"
+	EventMessageDelta      = "thread.message.delta"
+	EventMessageCompleted  = "thread.message.completed"
+	EventError             = "error"
+	EventDone              = "done"
+)
+
+// Event is a single server-sent event of a run
+type Event struct {
+	Name string
+	Data json.RawMessage
+}
+
+// IsRunEvent reports whether the event's data is a run object
+func (e Event) IsRunEvent() bool {
+	return strings.HasPrefix(e.Name, "thread.run.") && !strings.HasPrefix(e.Name, "thread.run.step.")
+}
+
+func (e Event) Run() (openai.Run, error) {
+	var run openai.Run
+	err := json.Unmarshal(e.Data, &run)
+	return run, err
+}
+
+func (e Event) Message() (openai.Message, error) {
+	var msg openai.Message
+	err := json.Unmarshal(e.Data, &msg)
+	return msg, err
+}
+
+func (e Event) MessageDelta() (MessageDelta, error) {
+	var delta MessageDelta
+	err := json.Unmarshal(e.Data, &delta)
+	return delta, err
+}
+
+func (e Event) Error() error {
+	var apiErr openai.APIError
+	if err := json.Unmarshal(e.Data, &apiErr); err != nil {
+		return fmt.Errorf("stream error: %s", e.Data)
+	}
+	return &apiErr
+}
+
+// MessageDelta is the data of a thread.message.delta event
+type MessageDelta struct {
+	ID    string `json:"id"`
+	Delta struct {
+		Content []MessageDeltaContent `json:"content"`
+	} `json:"delta"`
+}
+
+type MessageDeltaContent struct {
+	Index     int                 `json:"index"`
+	Type      string              `json:"type"`
+	Text      *openai.MessageText `json:"text,omitempty"`
+	ImageFile *openai.ImageFile   `json:"image_file,omitempty"`
+	ImageURL  *openai.ImageURL    `json:"image_url,omitempty"`
+}
+
+// Text concatenates all text content of the delta
+func (d MessageDelta) Text() string {
+	var sb strings.Builder
+	for _, c := range d.Delta.Content {
+		if c.Text != nil {
+			sb.WriteString(c.Text.Value)
+		}
+	}
+	return sb.String()
+}
+
+// Stream reads the events of a single streaming request
+type Stream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+}
+
+func newStream(body io.ReadCloser) *Stream {
+	return &Stream{body: body, reader: bufio.NewReader(body)}
+}
+
+// Recv returns the next event, io.EOF once the stream is done
+func (s *Stream) Recv() (Event, error) {
+	var (
+		event Event
+		data  bytes.Buffer
+	)
+
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && event.Name != "" {
+				break
+			}
+			return Event{}, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			// blank line terminates an event, but skip keep-alives without any content
+			if event.Name == "" && data.Len() == 0 {
+				continue
+			}
+			break
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event.Name = value
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		}
+	}
+
+	if event.Name == EventDone {
+		return Event{}, io.EOF
+	}
+
+	event.Data = data.Bytes()
+	return event, nil
+}
+
+func (s *Stream) Close() error {
+	return s.body.Close()
+}
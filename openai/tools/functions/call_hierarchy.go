@@ -0,0 +1,38 @@
+package functions
+
+import "github.com/sajuno/goon/language/lsp"
+
+// CallHierarchyInput points at a function or method, both incoming_calls and outgoing_calls take it
+type CallHierarchyInput struct {
+	URI       string `json:"uri" jsonschema_description:"Path relative to the repository root"`
+	Line      int    `json:"line" jsonschema:"minimum=0" jsonschema_description:"0-based line"`
+	Character int    `json:"character" jsonschema:"minimum=0" jsonschema_description:"0-based character offset in the line"`
+}
+
+// CallHierarchyItem is a function or method of a call hierarchy with its kind by name
+type CallHierarchyItem struct {
+	lsp.CallHierarchyItem
+	Kind string `json:"kind"`
+}
+
+func NewCallHierarchyItem(item lsp.CallHierarchyItem) CallHierarchyItem {
+	return CallHierarchyItem{CallHierarchyItem: item, Kind: item.Kind.String()}
+}
+
+type IncomingCall struct {
+	From       CallHierarchyItem `json:"from"`
+	FromRanges []lsp.Range       `json:"fromRanges"`
+}
+
+type OutgoingCall struct {
+	To         CallHierarchyItem `json:"to"`
+	FromRanges []lsp.Range       `json:"fromRanges"`
+}
+
+type IncomingCallsOutput struct {
+	Calls []IncomingCall `json:"calls"`
+}
+
+type OutgoingCallsOutput struct {
+	Calls []OutgoingCall `json:"calls"`
+}
@@ -0,0 +1,17 @@
+package functions
+
+import "github.com/sajuno/goon/language/lsp"
+
+type DiagnosticsInput struct {
+	// URI of the document, empty for every document with diagnostics
+	URI string `json:"uri" jsonschema_description:"Path relative to the repository root, empty for every document with diagnostics"`
+}
+
+type DiagnosticsOutput struct {
+	Documents []DocumentDiagnostics `json:"documents"`
+}
+
+type DocumentDiagnostics struct {
+	URI         string           `json:"uri"`
+	Diagnostics []lsp.Diagnostic `json:"diagnostics"`
+}
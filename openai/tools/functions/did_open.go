@@ -1,14 +1,10 @@
 package functions
 
-import "github.com/sajuno/goon/language/lsp"
-
 type DidOpenInput struct {
-	URI       string `json:"uri"`
-	Text      string `json:"text"`
-	LangID    string `json:"lang_id"`
-	VersionID int    `json:"version_id"`
+	URI     string `json:"uri" jsonschema_description:"Path relative to the repository root"`
+	Text    string `json:"text"`
+	LangID  string `json:"lang_id"`
+	Version int    `json:"version"`
 }
 
-type DidOpenOutput struct {
-	Error *lsp.Error `json:"error"`
-}
+type DidOpenOutput struct{}
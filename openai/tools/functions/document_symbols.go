@@ -0,0 +1,26 @@
+package functions
+
+import "github.com/sajuno/goon/language/lsp"
+
+type DocumentSymbolsInput struct {
+	URI string `json:"uri" jsonschema_description:"Path relative to the repository root"`
+}
+
+// DocumentSymbol is a symbol declared in a document with its kind by name
+type DocumentSymbol struct {
+	lsp.DocumentSymbol
+	Kind     string           `json:"kind"`
+	Children []DocumentSymbol `json:"children,omitempty"`
+}
+
+func NewDocumentSymbols(symbols []lsp.DocumentSymbol) []DocumentSymbol {
+	out := make([]DocumentSymbol, 0, len(symbols))
+	for _, sym := range symbols {
+		out = append(out, DocumentSymbol{DocumentSymbol: sym, Kind: sym.Kind.String(), Children: NewDocumentSymbols(sym.Children)})
+	}
+	return out
+}
+
+type DocumentSymbolsOutput struct {
+	Symbols []DocumentSymbol `json:"symbols"`
+}
@@ -0,0 +1,9 @@
+package functions
+
+type ExplainInput struct {
+	Query string `json:"query" jsonschema_description:"Question about the code base, answered by goon from its index and language server"`
+}
+
+type ExplainOutput struct {
+	Answer string `json:"answer"`
+}
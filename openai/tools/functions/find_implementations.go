@@ -0,0 +1,13 @@
+package functions
+
+import "github.com/sajuno/goon/language/lsp"
+
+type FindImplementationsInput struct {
+	URI       string `json:"uri" jsonschema_description:"Path relative to the repository root"`
+	Line      int    `json:"line" jsonschema:"minimum=0" jsonschema_description:"0-based line"`
+	Character int    `json:"character" jsonschema:"minimum=0" jsonschema_description:"0-based character offset in the line"`
+}
+
+type FindImplementationsOutput struct {
+	Locations []lsp.Location `json:"locations"`
+}
@@ -3,12 +3,11 @@ package functions
 import "github.com/sajuno/goon/language/lsp"
 
 type FindReferencesInput struct {
-	URI       string `json:"uri"`
-	Line      int    `json:"line"`
-	Character int    `json:"character"`
+	URI       string `json:"uri" jsonschema_description:"Path relative to the repository root"`
+	Line      int    `json:"line" jsonschema:"minimum=0" jsonschema_description:"0-based line"`
+	Character int    `json:"character" jsonschema:"minimum=0" jsonschema_description:"0-based character offset in the line"`
 }
 
 type FindReferencesOutput struct {
 	Locations []lsp.Location `json:"locations"`
-	Error     *lsp.Error     `json:"error,omitempty"`
 }
@@ -3,12 +3,11 @@ package functions
 import "github.com/sajuno/goon/language/lsp"
 
 type GoToDefinitionInput struct {
-	URI       string `json:"URI"`
-	Line      int    `json:"Line"`
-	Character int    `json:"Character"`
+	URI       string `json:"uri" jsonschema_description:"Path relative to the repository root"`
+	Line      int    `json:"line" jsonschema:"minimum=0" jsonschema_description:"0-based line"`
+	Character int    `json:"character" jsonschema:"minimum=0" jsonschema_description:"0-based character offset in the line"`
 }
 
 type GoToDefinitionOutput struct {
 	Location *lsp.Location `json:"location"`
-	Error    *lsp.Error    `json:"error"`
 }
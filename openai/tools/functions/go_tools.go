@@ -0,0 +1,48 @@
+package functions
+
+// GoPackageInput selects the package go_build and go_vet run on
+type GoPackageInput struct {
+	Package string `json:"package" jsonschema_description:"Package directory relative to the repository root, like ./pkg or ./... for every package"`
+}
+
+type GoTestInput struct {
+	Package string `json:"package" jsonschema_description:"Package directory relative to the repository root, like ./pkg or ./... for every package"`
+	Run     string `json:"run" jsonschema_description:"Regular expression selecting the tests to run (go test -run), empty runs every test"`
+}
+
+type GoDocInput struct {
+	Symbol string `json:"symbol" jsonschema_description:"Package, symbol or method to document, like ./pkg, pkg.Type or pkg.Type.Method"`
+}
+
+// GoCommandOutput is the result of a go command, with the problems it reported parsed out of the output
+type GoCommandOutput struct {
+	Command  string `json:"command"`
+	Success  bool   `json:"success"`
+	ExitCode int    `json:"exit_code"`
+	TimedOut bool   `json:"timed_out,omitempty"`
+
+	// Problems are build errors and vet findings
+	Problems []GoProblem `json:"problems,omitempty"`
+
+	FailedTests []FailedTest `json:"failed_tests,omitempty"`
+	PassedTests int          `json:"passed_tests,omitempty"`
+
+	// Output is whatever wasn't parsed into problems or tests, or the documentation of go_doc
+	Output    string `json:"output,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+type GoProblem struct {
+	Path string `json:"path"`
+
+	// Line and Column are 1-based, Column is 0 when the tool didn't report one
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+type FailedTest struct {
+	Package string `json:"package"`
+	Test    string `json:"test"`
+	Output  string `json:"output"`
+}
@@ -0,0 +1,22 @@
+package functions
+
+type GrepInput struct {
+	// Pattern is a Go regular expression
+	Pattern string `json:"pattern" jsonschema_description:"Go regular expression"`
+
+	// Path narrows the search to a directory relative to the repository root, empty searches everything
+	Path string `json:"path" jsonschema_description:"Directory relative to the repository root, empty for the whole repository"`
+}
+
+type GrepOutput struct {
+	Matches   []GrepMatch `json:"matches"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+type GrepMatch struct {
+	Path string `json:"path"`
+
+	// Line is 1-based
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
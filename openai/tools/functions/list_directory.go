@@ -0,0 +1,18 @@
+package functions
+
+type ListDirectoryInput struct {
+	// Path relative to the repository root, empty for the root itself
+	Path string `json:"path" jsonschema_description:"Directory relative to the repository root, empty for the root"`
+}
+
+type ListDirectoryOutput struct {
+	Path      string           `json:"path"`
+	Entries   []DirectoryEntry `json:"entries"`
+	Truncated bool             `json:"truncated,omitempty"`
+}
+
+type DirectoryEntry struct {
+	Name  string `json:"name"`
+	IsDir bool   `json:"is_dir"`
+	Size  int64  `json:"size,omitempty"`
+}
@@ -0,0 +1,18 @@
+package functions
+
+type LookupSymbolInput struct {
+	Symbol string `json:"symbol" jsonschema_description:"Function, method or type, optionally qualified by package and receiver: \"Name\", \"Type.Method\" or \"pkg.Type.Method\""`
+}
+
+type LookupSymbolOutput struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Package string `json:"package"`
+	Path    string `json:"path"`
+
+	// StartLine and EndLine are 1-based
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Doc       string `json:"doc,omitempty"`
+	Content   string `json:"content"`
+}
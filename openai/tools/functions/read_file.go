@@ -0,0 +1,21 @@
+package functions
+
+type ReadFileInput struct {
+	// Path relative to the repository root
+	Path string `json:"path" jsonschema_description:"Path relative to the repository root"`
+
+	// StartLine and EndLine are 1-based and inclusive, 0 reads from the start or to the end of the file
+	StartLine int `json:"start_line" jsonschema:"minimum=0" jsonschema_description:"1-based first line, 0 for the start of the file"`
+	EndLine   int `json:"end_line" jsonschema:"minimum=0" jsonschema_description:"1-based last line (inclusive), 0 for the end of the file"`
+}
+
+type ReadFileOutput struct {
+	Path       string `json:"path"`
+	StartLine  int    `json:"start_line"`
+	EndLine    int    `json:"end_line"`
+	TotalLines int    `json:"total_lines"`
+
+	// Content is prefixed with 1-based line numbers
+	Content   string `json:"content"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
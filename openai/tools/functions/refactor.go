@@ -0,0 +1,43 @@
+package functions
+
+type RenameSymbolInput struct {
+	URI       string `json:"uri" jsonschema_description:"Path relative to the repository root"`
+	Line      int    `json:"line" jsonschema:"minimum=0" jsonschema_description:"0-based line"`
+	Character int    `json:"character" jsonschema:"minimum=0" jsonschema_description:"0-based character offset of the identifier in the line"`
+	NewName   string `json:"new_name" jsonschema_description:"New name of the identifier"`
+}
+
+type CodeActionsInput struct {
+	URI       string `json:"uri" jsonschema_description:"Path relative to the repository root"`
+	StartLine int    `json:"start_line" jsonschema:"minimum=0" jsonschema_description:"0-based first line of the range"`
+	EndLine   int    `json:"end_line" jsonschema:"minimum=0" jsonschema_description:"0-based last line of the range, inclusive"`
+}
+
+type CodeActionsOutput struct {
+	Actions []CodeActionInfo `json:"actions"`
+}
+
+type CodeActionInfo struct {
+	Title       string `json:"title"`
+	Kind        string `json:"kind,omitempty"`
+	IsPreferred bool   `json:"is_preferred,omitempty"`
+
+	// Fixes are the diagnostics the action resolves
+	Fixes []string `json:"fixes,omitempty"`
+}
+
+type ApplyCodeActionInput struct {
+	URI       string `json:"uri" jsonschema_description:"Path relative to the repository root"`
+	StartLine int    `json:"start_line" jsonschema:"minimum=0" jsonschema_description:"0-based first line of the range, as passed to code_actions"`
+	EndLine   int    `json:"end_line" jsonschema:"minimum=0" jsonschema_description:"0-based last line of the range, inclusive"`
+	Title     string `json:"title" jsonschema_description:"Exact title of one of the actions code_actions returned for this range"`
+}
+
+// ChangesOutput is the outcome of a refactoring, the patch is shown to the user before anything is applied
+type ChangesOutput struct {
+	Summary string   `json:"summary"`
+	Files   []string `json:"files"`
+	Patch   string   `json:"patch"`
+	Applied bool     `json:"applied"`
+	Message string   `json:"message,omitempty"`
+}
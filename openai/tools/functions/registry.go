@@ -0,0 +1,197 @@
+package functions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"strings"
+)
+
+// Tool is a function the model can call. It ties the input type, the schema generated from it and the handler together.
+type Tool struct {
+	Name        string
+	Description string
+
+	// Examples are valid arguments, they're shown to the model and checked against the schema
+	Examples []json.RawMessage
+
+	schema map[string]any
+	call   func(ctx context.Context, arguments []byte) (any, error)
+}
+
+// NewTool creates a tool with a schema generated from In. Inputs must have snake_case json tags without omitempty,
+// strict mode requires every property to be present.
+func NewTool[In, Out any](name, description string, handler func(ctx context.Context, in In) (Out, error), examples ...In) Tool {
+	t := Tool{
+		Name:        name,
+		Description: description,
+		schema:      mustGenSchema(new(In)),
+		call: func(ctx context.Context, arguments []byte) (any, error) {
+			var in In
+			dec := json.NewDecoder(bytes.NewReader(arguments))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&in); err != nil {
+				return nil, err
+			}
+			return handler(ctx, in)
+		},
+	}
+
+	for _, example := range examples {
+		b, err := json.Marshal(example)
+		if err != nil {
+			panic(fmt.Sprintf("tool %s: invalid example: %v", name, err))
+		}
+		t.Examples = append(t.Examples, b)
+	}
+
+	return t
+}
+
+// Schema returns the JSON schema of the tool's arguments
+func (t Tool) Schema() map[string]any {
+	return t.schema
+}
+
+// Definition returns the OpenAI function definition, examples are appended to the description
+func (t Tool) Definition() openai.FunctionDefinition {
+	description := t.Description
+	for _, example := range t.Examples {
+		description += "\nExample: " + string(example)
+	}
+
+	return openai.FunctionDefinition{
+		Name:        t.Name,
+		Description: description,
+		Strict:      true,
+		Parameters:  t.schema,
+	}
+}
+
+// Registry dispatches tool calls by name, arguments are validated against the tool's schema before its handler runs
+type Registry struct {
+	tools []Tool
+	index map[string]int
+}
+
+// MustNewRegistry creates a registry of tools. Invalid tools are programming errors, so it panics on
+// duplicate names, schemas strict mode would reject and examples that don't match their schema.
+func MustNewRegistry(tools ...Tool) *Registry {
+	r := &Registry{index: make(map[string]int, len(tools))}
+	for _, t := range tools {
+		if _, ok := r.index[t.Name]; ok {
+			panic(fmt.Sprintf("tool %s registered twice", t.Name))
+		}
+		if err := checkStrict(t.schema, ""); err != nil {
+			panic(fmt.Sprintf("tool %s: schema is not valid in strict mode: %v", t.Name, err))
+		}
+		for _, example := range t.Examples {
+			if errs := validateArguments(t.schema, example); len(errs) > 0 {
+				panic(fmt.Sprintf("tool %s: example %s doesn't match its schema: %s: %s", t.Name, example, errs[0].Field, errs[0].Message))
+			}
+		}
+
+		r.index[t.Name] = len(r.tools)
+		r.tools = append(r.tools, t)
+	}
+	return r
+}
+
+// Tools returns the registered tools in registration order
+func (r *Registry) Tools() []Tool {
+	return r.tools
+}
+
+func (r *Registry) Definitions() []openai.FunctionDefinition {
+	defs := make([]openai.FunctionDefinition, 0, len(r.tools))
+	for _, t := range r.tools {
+		defs = append(defs, t.Definition())
+	}
+	return defs
+}
+
+// Call runs a tool and returns its JSON encoded output.
+// Failures are returned as a CallError for the model to correct, rather than as a Go error.
+func (r *Registry) Call(ctx context.Context, name, arguments string) string {
+	output, _ := r.Invoke(ctx, name, arguments)
+	return output
+}
+
+// Invoke is Call for callers that tell failed calls apart from results, like MCP clients. The output of a failed
+// call is its CallError.
+func (r *Registry) Invoke(ctx context.Context, name, arguments string) (output string, failed bool) {
+	i, ok := r.index[name]
+	if !ok {
+		return marshalCallError(&CallError{
+			Code:    CallErrorUnknownTool,
+			Message: fmt.Sprintf("unknown tool %q, available tools: %s", name, strings.Join(r.names(), ", ")),
+		}), true
+	}
+	t := r.tools[i]
+
+	args := []byte(arguments)
+	if len(bytes.TrimSpace(args)) == 0 {
+		args = []byte("{}")
+	}
+
+	if errs := validateArguments(t.schema, args); len(errs) > 0 {
+		return marshalCallError(&CallError{
+			Code:    CallErrorInvalidArguments,
+			Message: fmt.Sprintf("arguments don't match the schema of %s", name),
+			Fields:  errs,
+		}), true
+	}
+
+	result, err := t.call(ctx, args)
+	if err != nil {
+		return marshalCallError(&CallError{Code: CallErrorFailed, Message: err.Error()}), true
+	}
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		return marshalCallError(&CallError{Code: CallErrorFailed, Message: fmt.Sprintf("failed to encode output: %v", err)}), true
+	}
+	return string(b), false
+}
+
+func (r *Registry) names() []string {
+	names := make([]string, 0, len(r.tools))
+	for _, t := range r.tools {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+type CallErrorCode string
+
+const (
+	CallErrorUnknownTool      CallErrorCode = "unknown_tool"
+	CallErrorInvalidArguments CallErrorCode = "invalid_arguments"
+	CallErrorFailed           CallErrorCode = "failed"
+)
+
+// CallError is the output of a failed tool call
+type CallError struct {
+	Code    CallErrorCode `json:"code"`
+	Message string        `json:"message"`
+
+	// Fields lists the arguments that failed validation
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+func (e *CallError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// FieldError is a single argument that doesn't match the schema, Field is a JSON pointer like path
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func marshalCallError(err *CallError) string {
+	b, _ := json.Marshal(map[string]*CallError{"error": err})
+	return string(b)
+}
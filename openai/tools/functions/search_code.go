@@ -0,0 +1,28 @@
+package functions
+
+type SearchCodeInput struct {
+	Query string `json:"query" jsonschema_description:"Natural language description of the code you are looking for"`
+
+	// Package filters by import path, empty searches every package
+	Package string   `json:"package" jsonschema_description:"Import path or trailing part of one (e.g. \"pkg\" or \"module/pkg\"), empty for every package"`
+	Kinds   []string `json:"kinds" jsonschema:"enum=func,enum=method,enum=struct,enum=interface,enum=type_alias,enum=const,enum=var,enum=test" jsonschema_description:"Kinds of declarations to return, empty for every kind"`
+	Limit   int      `json:"limit" jsonschema:"minimum=0,maximum=50" jsonschema_description:"Maximum amount of results, 0 for the default of 10"`
+}
+
+type SearchCodeOutput struct {
+	Results []SearchResult `json:"results"`
+}
+
+type SearchResult struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Package string `json:"package"`
+	Path    string `json:"path"`
+
+	// StartLine and EndLine are 1-based
+	StartLine int `json:"start_line"`
+	EndLine   int `json:"end_line"`
+
+	// Similarity is 1 - cosine distance, higher is more relevant
+	Similarity float64 `json:"similarity"`
+}
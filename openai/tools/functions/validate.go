@@ -0,0 +1,194 @@
+package functions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// validateArguments checks arguments against the subset of JSON schema the reflector generates for tool inputs:
+// types, required and additional properties, enums and numeric bounds
+func validateArguments(schema map[string]any, arguments []byte) []FieldError {
+	dec := json.NewDecoder(bytes.NewReader(arguments))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return []FieldError{{Field: "/", Message: fmt.Sprintf("arguments are not valid JSON: %v", err)}}
+	}
+
+	var errs []FieldError
+	validateValue(schema, v, "", &errs)
+	return errs
+}
+
+func validateValue(schema map[string]any, v any, field string, errs *[]FieldError) {
+	fail := func(format string, args ...any) {
+		f := field
+		if f == "" {
+			f = "/"
+		}
+		*errs = append(*errs, FieldError{Field: f, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !matchesType(schema["type"], v) {
+		fail("expected %s, got %s", typeNames(schema["type"]), jsonType(v))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !slices.ContainsFunc(enum, func(e any) bool { return equalJSON(e, v) }) {
+		fail("must be one of %v", enum)
+	}
+
+	switch v := v.(type) {
+	case json.Number:
+		n, _ := v.Float64()
+		if minimum, ok := schema["minimum"].(float64); ok && n < minimum {
+			fail("must be >= %v", minimum)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && n > maximum {
+			fail("must be <= %v", maximum)
+		}
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		for _, name := range stringSlice(schema["required"]) {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, FieldError{Field: field + "/" + name, Message: "required"})
+			}
+		}
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			prop, ok := properties[name].(map[string]any)
+			if !ok {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					*errs = append(*errs, FieldError{Field: field + "/" + name, Message: "unknown property"})
+				}
+				continue
+			}
+			validateValue(prop, v[name], field+"/"+name, errs)
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				validateValue(items, item, fmt.Sprintf("%s/%d", field, i), errs)
+			}
+		}
+	}
+}
+
+// checkStrict reports the first schema violation of OpenAI's strict mode: objects must forbid additional properties
+// and list every property as required
+func checkStrict(schema map[string]any, field string) error {
+	if properties, ok := schema["properties"].(map[string]any); ok {
+		if additional, ok := schema["additionalProperties"].(bool); !ok || additional {
+			return fmt.Errorf("%s: additionalProperties must be false", fieldName(field))
+		}
+
+		required := stringSlice(schema["required"])
+		for name, prop := range properties {
+			if !slices.Contains(required, name) {
+				return fmt.Errorf("%s/%s: property must be required, remove omitempty", field, name)
+			}
+			if prop, ok := prop.(map[string]any); ok {
+				if err := checkStrict(prop, field+"/"+name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if items, ok := schema["items"].(map[string]any); ok {
+		return checkStrict(items, field+"/items")
+	}
+	return nil
+}
+
+func matchesType(schemaType any, v any) bool {
+	switch t := schemaType.(type) {
+	case nil:
+		return true
+	case string:
+		return matchesTypeName(t, v)
+	case []any:
+		return slices.ContainsFunc(t, func(name any) bool {
+			s, _ := name.(string)
+			return matchesTypeName(s, v)
+		})
+	}
+	return false
+}
+
+func matchesTypeName(name string, v any) bool {
+	switch name {
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	default:
+		return jsonType(v) == name
+	}
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func typeNames(schemaType any) string {
+	if _, ok := schemaType.([]any); ok {
+		return strings.Join(stringSlice(schemaType), " or ")
+	}
+	return fmt.Sprint(schemaType)
+}
+
+func equalJSON(a, b any) bool {
+	ab, _ := json.Marshal(a)
+	bb, _ := json.Marshal(b)
+	return bytes.Equal(ab, bb)
+}
+
+func stringSlice(v any) []string {
+	items, _ := v.([]any)
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func fieldName(field string) string {
+	if field == "" {
+		return "/"
+	}
+	return field
+}
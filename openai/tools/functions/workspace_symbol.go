@@ -0,0 +1,21 @@
+package functions
+
+import "github.com/sajuno/goon/language/lsp"
+
+type WorkspaceSymbolInput struct {
+	Query string `json:"query"`
+}
+
+// SymbolInformation is a symbol with its location and its kind by name
+type SymbolInformation struct {
+	lsp.SymbolInformation
+	Kind string `json:"kind"`
+}
+
+func NewSymbolInformation(sym lsp.SymbolInformation) SymbolInformation {
+	return SymbolInformation{SymbolInformation: sym, Kind: sym.Kind.String()}
+}
+
+type WorkspaceSymbolOutput struct {
+	Symbols []SymbolInformation `json:"symbols"`
+}
@@ -1,6 +1,9 @@
 package rag
 
 import (
+	"fmt"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pgvector/pgvector-go"
 	"github.com/sajuno/goon/language/golang"
 	"github.com/sajuno/goon/rag/sqlc/pg"
 )
@@ -23,27 +26,52 @@ func unmarshalChunk(chunk pg.CodeChunk) Chunk {
 	}
 }
 
-func unmarshalSimilarChunks(chunks []pg.FindSimilarChunksRow) []SimilarChunk {
+func marshalChunks(snapshotID pgtype.UUID, chunks []Chunk) []pg.CreateChunksParams {
+	params := make([]pg.CreateChunksParams, 0, len(chunks))
+	for _, chunk := range chunks {
+		params = append(params, pg.CreateChunksParams{
+			SymbolName: chunk.Name,
+			SymbolType: chunk.Kind.String(),
+			Package:    chunk.Package,
+			FilePath:   chunk.FilePath,
+			StartLine:  int32(chunk.StartLine),
+			EndLine:    int32(chunk.EndLine),
+			Content:    chunk.Content,
+			Doc:        pgtype.Text{String: chunk.Doc, Valid: chunk.Doc != ""},
+			Embedding:  pgvector.NewVector(chunk.Vector),
+			TokenCount: int32(chunk.Tokens),
+			Sha256:     chunk.Sha256(),
+			SnapshotID: snapshotID,
+		})
+	}
+	return params
+}
+
+func unmarshalSimilarChunks(chunks []similarChunkRow) []SimilarChunk {
 	out := make([]SimilarChunk, 0, len(chunks))
 	for _, chunk := range chunks {
 		out = append(out, SimilarChunk{
-			Chunk: Chunk{
-				Chunk: golang.Chunk{
-					ID:        chunk.ID.String(),
-					Content:   chunk.Content,
-					Package:   chunk.Package,
-					FilePath:  chunk.FilePath,
-					Kind:      golang.ChunkKind(chunk.SymbolType),
-					Name:      chunk.SymbolName,
-					StartLine: int(chunk.StartLine),
-					EndLine:   int(chunk.EndLine),
-					Doc:       chunk.Doc.String,
-				},
-				Vector: chunk.Embedding.Slice(),
-				Tokens: int(chunk.TokenCount),
-			},
-			Distance: chunk.Distance.(float64),
+			Chunk:    unmarshalChunk(chunk.CodeChunk),
+			Distance: chunk.Distance,
 		})
 	}
 	return out
 }
+
+func unmarshalSnapshot(snapshot pg.IndexSnapshot) Snapshot {
+	return Snapshot{
+		ID:             snapshot.ID.String(),
+		Root:           snapshot.Root,
+		EmbeddingModel: snapshot.EmbeddingModel,
+		Dimensions:     int(snapshot.Dimensions),
+		CreatedAt:      snapshot.CreatedAt.Time,
+	}
+}
+
+func marshalUUID(id string) (pgtype.UUID, error) {
+	var out pgtype.UUID
+	if err := out.Scan(id); err != nil {
+		return out, fmt.Errorf("invalid uuid %q: %w", id, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,274 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type IndexMethod string
+
+const (
+	IndexMethodHNSW    IndexMethod = "hnsw"
+	IndexMethodIVFFlat IndexMethod = "ivfflat"
+)
+
+// ivfflatMinRows is the row count below which an ivfflat index isn't built.
+// ivfflat clusters are trained on existing rows, on small tables recall is terrible and a sequential scan is fast anyway
+const ivfflatMinRows = 10_000
+
+// IndexConfig controls how the vector index is built and queried
+type IndexConfig struct {
+	Method IndexMethod
+
+	// HNSW build parameters, see https://github.com/pgvector/pgvector#hnsw
+	M              int
+	EfConstruction int
+
+	// Lists for ivfflat, sized from the row count when 0
+	Lists int
+
+	// EfSearch is hnsw.ef_search, the size of the candidate list of each step of an hnsw scan
+	EfSearch int
+
+	// Probes is ivfflat.probes
+	Probes int
+}
+
+func DefaultIndexConfig() IndexConfig {
+	return IndexConfig{
+		Method:         IndexMethodHNSW,
+		M:              16,
+		EfConstruction: 64,
+		EfSearch:       100,
+		Probes:         10,
+	}
+}
+
+// indexName is per dimension since the embedding column itself has no fixed dimensions
+func indexName(dimensions int) string {
+	return fmt.Sprintf("code_chunks_embedding_%d_idx", dimensions)
+}
+
+// indexOptions returns the reloptions the index should be built with for the given row count
+func (c IndexConfig) indexOptions(rows int) []string {
+	switch c.Method {
+	case IndexMethodIVFFlat:
+		lists := c.Lists
+		if lists <= 0 {
+			lists = ivfflatLists(rows)
+		}
+		return []string{fmt.Sprintf("lists=%d", lists)}
+	default:
+		return []string{
+			fmt.Sprintf("m=%d", c.M),
+			fmt.Sprintf("ef_construction=%d", c.EfConstruction),
+		}
+	}
+}
+
+// ivfflatLists follows pgvector's recommendation of rows/1000 up to 1M rows and sqrt(rows) after
+func ivfflatLists(rows int) int {
+	if rows > 1_000_000 {
+		return int(math.Sqrt(float64(rows)))
+	}
+	return max(rows/1000, 1)
+}
+
+type existingIndex struct {
+	method  IndexMethod
+	options []string
+}
+
+// ensureIndex builds the vector index for the given dimensions if it's missing or outdated.
+// Indexes are built concurrently so searches and inserts aren't blocked while it runs.
+func (s *PGStore) ensureIndex(ctx context.Context, dimensions int) error {
+	// index of earlier goon versions, which assumed a fixed dimension column
+	if _, err := s.pool.Exec(ctx, "DROP INDEX CONCURRENTLY IF EXISTS code_chunks_embedding_idx"); err != nil {
+		return fmt.Errorf("failed to drop legacy embedding index: %w", err)
+	}
+
+	var rows int
+	err := s.pool.QueryRow(ctx, "SELECT count(*) FROM code_chunks WHERE vector_dims(embedding) = $1", dimensions).Scan(&rows)
+	if err != nil {
+		return fmt.Errorf("failed to count chunks: %w", err)
+	}
+
+	name := indexName(dimensions)
+	current, err := s.existingIndex(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if s.indexCfg.Method == IndexMethodIVFFlat && rows < ivfflatMinRows {
+		if current != nil {
+			return s.dropIndex(ctx, name)
+		}
+		return nil
+	}
+
+	options := s.indexCfg.indexOptions(rows)
+	if current != nil && !s.needsRebuild(*current, options) {
+		return nil
+	}
+
+	// build under a temporary name so the old index keeps serving queries until the new one is ready
+	tmpName := name + "_new"
+	if err := s.dropIndex(ctx, tmpName); err != nil {
+		return err
+	}
+
+	// cosine ops, matching the <=> operator used by FindSimilarChunks
+	q := fmt.Sprintf(`
+CREATE INDEX CONCURRENTLY %[1]s
+ON code_chunks
+USING %[2]s ((embedding::vector(%[3]d)) vector_cosine_ops)
+WITH (%[4]s)
+WHERE vector_dims(embedding) = %[3]d`,
+		tmpName, s.indexCfg.Method, dimensions, strings.Join(options, ", "))
+
+	if _, err := s.pool.Exec(ctx, q); err != nil {
+		return fmt.Errorf("failed to build %s embedding index: %w", s.indexCfg.Method, err)
+	}
+
+	if current != nil {
+		if err := s.dropIndex(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.pool.Exec(ctx, fmt.Sprintf("ALTER INDEX %s RENAME TO %s", tmpName, name)); err != nil {
+		return fmt.Errorf("failed to rename embedding index: %w", err)
+	}
+
+	return nil
+}
+
+// needsRebuild compares an existing index to the desired options.
+// ivfflat lists are allowed to drift within a factor of two, so small changes in row count don't trigger rebuilds
+func (s *PGStore) needsRebuild(current existingIndex, options []string) bool {
+	if current.method != s.indexCfg.Method {
+		return true
+	}
+
+	if s.indexCfg.Method == IndexMethodIVFFlat && s.indexCfg.Lists <= 0 {
+		have, want := listsOption(current.options), listsOption(options)
+		return have == 0 || want > have*2 || want < have/2
+	}
+
+	slices.Sort(options)
+	slices.Sort(current.options)
+	return !slices.Equal(options, current.options)
+}
+
+func listsOption(options []string) int {
+	for _, opt := range options {
+		if v, ok := strings.CutPrefix(opt, "lists="); ok {
+			n, _ := strconv.Atoi(v)
+			return n
+		}
+	}
+	return 0
+}
+
+func (s *PGStore) existingIndex(ctx context.Context, name string) (*existingIndex, error) {
+	q := `
+SELECT am.amname, coalesce(c.reloptions, '{}')
+FROM pg_class c
+JOIN pg_am am ON am.oid = c.relam
+WHERE c.oid = to_regclass($1)`
+
+	var (
+		method  string
+		options []string
+	)
+	err := s.pool.QueryRow(ctx, q, name).Scan(&method, &options)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up index %s: %w", name, err)
+	}
+
+	return &existingIndex{method: IndexMethod(method), options: options}, nil
+}
+
+func (s *PGStore) dropIndex(ctx context.Context, name string) error {
+	if _, err := s.pool.Exec(ctx, fmt.Sprintf("DROP INDEX CONCURRENTLY IF EXISTS %s", name)); err != nil {
+		return fmt.Errorf("failed to drop index %s: %w", name, err)
+	}
+	return nil
+}
+
+// setSearchParams applies query-time index settings, they're scoped to the transaction.
+// Filters are applied to the candidates of the index scan, which are capped by ef_search or probes. Iterative scans
+// keep scanning until enough candidates pass the filters, on pgvector versions without them filtered searches skip
+// the index instead of returning less than the limit.
+func (s *PGStore) setSearchParams(ctx context.Context, tx pgx.Tx, filtered bool) error {
+	var params [][2]string
+	switch s.indexCfg.Method {
+	case IndexMethodIVFFlat:
+		if s.indexCfg.Probes > 0 {
+			params = append(params, [2]string{"ivfflat.probes", strconv.Itoa(s.indexCfg.Probes)})
+		}
+	default:
+		if s.indexCfg.EfSearch > 0 {
+			params = append(params, [2]string{"hnsw.ef_search", strconv.Itoa(s.indexCfg.EfSearch)})
+		}
+	}
+
+	var version string
+	err := tx.QueryRow(ctx, "SELECT extversion FROM pg_extension WHERE extname = 'vector'").Scan(&version)
+	if err != nil {
+		return fmt.Errorf("failed to look up pgvector version: %w", err)
+	}
+
+	switch {
+	case iterativeScanSupported(version) && s.indexCfg.Method == IndexMethodIVFFlat:
+		// ivfflat only supports relaxed ordering, FindSimilarChunks sorts the results again
+		params = append(params, [2]string{"ivfflat.iterative_scan", "relaxed_order"})
+	case iterativeScanSupported(version):
+		params = append(params, [2]string{"hnsw.iterative_scan", "strict_order"})
+	default:
+		if !filtered {
+			// chunks of other repositories are filtered out too
+			var snapshots int
+			if err := tx.QueryRow(ctx, "SELECT count(*) FROM index_snapshots").Scan(&snapshots); err != nil {
+				return fmt.Errorf("failed to count snapshots: %w", err)
+			}
+			filtered = snapshots > 1
+		}
+		if filtered {
+			params = append(params, [2]string{"enable_indexscan", "off"})
+		}
+	}
+
+	for _, p := range params {
+		if _, err := tx.Exec(ctx, "SELECT set_config($1, $2, true)", p[0], p[1]); err != nil {
+			return fmt.Errorf("failed to set %s: %w", p[0], err)
+		}
+	}
+	return nil
+}
+
+// iterativeScanSupported reports whether a pgvector version has iterative index scans, added in 0.8.0
+func iterativeScanSupported(version string) bool {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	return major > 0 || minor >= 8
+}
@@ -1,75 +1,232 @@
 package rag
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
-	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pgvector/pgvector-go"
 	"github.com/sajuno/goon/rag/sqlc/pg"
+	"slices"
 )
 
 type PGStore struct {
-	pool    *pgxpool.Pool
-	queries *pg.Queries
+	pool     *pgxpool.Pool
+	queries  *pg.Queries
+	indexCfg IndexConfig
 }
 
-func NewPGStore(pool *pgxpool.Pool) *PGStore {
+func NewPGStore(pool *pgxpool.Pool, indexCfg IndexConfig) *PGStore {
 	return &PGStore{
-		pool:    pool,
-		queries: pg.New(pool),
+		pool:     pool,
+		queries:  pg.New(pool),
+		indexCfg: indexCfg,
 	}
 }
 
-func (s *PGStore) SaveChunks(ctx context.Context, chunks []Chunk) error {
-	var params []pg.CreateChunksParams
-	for _, chunk := range chunks {
-		params = append(params, pg.CreateChunksParams{
-			SymbolName: chunk.Name,
-			SymbolType: chunk.Kind.String(),
-			Package:    chunk.Package,
-			FilePath:   chunk.FilePath,
-			EndLine:    int32(chunk.EndLine),
-			Content:    chunk.Content,
-			Doc:        pgtype.Text{String: chunk.Doc},
-			Embedding:  pgvector.NewVector(chunk.Vector),
-			TokenCount: int32(chunk.Tokens),
-			Sha256:     chunk.Sha256(),
-		})
-	}
-
-	_, err := s.queries.CreateChunks(ctx, params)
+func (s *PGStore) SaveChunks(ctx context.Context, snapshot Snapshot, chunks []Chunk) (Snapshot, error) {
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		return err
+		return Snapshot{}, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	q := `
-DROP INDEX IF EXISTS code_chunks_embedding_idx;
-CREATE INDEX code_chunks_embedding_idx 
-ON code_chunks 
-USING ivfflat (embedding vector_cosine_ops) 
-WITH (lists = 100);`
+	queries := s.queries.WithTx(tx)
 
-	_, err = s.pool.Exec(ctx, q)
+	row, err := queries.CreateSnapshot(ctx, pg.CreateSnapshotParams{
+		Root:           snapshot.Root,
+		EmbeddingModel: snapshot.EmbeddingModel,
+		Dimensions:     int32(snapshot.Dimensions),
+	})
 	if err != nil {
-		return fmt.Errorf("failed to recreate embedding index: %w", err)
+		return Snapshot{}, fmt.Errorf("failed to create snapshot: %w", err)
 	}
 
-	return nil
-}
+	_, err = queries.CreateChunks(ctx, marshalChunks(row.ID, chunks))
+	if err != nil {
+		return Snapshot{}, err
+	}
 
-func (s *PGStore) FindSimilarChunks(ctx context.Context, vector []float32) ([]SimilarChunk, error) {
-	res, err := s.queries.FindSimilarChunks(ctx, pg.FindSimilarChunksParams{
-		Embedding: pgvector.NewVector(vector),
-		Limit:     50,
+	// chunks of earlier runs are removed through the cascading foreign key
+	err = queries.DeleteSupersededSnapshots(ctx, pg.DeleteSupersededSnapshotsParams{
+		Root: row.Root,
+		ID:   row.ID,
 	})
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to delete superseded snapshots: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to commit snapshot: %w", err)
+	}
+
+	if row.Dimensions > 0 {
+		if err := s.ensureIndex(ctx, int(row.Dimensions)); err != nil {
+			return Snapshot{}, err
+		}
+	}
+
+	return unmarshalSnapshot(row), nil
+}
+
+func (s *PGStore) LatestSnapshot(ctx context.Context, root string) (Snapshot, error) {
+	return s.snapshot(s.queries.LatestSnapshot(ctx, root))
+}
+
+func (s *PGStore) snapshot(row pg.IndexSnapshot, err error) (Snapshot, error) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Snapshot{}, ErrNoSnapshot
+	}
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("query failed: %w", err)
+	}
+
+	return unmarshalSnapshot(row), nil
+}
+
+// findSimilarChunks is written by hand rather than generated, the casts have to match the per-dimension
+// expression index for postgres to use it and type modifiers can't be query parameters.
+// Filters are applied to the index scan's candidates, see setSearchParams for how it keeps scanning until the limit is met.
+const findSimilarChunks = `
+SELECT id, symbol_name, symbol_type, package, file_path, start_line, end_line, content, doc, embedding, token_count, sha256, created_at, snapshot_id,
+       embedding::vector(%[1]d) <=> $1::vector(%[1]d) AS distance
+FROM code_chunks
+WHERE snapshot_id = $2 AND vector_dims(embedding) = %[1]d
+  AND ($4 = '' OR package = $4 OR right(package, length($4) + 1) = '/' || $4 OR starts_with(package, $4 || '/'))
+  AND (cardinality($5::text[]) = 0 OR symbol_type = ANY($5::text[]))
+ORDER BY embedding::vector(%[1]d) <=> $1::vector(%[1]d)
+LIMIT $3`
+
+type similarChunkRow struct {
+	pg.CodeChunk
+	Distance float64
+}
+
+// FindSimilarChunks returns the chunks closest to vector by cosine distance
+func (s *PGStore) FindSimilarChunks(ctx context.Context, snapshotID string, vector []float32, opts SearchOptions) ([]SimilarChunk, error) {
+	id, err := marshalUUID(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	kinds := make([]string, 0, len(opts.Kinds))
+	for _, kind := range opts.Kinds {
+		kinds = append(kinds, kind.String())
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.setSearchParams(ctx, tx, opts.Package != "" || len(kinds) > 0); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, fmt.Sprintf(findSimilarChunks, len(vector)), pgvector.NewVector(vector), id, limit, opts.Package, kinds)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
+	defer rows.Close()
+
+	var res []similarChunkRow
+	for rows.Next() {
+		var r similarChunkRow
+		if err := rows.Scan(
+			&r.ID,
+			&r.SymbolName,
+			&r.SymbolType,
+			&r.Package,
+			&r.FilePath,
+			&r.StartLine,
+			&r.EndLine,
+			&r.Content,
+			&r.Doc,
+			&r.Embedding,
+			&r.TokenCount,
+			&r.Sha256,
+			&r.CreatedAt,
+			&r.SnapshotID,
+			&r.Distance,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		res = append(res, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
 
 	if len(res) == 0 {
 		return nil, nil
 	}
 
+	// iterative ivfflat scans return candidates in a relaxed order
+	slices.SortStableFunc(res, func(a, b similarChunkRow) int {
+		return cmp.Compare(a.Distance, b.Distance)
+	})
+
 	return unmarshalSimilarChunks(res), nil
 }
+
+func (s *PGStore) FindChunks(ctx context.Context, snapshotID string, q ChunkQuery) ([]Chunk, error) {
+	id, err := marshalUUID(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.queries.FindChunks(ctx, pg.FindChunksParams{
+		SnapshotID: id,
+		FilePath:   q.FilePath,
+		Package:    q.Package,
+		SymbolName: q.Name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	chunks := make([]Chunk, 0, len(rows))
+	for _, row := range rows {
+		chunks = append(chunks, unmarshalChunk(row))
+	}
+	return chunks, nil
+}
+
+func (s *PGStore) ReplaceFileChunks(ctx context.Context, snapshotID, filePath string, chunks []Chunk) error {
+	id, err := marshalUUID(snapshotID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	queries := s.queries.WithTx(tx)
+
+	err = queries.DeleteFileChunks(ctx, pg.DeleteFileChunksParams{SnapshotID: id, FilePath: filePath})
+	if err != nil {
+		return fmt.Errorf("failed to delete chunks of %s: %w", filePath, err)
+	}
+
+	if len(chunks) > 0 {
+		if _, err := queries.CreateChunks(ctx, marshalChunks(id, chunks)); err != nil {
+			return fmt.Errorf("failed to create chunks of %s: %w", filePath, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit chunks of %s: %w", filePath, err)
+	}
+	return nil
+}
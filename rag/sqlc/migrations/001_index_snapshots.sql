@@ -0,0 +1,26 @@
+-- Upgrades a database created before index snapshots existed, schema.sql covers new databases.
+-- Chunks indexed before can't be attributed to an embedding model or repository, they're dropped
+-- and every repository has to be indexed again with 'goon index'.
+SET SEARCH_PATH = 'rag', 'public';
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS index_snapshots (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    root TEXT NOT NULL,              -- the indexed repository path
+    embedding_model TEXT NOT NULL,
+    dimensions INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- the legacy index needs fixed dimensions, postgres would fail rebuilding it for the altered column.
+-- goon builds an index per dimension after indexing.
+DROP INDEX IF EXISTS code_chunks_embedding_idx;
+ALTER TABLE code_chunks ALTER COLUMN embedding TYPE vector;
+ALTER TABLE code_chunks ADD COLUMN IF NOT EXISTS snapshot_id UUID REFERENCES index_snapshots (id) ON DELETE CASCADE;
+DELETE FROM code_chunks WHERE snapshot_id IS NULL;
+ALTER TABLE code_chunks ALTER COLUMN snapshot_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS code_chunks_snapshot_id_idx ON code_chunks (snapshot_id);
+
+COMMIT;
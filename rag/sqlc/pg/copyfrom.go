@@ -40,6 +40,7 @@ func (r iteratorForCreateChunks) Values() ([]interface{}, error) {
 		r.rows[0].Sha256,
 		r.rows[0].Package,
 		r.rows[0].FilePath,
+		r.rows[0].SnapshotID,
 	}, nil
 }
 
@@ -48,5 +49,5 @@ func (r iteratorForCreateChunks) Err() error {
 }
 
 func (q *Queries) CreateChunks(ctx context.Context, arg []CreateChunksParams) (int64, error) {
-	return q.db.CopyFrom(ctx, []string{"code_chunks"}, []string{"symbol_name", "symbol_type", "start_line", "end_line", "content", "doc", "embedding", "token_count", "sha256", "package", "file_path"}, &iteratorForCreateChunks{rows: arg})
+	return q.db.CopyFrom(ctx, []string{"code_chunks"}, []string{"symbol_name", "symbol_type", "start_line", "end_line", "content", "doc", "embedding", "token_count", "sha256", "package", "file_path", "snapshot_id"}, &iteratorForCreateChunks{rows: arg})
 }
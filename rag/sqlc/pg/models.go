@@ -23,4 +23,13 @@ type CodeChunk struct {
 	TokenCount int32
 	Sha256     string
 	CreatedAt  pgtype.Timestamptz
+	SnapshotID pgtype.UUID
+}
+
+type IndexSnapshot struct {
+	ID             pgtype.UUID
+	Root           string
+	EmbeddingModel string
+	Dimensions     int32
+	CreatedAt      pgtype.Timestamptz
 }
@@ -13,9 +13,9 @@ import (
 )
 
 const createChunk = `-- name: CreateChunk :one
-INSERT INTO code_chunks (symbol_name, symbol_type, start_line, end_line, content, doc, embedding, token_count, sha256, package, file_path)
-VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-RETURNING id, symbol_name, symbol_type, package, file_path, start_line, end_line, content, doc, embedding, token_count, sha256, created_at
+INSERT INTO code_chunks (symbol_name, symbol_type, start_line, end_line, content, doc, embedding, token_count, sha256, package, file_path, snapshot_id)
+VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+RETURNING id, symbol_name, symbol_type, package, file_path, start_line, end_line, content, doc, embedding, token_count, sha256, created_at, snapshot_id
 `
 
 type CreateChunkParams struct {
@@ -30,6 +30,7 @@ type CreateChunkParams struct {
 	Sha256     string
 	Package    string
 	FilePath   string
+	SnapshotID pgtype.UUID
 }
 
 func (q *Queries) CreateChunk(ctx context.Context, arg CreateChunkParams) (CodeChunk, error) {
@@ -45,6 +46,7 @@ func (q *Queries) CreateChunk(ctx context.Context, arg CreateChunkParams) (CodeC
 		arg.Sha256,
 		arg.Package,
 		arg.FilePath,
+		arg.SnapshotID,
 	)
 	var i CodeChunk
 	err := row.Scan(
@@ -61,6 +63,7 @@ func (q *Queries) CreateChunk(ctx context.Context, arg CreateChunkParams) (CodeC
 		&i.TokenCount,
 		&i.Sha256,
 		&i.CreatedAt,
+		&i.SnapshotID,
 	)
 	return i, err
 }
@@ -77,47 +80,95 @@ type CreateChunksParams struct {
 	Sha256     string
 	Package    string
 	FilePath   string
+	SnapshotID pgtype.UUID
 }
 
-const findSimilarChunks = `-- name: FindSimilarChunks :many
-SELECT id, symbol_name, symbol_type, package, file_path, start_line, end_line, content, doc, embedding, token_count, sha256, created_at,
-       embedding <-> $1 AS distance
-FROM code_chunks
-ORDER BY embedding <-> $1
-LIMIT $2
+const createSnapshot = `-- name: CreateSnapshot :one
+INSERT INTO index_snapshots (root, embedding_model, dimensions)
+VALUES ($1, $2, $3)
+RETURNING id, root, embedding_model, dimensions, created_at
 `
 
-type FindSimilarChunksParams struct {
-	Embedding pgvector.Vector
-	Limit     int32
+type CreateSnapshotParams struct {
+	Root           string
+	EmbeddingModel string
+	Dimensions     int32
 }
 
-type FindSimilarChunksRow struct {
-	ID         pgtype.UUID
-	SymbolName string
-	SymbolType string
-	Package    string
+func (q *Queries) CreateSnapshot(ctx context.Context, arg CreateSnapshotParams) (IndexSnapshot, error) {
+	row := q.db.QueryRow(ctx, createSnapshot, arg.Root, arg.EmbeddingModel, arg.Dimensions)
+	var i IndexSnapshot
+	err := row.Scan(
+		&i.ID,
+		&i.Root,
+		&i.EmbeddingModel,
+		&i.Dimensions,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteFileChunks = `-- name: DeleteFileChunks :exec
+DELETE FROM code_chunks
+WHERE snapshot_id = $1 AND file_path = $2
+`
+
+type DeleteFileChunksParams struct {
+	SnapshotID pgtype.UUID
 	FilePath   string
-	StartLine  int32
-	EndLine    int32
-	Content    string
-	Doc        pgtype.Text
-	Embedding  pgvector.Vector
-	TokenCount int32
-	Sha256     string
-	CreatedAt  pgtype.Timestamptz
-	Distance   interface{}
 }
 
-func (q *Queries) FindSimilarChunks(ctx context.Context, arg FindSimilarChunksParams) ([]FindSimilarChunksRow, error) {
-	rows, err := q.db.Query(ctx, findSimilarChunks, arg.Embedding, arg.Limit)
+func (q *Queries) DeleteFileChunks(ctx context.Context, arg DeleteFileChunksParams) error {
+	_, err := q.db.Exec(ctx, deleteFileChunks, arg.SnapshotID, arg.FilePath)
+	return err
+}
+
+const deleteSupersededSnapshots = `-- name: DeleteSupersededSnapshots :exec
+DELETE FROM index_snapshots
+WHERE root = $1 AND id <> $2
+`
+
+type DeleteSupersededSnapshotsParams struct {
+	Root string
+	ID   pgtype.UUID
+}
+
+func (q *Queries) DeleteSupersededSnapshots(ctx context.Context, arg DeleteSupersededSnapshotsParams) error {
+	_, err := q.db.Exec(ctx, deleteSupersededSnapshots, arg.Root, arg.ID)
+	return err
+}
+
+const findChunks = `-- name: FindChunks :many
+SELECT id, symbol_name, symbol_type, package, file_path, start_line, end_line, content, doc, embedding, token_count, sha256, created_at, snapshot_id
+FROM code_chunks
+WHERE snapshot_id = $1
+  AND ($2::text = '' OR file_path = $2::text)
+  AND ($3::text = '' OR package = $3::text OR right(package, length($3::text) + 1) = '/' || $3::text OR starts_with(package, $3::text || '/'))
+  AND ($4::text = '' OR symbol_name = $4::text)
+ORDER BY file_path, start_line
+`
+
+type FindChunksParams struct {
+	SnapshotID pgtype.UUID
+	FilePath   string
+	Package    string
+	SymbolName string
+}
+
+func (q *Queries) FindChunks(ctx context.Context, arg FindChunksParams) ([]CodeChunk, error) {
+	rows, err := q.db.Query(ctx, findChunks,
+		arg.SnapshotID,
+		arg.FilePath,
+		arg.Package,
+		arg.SymbolName,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []FindSimilarChunksRow
+	var items []CodeChunk
 	for rows.Next() {
-		var i FindSimilarChunksRow
+		var i CodeChunk
 		if err := rows.Scan(
 			&i.ID,
 			&i.SymbolName,
@@ -132,7 +183,7 @@ func (q *Queries) FindSimilarChunks(ctx context.Context, arg FindSimilarChunksPa
 			&i.TokenCount,
 			&i.Sha256,
 			&i.CreatedAt,
-			&i.Distance,
+			&i.SnapshotID,
 		); err != nil {
 			return nil, err
 		}
@@ -143,3 +194,24 @@ func (q *Queries) FindSimilarChunks(ctx context.Context, arg FindSimilarChunksPa
 	}
 	return items, nil
 }
+
+const latestSnapshot = `-- name: LatestSnapshot :one
+SELECT id, root, embedding_model, dimensions, created_at
+FROM index_snapshots
+WHERE root = $1
+ORDER BY created_at DESC
+LIMIT 1
+`
+
+func (q *Queries) LatestSnapshot(ctx context.Context, root string) (IndexSnapshot, error) {
+	row := q.db.QueryRow(ctx, latestSnapshot, root)
+	var i IndexSnapshot
+	err := row.Scan(
+		&i.ID,
+		&i.Root,
+		&i.EmbeddingModel,
+		&i.Dimensions,
+		&i.CreatedAt,
+	)
+	return i, err
+}
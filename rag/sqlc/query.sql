@@ -1,6 +1,6 @@
 -- name: CreateChunk :one
-INSERT INTO code_chunks (symbol_name, symbol_type, start_line, end_line, content, doc, embedding, token_count, sha256, package, file_path)
-VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+INSERT INTO code_chunks (symbol_name, symbol_type, start_line, end_line, content, doc, embedding, token_count, sha256, package, file_path, snapshot_id)
+VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 RETURNING *;
 
 -- name: CreateChunks :copyfrom
@@ -15,7 +15,8 @@ INSERT INTO code_chunks (
     token_count,
     sha256,
     package,
-    file_path
+    file_path,
+    snapshot_id
 ) VALUES (
     @symbol_name,
     @symbol_type,
@@ -27,12 +28,35 @@ INSERT INTO code_chunks (
     @token_count,
     @sha256,
     @package,
-    @file_path
+    @file_path,
+    @snapshot_id
 );
 
--- name: FindSimilarChunks :many
-SELECT *,
-       embedding <-> $1 AS distance
+-- name: CreateSnapshot :one
+INSERT INTO index_snapshots (root, embedding_model, dimensions)
+VALUES (@root, @embedding_model, @dimensions)
+RETURNING *;
+
+-- name: LatestSnapshot :one
+SELECT *
+FROM index_snapshots
+WHERE root = @root
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: DeleteSupersededSnapshots :exec
+DELETE FROM index_snapshots
+WHERE root = @root AND id <> @id;
+
+-- name: DeleteFileChunks :exec
+DELETE FROM code_chunks
+WHERE snapshot_id = @snapshot_id AND file_path = @file_path;
+
+-- name: FindChunks :many
+SELECT *
 FROM code_chunks
-ORDER BY embedding <-> $1
-LIMIT $2;
+WHERE snapshot_id = @snapshot_id
+  AND (@file_path::text = '' OR file_path = @file_path::text)
+  AND (@package::text = '' OR package = @package::text OR right(package, length(@package::text) + 1) = '/' || @package::text OR starts_with(package, @package::text || '/'))
+  AND (@symbol_name::text = '' OR symbol_name = @symbol_name::text)
+ORDER BY file_path, start_line;
@@ -3,6 +3,15 @@ SET SEARCH_PATH = 'rag', 'public';
 
 CREATE EXTENSION IF NOT EXISTS vector;
 
+-- every run of the indexer creates a snapshot, recording how its embeddings were created
+CREATE TABLE IF NOT EXISTS index_snapshots (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    root TEXT NOT NULL,              -- the indexed repository path
+    embedding_model TEXT NOT NULL,
+    dimensions INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
 CREATE TABLE IF NOT EXISTS code_chunks (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     symbol_name TEXT NOT NULL,  -- the name as which the symbol was declared
@@ -14,9 +23,12 @@ CREATE TABLE IF NOT EXISTS code_chunks (
     content TEXT NOT NULL,      -- Code itself as raw text
     doc TEXT,                   -- Optional comments
 
-    -- 1536 represents the vector dimensions of GPT's text-embedding-3-small
-    embedding vector(1536),
+    -- dimensions depend on the embedding model, see index_snapshots
+    embedding vector,
     token_count INT NOT NULL,
     sha256 TEXT NOT NULL,
-    created_at TIMESTAMPTZ DEFAULT now()
+    created_at TIMESTAMPTZ DEFAULT now(),
+    snapshot_id UUID NOT NULL REFERENCES index_snapshots (id) ON DELETE CASCADE
 );
+
+CREATE INDEX IF NOT EXISTS code_chunks_snapshot_id_idx ON code_chunks (snapshot_id);
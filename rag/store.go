@@ -2,12 +2,55 @@ package rag
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/sajuno/goon/language/golang"
+	"time"
 )
 
+// ErrNoSnapshot is returned when nothing has been indexed yet
+var ErrNoSnapshot = errors.New("no index snapshot found, run 'goon index' first")
+
 type Store interface {
-	SaveChunks(ctx context.Context, chunks []Chunk) error
-	FindSimilarChunks(ctx context.Context, vector []float32) ([]SimilarChunk, error)
+	// SaveChunks stores chunks as a new snapshot, replacing earlier snapshots of the same root
+	SaveChunks(ctx context.Context, snapshot Snapshot, chunks []Chunk) (Snapshot, error)
+
+	// LatestSnapshot returns the snapshot of a repository root, ErrNoSnapshot if it wasn't indexed
+	LatestSnapshot(ctx context.Context, root string) (Snapshot, error)
+
+	FindSimilarChunks(ctx context.Context, snapshotID string, vector []float32, opts SearchOptions) ([]SimilarChunk, error)
+
+	// FindChunks looks up chunks by file, package and name, ordered by file and line
+	FindChunks(ctx context.Context, snapshotID string, q ChunkQuery) ([]Chunk, error)
+
+	// ReplaceFileChunks replaces the chunks of a single file in a snapshot, for files that changed since indexing
+	ReplaceFileChunks(ctx context.Context, snapshotID, filePath string, chunks []Chunk) error
+}
+
+// ChunkQuery selects chunks for FindChunks, empty fields match everything
+type ChunkQuery struct {
+	// FilePath is absolute, like the paths chunks are indexed with
+	FilePath string
+
+	// Package matches like SearchOptions.Package
+	Package string
+
+	// Name is the declared name, without receiver for methods
+	Name string
+}
+
+// DefaultSearchLimit is the amount of chunks FindSimilarChunks returns when no limit is given
+const DefaultSearchLimit = 50
+
+// SearchOptions narrow down FindSimilarChunks, zero values don't filter
+type SearchOptions struct {
+	// Package matches an import path, a trailing part of one ("rag" or "goon/rag") or a parent of it
+	Package string
+
+	Kinds []golang.ChunkKind
+
+	// Limit defaults to DefaultSearchLimit
+	Limit int
 }
 
 type Chunk struct {
@@ -26,3 +69,36 @@ type SimilarChunk struct {
 
 	Distance float64
 }
+
+// Snapshot is a single indexing run of a repository.
+// Vectors are only comparable to vectors of the same embedding model and dimensions.
+type Snapshot struct {
+	ID             string
+	Root           string
+	EmbeddingModel string
+	Dimensions     int
+	CreatedAt      time.Time
+}
+
+// Compatible reports whether query embeddings of the given model can be compared to this snapshot.
+// dimensions of 0 means the model's native dimensions and only the model is checked.
+func (s Snapshot) Compatible(model string, dimensions int) error {
+	if s.EmbeddingModel != model || (dimensions > 0 && s.Dimensions != dimensions) {
+		return &EmbeddingMismatchError{Snapshot: s, Model: model, Dimensions: dimensions}
+	}
+	return nil
+}
+
+// EmbeddingMismatchError is returned when a query is embedded differently from the indexed snapshot
+type EmbeddingMismatchError struct {
+	Snapshot   Snapshot
+	Model      string
+	Dimensions int
+}
+
+func (e *EmbeddingMismatchError) Error() string {
+	return fmt.Sprintf(
+		"index was built with %s (%d dimensions) but queries use %s (%d dimensions), re-index with the current model",
+		e.Snapshot.EmbeddingModel, e.Snapshot.Dimensions, e.Model, e.Dimensions,
+	)
+}
@@ -2,38 +2,216 @@ package repl
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/sajuno/goon/agent"
+	"github.com/sajuno/goon/gitdiff"
+	"github.com/sajuno/goon/session"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
 type commandHandler struct {
-	agent *agent.Agent
+	agent    *agent.Agent
+	sessions *session.Store
+	commands *registry
+
+	// session the current conversation is part of
+	session *session.Session
+
+	// scope narrows down and extends the code explain answers from, it outlives sessions
+	scope agent.Scope
+
+	// confirm asks the user before changes are applied
+	confirm agent.ConfirmFunc
 }
 
-func newCommandHandler(agent *agent.Agent) *commandHandler {
-	return &commandHandler{agent: agent}
+func newCommandHandler(agent *agent.Agent, sessions *session.Store) *commandHandler {
+	h := &commandHandler{agent: agent, sessions: sessions, session: session.New()}
+	h.commands = newRegistry(
+		&command{
+			name: "explain",
+			args: "<query>",
+			help: "Ask Goon for an explanation about something in the repository",
+			run:  h.explain,
+		},
+		&command{
+			name:    "edit",
+			aliases: []string{"refactor"},
+			args:    "<change>",
+			help:    "Have Goon change the code, the diff is shown before anything is applied",
+			run:     h.edit,
+		},
+		&command{
+			name: ":new",
+			help: "Start a new conversation, follow-up questions share context until then",
+			run:  h.newSession,
+		},
+		&command{
+			name: ":sessions",
+			help: "List past conversations",
+			run:  h.listSessions,
+		},
+		&command{
+			name:     ":resume",
+			args:     "<id>",
+			help:     "Continue a past conversation",
+			run:      h.resumeSession,
+			complete: h.completeSessions,
+		},
+		&command{
+			name:     ":scope",
+			args:     "[package]",
+			help:     "Only explain from the code of a package, without one from the whole repository",
+			run:      h.setScope,
+			complete: h.completePackages,
+		},
+		&command{
+			name:     ":pin",
+			args:     "<file|symbol>",
+			help:     "Always explain with a file or a symbol like rag.PGStore.FindChunks in the context",
+			run:      h.pin,
+			complete: h.completeFiles,
+		},
+		&command{
+			name: ":context",
+			help: "Show the scope, the pinned code and how much of the token budget it takes",
+			run:  h.showContext,
+		},
+		&command{
+			name: ":clear",
+			help: "Unpin everything and explain from the whole repository again",
+			run:  h.clearContext,
+		},
+		&command{
+			name: ":help",
+			help: "Show this help",
+			run: func(context.Context, string) error {
+				fmt.Print(h.commands.help())
+				return nil
+			},
+		},
+		&command{
+			name:    ":quit",
+			aliases: []string{":exit"},
+			help:    "Exit the repl",
+			run: func(context.Context, string) error {
+				return errQuit
+			},
+		},
+	)
+	return h
 }
 
+// handleCommand runs the command of a line
 func (h *commandHandler) handleCommand(ctx context.Context, line string) error {
-	switch {
-	case strings.HasPrefix(line, "explain "):
-		prompt := strings.TrimPrefix(line, "explain ")
-		fmt.Print("Thinking...")
-		return h.explain(ctx, prompt)
-	default:
+	c, arg, ok := h.commands.lookup(line)
+	if !ok {
 		fmt.Println("Unknown command. Try :help")
+		return nil
 	}
-	return nil
+	if arg == "" && strings.HasPrefix(c.args, "<") {
+		return fmt.Errorf("usage: %s %s", c.name, c.args)
+	}
+	return c.run(ctx, arg)
 }
 
 func (h *commandHandler) explain(ctx context.Context, prompt string) error {
-	response, err := h.agent.Explain(ctx, prompt)
-	fmt.Print("\r\033[2K") // clear 'spinner'
+	out := agent.NewTerminalStream(os.Stdout)
+	_, err := h.agent.ExplainScoped(ctx, h.session, prompt, h.scope, out)
+	out.Finish()
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Cancelled")
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf(`failed to explain "%s": %w`, prompt, err)
 	}
 
-	fmt.Println(response)
+	if err := h.sessions.Save(h.session); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+// edit proposes changes and applies them once confirmed, declined changes can be saved as a patch instead
+func (h *commandHandler) edit(ctx context.Context, instruction string) error {
+	out := agent.NewTerminalStream(os.Stdout)
+	changes, err := h.agent.ProposeEdit(ctx, h.session, instruction, agent.DefaultEditAttempts, out)
+	out.Finish()
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Cancelled")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf(`failed to edit "%s": %w`, instruction, err)
+	}
+	if err := h.sessions.Save(h.session); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	fmt.Printf("%s\n\n%s", changes.Summary, gitdiff.Colorize(changes.Patch))
+
+	apply, err := h.confirm(ctx, "Apply these changes?")
+	if err != nil {
+		return err
+	}
+	if apply {
+		if err := h.agent.ApplyChanges(ctx, changes); err != nil {
+			return fmt.Errorf("failed to apply changes: %w", err)
+		}
+		fmt.Printf("Changed %s\n", strings.Join(changes.Paths(), ", "))
+		return nil
+	}
+
+	// the patch's paths are relative to the workspace root, it's written there whatever directory goon runs in
+	patchPath := filepath.Join(h.agent.Workspace().Root(), fmt.Sprintf("goon-%s.patch", h.session.ShortID()))
+	save, err := h.confirm(ctx, fmt.Sprintf("Write them to %s instead?", patchPath))
+	if err != nil || !save {
+		return err
+	}
+	if err := os.WriteFile(patchPath, []byte(changes.Patch), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", patchPath, err)
+	}
+	fmt.Printf("Wrote %s, apply it with git apply %s\n", patchPath, patchPath)
+	return nil
+}
+
+// newSession starts a new conversation, the current one stays resumable if anything was asked
+func (h *commandHandler) newSession(context.Context, string) error {
+	h.session = session.New()
+	fmt.Printf("Started session %s\n", h.session.ShortID())
+	return nil
+}
+
+func (h *commandHandler) listSessions(context.Context, string) error {
+	list, err := h.sessions.List()
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		fmt.Println("No sessions yet")
+		return nil
+	}
+
+	for _, s := range list {
+		marker := " "
+		if s.ID == h.session.ID {
+			marker = "*"
+		}
+		fmt.Printf("%s %s  %s  %2d turns  %s\n", marker, s.ShortID(), s.UpdatedAt.Format("2006-01-02 15:04"), len(s.Turns), s.Title())
+	}
+	return nil
+}
+
+func (h *commandHandler) resumeSession(_ context.Context, id string) error {
+	s, err := h.sessions.Load(id)
+	if err != nil {
+		return err
+	}
+	h.session = s
+
+	fmt.Printf("Resumed session %s: %s\n", s.ShortID(), s.Title())
 	return nil
 }
@@ -0,0 +1,80 @@
+package repl
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+func (h *commandHandler) completeSessions(string) []string {
+	list, err := h.sessions.List()
+	if err != nil {
+		return nil
+	}
+
+	ids := make([]string, 0, len(list))
+	for _, s := range list {
+		ids = append(ids, s.ShortID())
+	}
+	return ids
+}
+
+// completePackages returns the directories of the workspace holding Go files, which scope by their import path's
+// trailing elements
+func (h *commandHandler) completePackages(string) []string {
+	ws := h.agent.Workspace()
+
+	var dirs []string
+	seen := make(map[string]bool)
+	_ = filepath.WalkDir(ws.Root(), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, err := ws.Rel(p)
+		if err != nil || rel == "." {
+			return nil
+		}
+		if d.IsDir() {
+			if strings.HasPrefix(d.Name(), ".") || ws.Ignored(rel, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if dir := path.Dir(rel); strings.HasSuffix(rel, ".go") && dir != "." && !seen[dir] && !ws.Ignored(rel, false) {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+		return nil
+	})
+	return dirs
+}
+
+// completeFiles lists the Go files and directories next to the path typed so far, one directory at a time
+func (h *commandHandler) completeFiles(prefix string) []string {
+	ws := h.agent.Workspace()
+
+	dir := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = prefix[:i+1]
+	}
+
+	entries, err := os.ReadDir(filepath.Join(ws.Root(), filepath.FromSlash(dir)))
+	if err != nil {
+		return nil
+	}
+
+	var candidates []string
+	for _, e := range entries {
+		rel := dir + e.Name()
+		switch {
+		case strings.HasPrefix(e.Name(), "."), ws.Ignored(rel, e.IsDir()):
+		case e.IsDir():
+			candidates = append(candidates, rel+"/")
+		case strings.HasSuffix(e.Name(), ".go"):
+			candidates = append(candidates, rel)
+		}
+	}
+	return candidates
+}
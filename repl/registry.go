@@ -0,0 +1,119 @@
+package repl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// errQuit is returned by commands that end the repl
+var errQuit = errors.New("quit")
+
+// command is an entry of the repl, invoked by its name followed by its argument
+type command struct {
+	name    string
+	aliases []string
+
+	// args describes the argument in the help, like "<query>" or "[package]"
+	args string
+	help string
+
+	run func(ctx context.Context, arg string) error
+
+	// complete returns candidates for the argument typed so far, nil if the argument isn't completed
+	complete func(prefix string) []string
+}
+
+// registry holds the commands in the order they're listed in the help
+type registry struct {
+	commands []*command
+	byName   map[string]*command
+}
+
+func newRegistry(commands ...*command) *registry {
+	r := &registry{byName: make(map[string]*command)}
+	for _, c := range commands {
+		r.commands = append(r.commands, c)
+		for _, name := range append([]string{c.name}, c.aliases...) {
+			if _, ok := r.byName[name]; ok {
+				panic("duplicate repl command " + name)
+			}
+			r.byName[name] = c
+		}
+	}
+	return r
+}
+
+// lookup splits a line into its command and argument
+func (r *registry) lookup(line string) (*command, string, bool) {
+	name, arg, _ := strings.Cut(line, " ")
+	c, ok := r.byName[name]
+	return c, strings.TrimSpace(arg), ok
+}
+
+// help lists the commands, the builtins starting with a colon separately from the requests to goon
+func (r *registry) help() string {
+	usage := func(c *command) string {
+		return strings.TrimSpace(c.name + " " + c.args)
+	}
+
+	width := 0
+	for _, c := range r.commands {
+		width = max(width, len(usage(c)))
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\nAvailable commands:\n")
+	for i, c := range r.commands {
+		if i > 0 && strings.HasPrefix(c.name, ":") != strings.HasPrefix(r.commands[i-1].name, ":") {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "  %-*s -> %s\n", width, usage(c), c.help)
+	}
+	sb.WriteString("\nTab completes commands and their arguments.\n\n")
+	return sb.String()
+}
+
+// Do completes the line up to pos, it implements readline.AutoCompleter. Candidates are returned without the
+// part that's typed already, length is the size of that part.
+func (r *registry) Do(line []rune, pos int) ([][]rune, int) {
+	typed := string(line[:pos])
+
+	name, arg, hasArg := strings.Cut(typed, " ")
+	if !hasArg {
+		var names []string
+		for n := range r.byName {
+			if strings.HasPrefix(n, name) {
+				names = append(names, n)
+			}
+		}
+		return suffixes(names, name, " "), len([]rune(name))
+	}
+
+	c, ok := r.byName[name]
+	if !ok || c.complete == nil {
+		return nil, 0
+	}
+	arg = strings.TrimLeft(arg, " ")
+	return suffixes(c.complete(arg), arg, ""), len([]rune(arg))
+}
+
+// suffixes returns what's left to type of the candidates starting with prefix, sorted.
+// Candidates ending in a slash are directories to complete further, they don't get the terminator.
+func suffixes(candidates []string, prefix, terminator string) [][]rune {
+	sort.Strings(candidates)
+
+	var out [][]rune
+	for _, c := range candidates {
+		if !strings.HasPrefix(c, prefix) {
+			continue
+		}
+		if !strings.HasSuffix(c, "/") {
+			c += terminator
+		}
+		out = append(out, []rune(strings.TrimPrefix(c, prefix)))
+	}
+	return out
+}
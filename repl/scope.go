@@ -0,0 +1,99 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"github.com/sajuno/goon/agent"
+	"strings"
+)
+
+func (h *commandHandler) setScope(_ context.Context, pkg string) error {
+	h.scope.Package = strings.TrimSuffix(pkg, "/")
+	if h.scope.Package == "" {
+		fmt.Println("Explaining from the whole repository")
+		return nil
+	}
+	fmt.Printf("Explaining from %s only\n", h.scope.Package)
+	return nil
+}
+
+// pin adds a file or symbol to the scope, it's looked up right away so typos don't surface on the next question
+func (h *commandHandler) pin(ctx context.Context, target string) error {
+	pin, err := h.agent.ParsePin(target)
+	if err != nil {
+		return err
+	}
+	for _, p := range h.scope.Pins {
+		if p == pin {
+			fmt.Printf("%s is pinned already\n", h.pinName(pin))
+			return nil
+		}
+	}
+
+	chunks, err := h.agent.PinnedChunks(ctx, []agent.Pin{pin})
+	if err != nil {
+		return fmt.Errorf("failed to pin %s: %w", target, err)
+	}
+	h.scope.Pins = append(h.scope.Pins, pin)
+
+	fmt.Printf("Pinned %s, %d tokens\n", h.pinName(pin), chunks[0].Tokens)
+	if pinned := h.pinnedTokens(ctx); pinned >= agent.ContextBudget {
+		fmt.Printf("The pinned code takes %d tokens, more than the budget of %d, pinned code past it is left out\n",
+			pinned, agent.ContextBudget)
+	}
+	return nil
+}
+
+func (h *commandHandler) showContext(ctx context.Context, _ string) error {
+	fmt.Printf("Session %s, %d turns\n", h.session.ShortID(), len(h.session.Turns))
+
+	if h.scope.Package == "" {
+		fmt.Println("Scope: the whole repository")
+	} else {
+		fmt.Printf("Scope: %s\n", h.scope.Package)
+	}
+
+	if len(h.scope.Pins) == 0 {
+		fmt.Println("Nothing pinned")
+	} else {
+		fmt.Println("Pinned:")
+	}
+	pinned := 0
+	for _, pin := range h.scope.Pins {
+		chunks, err := h.agent.PinnedChunks(ctx, []agent.Pin{pin})
+		if err != nil {
+			fmt.Printf("  %s: %v\n", h.pinName(pin), err)
+			continue
+		}
+		pinned += chunks[0].Tokens
+		fmt.Printf("  %s (%d tokens)\n", h.pinName(pin), chunks[0].Tokens)
+	}
+
+	fmt.Printf("Budget: %d of %d tokens pinned, %d left for retrieved code\n",
+		pinned, agent.ContextBudget, max(agent.ContextBudget-pinned, 0))
+	return nil
+}
+
+func (h *commandHandler) clearContext(context.Context, string) error {
+	h.scope = agent.Scope{}
+	fmt.Println("Cleared the pinned code, explaining from the whole repository")
+	return nil
+}
+
+// pinnedTokens is the size of the pinned code, pins that can't be read anymore don't count
+func (h *commandHandler) pinnedTokens(ctx context.Context) int {
+	tokens := 0
+	for _, pin := range h.scope.Pins {
+		if chunks, err := h.agent.PinnedChunks(ctx, []agent.Pin{pin}); err == nil {
+			tokens += chunks[0].Tokens
+		}
+	}
+	return tokens
+}
+
+func (h *commandHandler) pinName(pin agent.Pin) string {
+	if pin.Path != "" {
+		return h.agent.Workspace().Display(pin.Path)
+	}
+	return pin.Symbol.String()
+}
@@ -5,17 +5,25 @@ import (
 	"errors"
 	"fmt"
 	"github.com/sajuno/goon/agent"
+	"github.com/sajuno/goon/session"
 	"io"
 	"log"
+	"os"
+	"os/signal"
 	"strings"
 
 	"github.com/chzyer/readline"
 )
 
-func Start(ctx context.Context, ag *agent.Agent) error {
+const prompt = "\033[31m> \033[0m"
+
+func Start(ctx context.Context, ag *agent.Agent, sessions *session.Store) error {
+	h := newCommandHandler(ag, sessions)
+
 	rl, err := readline.NewEx(&readline.Config{
-		Prompt:          "\033[31m> \033[0m",
+		Prompt:          prompt,
 		HistoryFile:     "/tmp/goon_history.tmp",
+		AutoComplete:    h.commands,
 		InterruptPrompt: "^C",
 		EOFPrompt:       "exit",
 	})
@@ -26,7 +34,15 @@ func Start(ctx context.Context, ag *agent.Agent) error {
 
 	fmt.Println("Goon REPL is ready. Type ':help' or enter a command.")
 
-	h := newCommandHandler(ag)
+	h.confirm = confirmer(rl)
+	ag.SetConfirm(h.confirm)
+
+	// the repl handles interrupts itself, ctrl+c cancels the command in flight instead of exiting goon.
+	// Ignore clears the handler installed by main, readline handles ctrl+c while reading input
+	signal.Ignore(os.Interrupt)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer signal.Stop(sigs)
 
 	for {
 		select {
@@ -55,32 +71,71 @@ func Start(ctx context.Context, ag *agent.Agent) error {
 				continue
 			}
 
-			if strings.HasPrefix(line, ":") {
-				if handleBuiltin(line) {
-					return nil
-				}
-				continue
+			err = h.runCommand(ctx, sigs, line)
+			if errors.Is(err, errQuit) {
+				fmt.Println("Exiting...")
+				return nil
 			}
-
-			if err := h.handleCommand(ctx, line); err != nil {
+			if err != nil {
 				log.Printf("command error: %v", err)
 			}
 		}
 	}
 }
 
-func handleBuiltin(cmd string) bool {
-	switch cmd {
-	case ":quit", ":exit":
-		fmt.Println("Exiting...")
-		return true
-	case ":help":
-		fmt.Println(`
-Available commands:
-  explain <query> -> Ask Goon for an explanation about something in the repository
-`)
+// runCommand handles a command with a context that's cancelled on interrupt
+func (h *commandHandler) runCommand(ctx context.Context, sigs <-chan os.Signal, line string) error {
+	// drop interrupts that arrived while no command was running
+	select {
+	case <-sigs:
 	default:
-		fmt.Println("Unknown command. Try :help")
 	}
-	return false
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return h.handleCommand(ctx, line)
+}
+
+// confirmer asks for confirmation on the repl's own input, it's only called while a command runs
+// and readline isn't reading otherwise
+func confirmer(rl *readline.Instance) agent.ConfirmFunc {
+	return func(ctx context.Context, question string) (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
+		rl.HistoryDisable()
+		defer rl.HistoryEnable()
+
+		// the answer being streamed may not have ended its line
+		fmt.Println()
+
+		// questions may come with context like a diff, only their last line becomes the prompt
+		if i := strings.LastIndex(question, "\n"); i >= 0 {
+			fmt.Println(question[:i])
+			question = question[i+1:]
+		}
+		rl.SetPrompt(fmt.Sprintf("\033[33m%s [y/N] \033[0m", question))
+		defer rl.SetPrompt(prompt)
+
+		answer, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) || errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes", nil
+	}
 }
@@ -0,0 +1,79 @@
+package session
+
+import (
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+	"strings"
+	"time"
+)
+
+// Session is a conversation with goon that can be continued with follow-up questions
+type Session struct {
+	ID string `json:"id"`
+
+	// ThreadID of the OpenAI assistant thread, empty until the first question is asked
+	ThreadID string `json:"thread_id,omitempty"`
+
+	// Messages is the conversation when using chat completions, which are stateless on OpenAI's side
+	Messages []openai.ChatCompletionMessage `json:"messages,omitempty"`
+
+	Turns []Turn `json:"turns"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Turn is a single question and the answer goon gave
+type Turn struct {
+	Query     string    `json:"query"`
+	Answer    string    `json:"answer"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func New() *Session {
+	now := time.Now()
+	return &Session{
+		ID:        uuid.NewString(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// AddTurn records a question and answer
+func (s *Session) AddTurn(query, answer string) {
+	now := time.Now()
+	s.Turns = append(s.Turns, Turn{Query: query, Answer: answer, CreatedAt: now})
+	s.UpdatedAt = now
+}
+
+// Title is the first question asked, used to recognize sessions when listing them
+func (s *Session) Title() string {
+	if len(s.Turns) == 0 {
+		return "(empty)"
+	}
+
+	title := strings.Join(strings.Fields(s.Turns[0].Query), " ")
+	if runes := []rune(title); len(runes) > 60 {
+		title = string(runes[:57]) + "..."
+	}
+	return title
+}
+
+// ShortID is enough of the ID to identify a session in practice
+func (s *Session) ShortID() string {
+	return s.ID[:8]
+}
+
+// RecentQueries returns up to n of the latest questions, oldest first
+func (s *Session) RecentQueries(n int) []string {
+	turns := s.Turns
+	if len(turns) > n {
+		turns = turns[len(turns)-n:]
+	}
+
+	out := make([]string, 0, len(turns))
+	for _, t := range turns {
+		out = append(out, t.Query)
+	}
+	return out
+}
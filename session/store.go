@@ -0,0 +1,123 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var ErrNotFound = errors.New("session not found")
+
+// Store persists sessions as json files in a directory
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// DefaultDir is goon's directory in the user's config dir
+func DefaultDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "goon", "sessions"), nil
+}
+
+func (s *Store) Save(sess *Session) error {
+	b, err := json.MarshalIndent(sess, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write and rename so an interrupted save doesn't corrupt the session
+	tmp := s.path(sess.ID) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	return os.Rename(tmp, s.path(sess.ID))
+}
+
+// Load returns the session with the given ID, or the only session whose ID starts with it
+func (s *Store) Load(id string) (*Session, error) {
+	sessions, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*Session
+	for _, sess := range sessions {
+		if sess.ID == id {
+			return sess, nil
+		}
+		if strings.HasPrefix(sess.ID, id) {
+			matches = append(matches, sess)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("session id %s is ambiguous, %d sessions match", id, len(matches))
+	}
+}
+
+// Latest returns the most recently updated session
+func (s *Store) Latest() (*Session, error) {
+	sessions, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, ErrNotFound
+	}
+	return sessions[0], nil
+}
+
+// List returns all sessions, most recently updated first
+func (s *Store) List() ([]*Session, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session directory: %w", err)
+	}
+
+	var sessions []*Session
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(s.dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read session %s: %w", e.Name(), err)
+		}
+
+		var sess Session
+		if err := json.Unmarshal(b, &sess); err != nil {
+			return nil, fmt.Errorf("failed to decode session %s: %w", e.Name(), err)
+		}
+		sessions = append(sessions, &sess)
+	}
+
+	slices.SortFunc(sessions, func(a, b *Session) int {
+		return b.UpdatedAt.Compare(a.UpdatedAt)
+	})
+
+	return sessions, nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
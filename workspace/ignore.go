@@ -0,0 +1,107 @@
+package workspace
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFiles are read from the workspace root, in order
+var ignoreFiles = []string{".gitignore", ".goonignore"}
+
+// defaultIgnoreRules apply to every workspace
+var defaultIgnoreRules = []string{".git/"}
+
+type ignoreRule struct {
+	pattern string
+
+	// negate re-includes paths matched by earlier rules
+	negate bool
+
+	// dirOnly rules end with a slash and only match directories
+	dirOnly bool
+
+	// anchored rules contain a slash and match relative to the root, others match a name at any depth
+	anchored bool
+}
+
+// ignoreRules implement the commonly used subset of gitignore: comments, negation, directory-only rules,
+// anchored rules and globs. Only the files in the root are read, nested ignore files are not supported.
+type ignoreRules []ignoreRule
+
+func loadIgnoreRules(root string) (ignoreRules, error) {
+	var rules ignoreRules
+	for _, line := range defaultIgnoreRules {
+		rules = rules.add(line)
+	}
+
+	for _, name := range ignoreFiles {
+		f, err := os.Open(filepath.Join(root, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			rules = rules.add(scanner.Text())
+		}
+		err = scanner.Err()
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+	}
+
+	return rules, nil
+}
+
+func (r ignoreRules) add(line string) ignoreRules {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return r
+	}
+
+	var rule ignoreRule
+	if rule.negate = strings.HasPrefix(line, "!"); rule.negate {
+		line = line[1:]
+	}
+	if rule.dirOnly = strings.HasSuffix(line, "/"); rule.dirOnly {
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	// a leading **/ matches at any depth, just like a pattern without a slash
+	line = strings.TrimPrefix(line, "**/")
+	rule.anchored = strings.Contains(line, "/")
+	rule.pattern = strings.TrimPrefix(line, "/")
+	if rule.pattern == "" {
+		return r
+	}
+
+	return append(r, rule)
+}
+
+// match reports whether the slash separated path relative to the root is ignored, the last matching rule wins
+func (r ignoreRules) match(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range r {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		name := rel
+		if !rule.anchored {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(rule.pattern, name); ok {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
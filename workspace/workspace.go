@@ -0,0 +1,190 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sajuno/goon/language/lsp"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrOutside = errors.New("outside of the workspace")
+	ErrIgnored = errors.New("ignored by the workspace")
+)
+
+// Workspace is the repository goon works on. Paths shown to the model or the user are relative to its root,
+// paths coming from the model are resolved against the root and refused when they're outside of it or ignored.
+type Workspace struct {
+	root   string
+	ignore ignoreRules
+}
+
+// New creates a workspace rooted at root, ignore rules are read from .gitignore and .goonignore in the root
+func New(root string) (*Workspace, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve workspace root: %w", err)
+	}
+
+	abs, err = filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve workspace root: %w", err)
+	}
+
+	ignore, err := loadIgnoreRules(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Workspace{root: abs, ignore: ignore}, nil
+}
+
+// Root returns the absolute path of the workspace root
+func (w *Workspace) Root() string {
+	return w.root
+}
+
+// Abs resolves a path relative to the root, an absolute path or a file:// URI to an absolute path in the workspace
+func (w *Workspace) Abs(path string) (string, error) {
+	abs, err := w.abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	rel, ok := w.rel(abs)
+	if !ok {
+		return "", fmt.Errorf("%s is %w", path, ErrOutside)
+	}
+
+	// symlinks could point anywhere, paths that don't exist (yet) are checked through their nearest existing parent
+	resolved, err := resolve(abs)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	if _, ok := w.rel(resolved); !ok {
+		return "", fmt.Errorf("%s is %w", path, ErrOutside)
+	}
+
+	info, err := os.Stat(abs)
+	if w.Ignored(rel, err == nil && info.IsDir()) {
+		return "", fmt.Errorf("%s is %w", path, ErrIgnored)
+	}
+
+	return abs, nil
+}
+
+// URI resolves path like Abs and returns its file:// URI
+func (w *Workspace) URI(path string) (string, error) {
+	abs, err := w.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return lsp.FileURI(abs), nil
+}
+
+// Rel returns the slash separated path relative to the root of an absolute path or file:// URI
+func (w *Workspace) Rel(path string) (string, error) {
+	abs, err := w.abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	rel, ok := w.rel(abs)
+	if !ok {
+		return "", fmt.Errorf("%s is %w", path, ErrOutside)
+	}
+	return rel, nil
+}
+
+// Display returns how a path or URI is shown to the model and the user: relative to the root when it's in the workspace,
+// as an absolute path otherwise, e.g. for definitions in the standard library
+func (w *Workspace) Display(path string) string {
+	abs, err := w.abs(path)
+	if err != nil {
+		return path
+	}
+
+	if rel, ok := w.rel(abs); ok {
+		return rel
+	}
+	return abs
+}
+
+// Ignored reports whether a path relative to the root, or one of its parent directories, matches the ignore rules
+func (w *Workspace) Ignored(rel string, isDir bool) bool {
+	rel = filepath.ToSlash(rel)
+	if rel == "." || rel == "" {
+		return false
+	}
+
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		last := i == len(parts)-1
+		if w.ignore.match(strings.Join(parts[:i+1], "/"), !last || isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// abs turns any accepted path notation into a cleaned absolute path without checking it
+func (w *Workspace) abs(path string) (string, error) {
+	if strings.HasPrefix(path, "file://") {
+		u, err := url.Parse(path)
+		if err != nil {
+			return "", fmt.Errorf("invalid file uri %s: %w", path, err)
+		}
+		path = filepath.FromSlash(u.Path)
+	} else if strings.Contains(path, "://") {
+		return "", fmt.Errorf("unsupported uri %s, use a path relative to the repository root", path)
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(w.root, filepath.FromSlash(path))
+	}
+	return filepath.Clean(path), nil
+}
+
+// resolve evaluates the symlinks of the nearest existing parent of abs and joins the missing rest back onto it
+func resolve(abs string) (string, error) {
+	var missing []string
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, reversed(missing)...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) || filepath.Dir(dir) == dir {
+			return "", err
+		}
+		// writing to a dangling symlink creates its target, so that's where the path ends up
+		if target, err := os.Readlink(dir); err == nil {
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(dir), target)
+			}
+			return resolve(filepath.Join(append([]string{target}, reversed(missing)...)...))
+		}
+		missing = append(missing, filepath.Base(dir))
+	}
+}
+
+func reversed(s []string) []string {
+	r := make([]string, len(s))
+	for i, v := range s {
+		r[len(s)-1-i] = v
+	}
+	return r
+}
+
+func (w *Workspace) rel(abs string) (string, bool) {
+	if abs == w.root {
+		return ".", true
+	}
+	if !strings.HasPrefix(abs, w.root+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(abs[len(w.root)+1:]), true
+}
@@ -0,0 +1,60 @@
+package workspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAbsRefusesSymlinkEscapes(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(outside, "s.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "missing.go"), filepath.Join(root, "dangling.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "pkg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	ws, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		outside bool
+	}{
+		{name: "existing file behind symlink", path: "link/s.txt", outside: true},
+		{name: "new file behind symlink", path: "link/new.go", outside: true},
+		{name: "new file in new directory behind symlink", path: "link/sub/new.go", outside: true},
+		{name: "dangling symlink", path: "dangling.go", outside: true},
+		{name: "new file behind dangling symlink", path: "dangling.go/new.go", outside: true},
+		{name: "new file in the workspace", path: "pkg/new.go"},
+		{name: "new file in new directory in the workspace", path: "pkg/sub/new.go"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ws.Abs(tt.path)
+			if tt.outside && err == nil {
+				t.Fatalf("Abs(%q) succeeded, want an error", tt.path)
+			}
+			if !tt.outside && err != nil {
+				t.Fatalf("Abs(%q) = %v, want no error", tt.path, err)
+			}
+			if tt.outside && !errors.Is(err, ErrOutside) {
+				t.Fatalf("Abs(%q) = %v, want ErrOutside", tt.path, err)
+			}
+		})
+	}
+}